@@ -3,15 +3,23 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/andreevym/metric-collector/internal/logger"
+	grpctransport "github.com/andreevym/metric-collector/internal/transport/grpc"
 	"github.com/andreevym/metric-collector/internal/transport/grpc/proto"
+	"go.uber.org/zap"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
 	"log"
+	"os"
+	"os/signal"
+	"syscall"
 	"time"
 
 	"github.com/andreevym/metric-collector/internal/config"
+	"github.com/andreevym/metric-collector/internal/crypto"
 	"github.com/andreevym/metric-collector/internal/metricagent"
 )
 
@@ -36,7 +44,8 @@ func printVersion() {
 }
 
 // main is the entry point of the application.
-// It initializes configurations, logging, and starts the agent.
+// It initializes configurations, logging, and runs the agent until SIGTERM or SIGINT,
+// SIGHUP reloads the config file and the environment variables.
 func main() {
 	printVersion()
 
@@ -49,31 +58,137 @@ func main() {
 		log.Fatal("logger can't be initialized:", cfg.LogLevel, err)
 	}
 
-	// Convert poll and report intervals to time.Duration.
-	pollDuration := time.Duration(cfg.PollInterval) * time.Second
-	reportDuration := time.Duration(cfg.ReportInterval) * time.Second
-	liveTime := time.Minute
+	// сигналы перехватываются до запуска агента, чтобы даже ранняя остановка отправила собранные метрики
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
+	defer stop()
+	reload := make(chan os.Signal, 1)
+	signal.Notify(reload, syscall.SIGHUP)
 
-	conn, err := grpc.NewClient(cfg.Address, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	agent, closeAgent, err := buildAgent(cfg)
 	if err != nil {
-		log.Fatal(err)
+		log.Fatal("failed to create agent: ", err)
+	}
+	for {
+		next, nextCfg, closeNext, err := run(ctx, agent, cfg, reload)
+		closeAgent()
+		if err != nil {
+			log.Fatal("failed to execute agent:", err)
+		}
+		if next == nil {
+			return
+		}
+		// предыдущий агент остановлен, логгер можно пересоздать с новым уровнем
+		if _, err = logger.NewLogger(nextCfg.LogLevel); err != nil {
+			logger.Logger().Error("failed to change log level", zap.String("level", nextCfg.LogLevel), zap.Error(err))
+		}
+		agent, cfg, closeAgent = next.WithCountersFrom(agent), nextCfg, closeNext
 	}
-	defer conn.Close()
-	grpcClient := proto.NewMetricCollectorClient(conn)
+}
+
+// run runs the agent until it stops. On SIGHUP the config is reloaded and the next agent is created,
+// then the agent is stopped and the next one is returned together with its config and closer.
+// A config that can't be loaded is logged and the agent keeps running with the current one.
+func run(
+	ctx context.Context,
+	agent *metricagent.Agent,
+	cfg *config.AgentConfig,
+	reload <-chan os.Signal,
+) (*metricagent.Agent, *config.AgentConfig, func(), error) {
+	// очередь открывается только после остановки предыдущего агента, который мог дописать в неё пакеты
+	if cfg.SpoolDir != "" {
+		spool, err := metricagent.NewSpool(cfg.SpoolDir, cfg.SpoolMaxBatches)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("open spool: %w", err)
+		}
+		agent.WithSpool(spool)
+	}
+
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- agent.Run(runCtx) }()
 
-	// Create and run the agent.
-	err = metricagent.NewAgent(
+	for {
+		select {
+		case err := <-done:
+			return nil, nil, nil, err
+		case <-reload:
+		}
+		nextCfg, err := cfg.Reload()
+		var next *metricagent.Agent
+		var closeNext func()
+		if err == nil {
+			next, closeNext, err = buildAgent(nextCfg)
+		}
+		if err != nil {
+			logger.Logger().Error("failed to reload config, keep the current one", zap.Error(err))
+			continue
+		}
+		logger.Logger().Info("config reloaded, restarting agent")
+		cancel()
+		if err = <-done; err != nil {
+			closeNext()
+			return nil, nil, nil, err
+		}
+		return next, nextCfg, closeNext, nil
+	}
+}
+
+// buildAgent creates the agent of the config without the spool, the returned function closes its connections.
+func buildAgent(cfg *config.AgentConfig) (*metricagent.Agent, func(), error) {
+	collectors, err := metricagent.ParseCollectorConfigs(cfg.Collectors, cfg.CollectorIntervals, cfg.CollectorTimeouts)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tlsConfig, err := crypto.ClientTLSConfig(cfg.TLSCA, cfg.TLSCert, cfg.TLSKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load tls config: %w", err)
+	}
+	transportCredentials := insecure.NewCredentials()
+	if tlsConfig != nil {
+		transportCredentials = credentials.NewTLS(tlsConfig)
+	}
+
+	encrypter, err := crypto.LoadEncrypter(cfg.CryptoKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("load crypto key: %w", err)
+	}
+
+	dialOptions := []grpc.DialOption{grpc.WithTransportCredentials(transportCredentials)}
+	if encrypter != nil {
+		dialOptions = append(dialOptions,
+			grpc.WithDefaultCallOptions(grpc.ForceCodec(grpctransport.NewClientCodec(encrypter))))
+	}
+	conn, err := grpc.NewClient(cfg.Address, dialOptions...)
+	if err != nil {
+		return nil, nil, fmt.Errorf("create grpc client: %w", err)
+	}
+	closeConn := func() {
+		if err := conn.Close(); err != nil {
+			logger.Logger().Error("failed to close grpc connection", zap.Error(err))
+		}
+	}
+
+	// Convert poll and report intervals to time.Duration.
+	pollDuration := time.Duration(cfg.PollInterval) * time.Second
+	reportDuration := time.Duration(cfg.ReportInterval) * time.Second
+	liveTime := time.Duration(cfg.LiveTime) * time.Second
+
+	agent := metricagent.NewAgent(
 		cfg.SecretKey,
-		cfg.CryptoKey,
+		encrypter,
+		cfg.TenantKey,
 		cfg.Address,
 		pollDuration,
 		reportDuration,
 		liveTime,
 		cfg.RateLimit,
-		grpcClient,
+		proto.NewMetricCollectorClient(conn),
 		cfg.IsGrpcRequest,
-	).Run()
-	if err != nil {
-		log.Fatal("failed to execute agent:", err)
-	}
+	).
+		WithTLS(tlsConfig).
+		WithShutdownTimeout(time.Duration(cfg.ShutdownTimeout) * time.Second).
+		WithCollectors(collectors)
+	return agent, closeConn, nil
 }
@@ -0,0 +1,98 @@
+// Package main is the entry point of the certgen tool.
+// It creates a local certificate authority and the server and agent certificates signed by it,
+// that are used to run the server and the agent over TLS and mutual TLS.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/andreevym/metric-collector/internal/crypto"
+)
+
+// certificate file names inside the output directory.
+const (
+	caCertFile     = "ca.pem"
+	caKeyFile      = "ca-key.pem"
+	serverCertFile = "server.pem"
+	serverKeyFile  = "server-key.pem"
+	clientCertFile = "client.pem"
+	clientKeyFile  = "client-key.pem"
+)
+
+func main() {
+	var out, hosts, serverName, clientName string
+	flag.StringVar(&out, "out", "./certs", "директория для сертификатов и ключей")
+	flag.StringVar(&hosts, "hosts", "localhost,127.0.0.1,::1", "IP-адреса и DNS-имена сервера через запятую")
+	flag.StringVar(&serverName, "server-cn", "metric-collector", "имя владельца сертификата сервера")
+	flag.StringVar(&clientName, "client-cn", "agent", "имя владельца сертификата агента, "+
+		"по нему сервер определяет клиента при mTLS")
+	flag.Parse()
+
+	if err := run(out, strings.Split(hosts, ","), serverName, clientName); err != nil {
+		log.Fatal("failed to generate certificates: ", err)
+	}
+}
+
+func run(out string, hosts []string, serverName string, clientName string) error {
+	if err := os.MkdirAll(out, 0o755); err != nil {
+		return fmt.Errorf("failed to create directory '%s': %w", out, err)
+	}
+
+	caKey, caCert, err := crypto.GenerateCertificate(crypto.CertificateOptions{
+		CommonName: "metric-collector CA",
+		IsCA:       true,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate CA: %w", err)
+	}
+	if err = write(out, caCertFile, caKeyFile, caCert, caKey); err != nil {
+		return err
+	}
+
+	serverKey, serverCert, err := crypto.GenerateCertificate(crypto.CertificateOptions{
+		CommonName: serverName,
+		Hosts:      hosts,
+		ParentCert: caCert,
+		ParentKey:  caKey,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate server certificate: %w", err)
+	}
+	if err = write(out, serverCertFile, serverKeyFile, serverCert, serverKey); err != nil {
+		return err
+	}
+
+	clientKey, clientCert, err := crypto.GenerateCertificate(crypto.CertificateOptions{
+		CommonName: clientName,
+		ParentCert: caCert,
+		ParentKey:  caKey,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to generate client certificate: %w", err)
+	}
+	if err = write(out, clientCertFile, clientKeyFile, clientCert, clientKey); err != nil {
+		return err
+	}
+
+	fmt.Printf("server: -tls-cert %s -tls-key %s -tls-client-ca %s\n",
+		filepath.Join(out, serverCertFile), filepath.Join(out, serverKeyFile), filepath.Join(out, caCertFile))
+	fmt.Printf("agent: -tls-ca %s -tls-cert %s -tls-key %s\n",
+		filepath.Join(out, caCertFile), filepath.Join(out, clientCertFile), filepath.Join(out, clientKeyFile))
+	return nil
+}
+
+func write(out string, certName string, keyName string, cert string, key string) error {
+	if err := os.WriteFile(filepath.Join(out, certName), []byte(cert), 0o644); err != nil {
+		return fmt.Errorf("failed to write %s: %w", certName, err)
+	}
+	// приватный ключ доступен только владельцу
+	if err := os.WriteFile(filepath.Join(out, keyName), []byte(key), 0o600); err != nil {
+		return fmt.Errorf("failed to write %s: %w", keyName, err)
+	}
+	return nil
+}
@@ -4,9 +4,11 @@ package main
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/andreevym/metric-collector/internal/transport/grpc"
 	"github.com/andreevym/metric-collector/internal/transport/http"
+	"io"
 	"io/fs"
 	"log"
 	"os"
@@ -15,14 +17,32 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/andreevym/metric-collector/internal/audit"
+	"github.com/andreevym/metric-collector/internal/cardinality"
 	"github.com/andreevym/metric-collector/internal/config"
+	"github.com/andreevym/metric-collector/internal/controller"
+	"github.com/andreevym/metric-collector/internal/ingest"
 	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/ratelimit"
+	"github.com/andreevym/metric-collector/internal/retention"
+	"github.com/andreevym/metric-collector/internal/selfmetrics"
+	"github.com/andreevym/metric-collector/internal/storage/bolt"
+	"github.com/andreevym/metric-collector/internal/storage/cache"
 	"github.com/andreevym/metric-collector/internal/storage/mem"
 	"github.com/andreevym/metric-collector/internal/storage/postgres"
 	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/tenant"
 	"go.uber.org/zap"
 )
 
+const (
+	// ingestFlushTimeout время на сохранение буфера отложенной записи при остановке сервера
+	ingestFlushTimeout = 10 * time.Second
+	// cardinalitySyncInterval интервал сверки известных метрик с хранилищем,
+	// чтобы удалённые метрики переставали учитываться в ограничениях
+	cardinalitySyncInterval = time.Minute
+)
+
 var buildVersion string
 var buildDate string
 var buildCommit string
@@ -72,15 +92,110 @@ func main() {
 	if err != nil {
 		logger.Logger().Fatal("can't build PgClient", zap.Error(err))
 	}
-	defer pgClient.Close()
+	if pgClient != nil {
+		defer pgClient.Close()
+	}
+
+	replicaPgClient, err := BuildReplicaPgClient(cfg)
+	if err != nil {
+		logger.Logger().Fatal("can't build replica PgClient", zap.Error(err))
+	}
+	if replicaPgClient != nil {
+		defer replicaPgClient.Close()
+	}
 
 	storeInterval := time.Duration(cfg.StoreInterval) * time.Second
-	storage, err := BuildStorage(pgClient, cfg, storeInterval)
+	storage, err := BuildStorage(pgClient, replicaPgClient, cfg, storeInterval)
 	if err != nil {
 		logger.Logger().Fatal("can't create metric storage", zap.Error(err))
 	}
+	if closer, ok := storage.(io.Closer); ok {
+		defer closer.Close()
+	}
+
+	selfMetricsReporter := selfmetrics.NewReporter(storage, time.Duration(cfg.SelfMetricsInterval)*time.Second)
+	if pgClient != nil {
+		selfMetricsReporter.Register(pgClient.PoolMetrics)
+	}
+	if cachedStorage, ok := storage.(*cache.Storage); ok {
+		selfMetricsReporter.Register(cachedStorage.Metrics)
+	}
+	go selfMetricsReporter.Run(ctx)
+
+	tenants, err := tenant.ParseKeys(cfg.TenantKeys)
+	if err != nil {
+		logger.Logger().Fatal("can't parse tenant keys", zap.Error(err))
+	}
+	// запросы работают с метриками своего арендатора, фоновые задачи — со всем хранилищем
+	requestStorage := storage
+	if tenants.Enabled() {
+		requestStorage = tenant.NewStorage(storage)
+	}
+
+	ctrl := controller.NewController(requestStorage, nil)
+	if pgClient != nil {
+		ctrl = controller.NewController(requestStorage, pgClient)
+	}
+
+	ctrl = ctrl.WithLimits(
+		ratelimit.NewLimiter(cfg.ClientRateLimit, cfg.ClientRateBurst),
+		ratelimit.NewSeriesQuota(cfg.ClientSeriesQuota, time.Duration(cfg.ClientSeriesWindow)*time.Second),
+	)
+
+	prefixLimits, err := cardinality.ParsePrefixLimits(cfg.SeriesPrefixLimits)
+	if err != nil {
+		logger.Logger().Fatal("can't parse series prefix limits", zap.Error(err))
+	}
+	guard := cardinality.NewGuard(cardinality.Limits{
+		MaxNameLength: cfg.MetricNameMaxLength,
+		MaxSeries:     cfg.MaxSeries,
+		Prefixes:      prefixLimits,
+		Drop:          cfg.CardinalityDrop,
+	})
+	if err = guard.Sync(ctx, storage); err != nil {
+		logger.Logger().Error("can't load series for cardinality limits", zap.Error(err))
+	}
+	go guard.Run(ctx, storage, cardinalitySyncInterval)
+	selfMetricsReporter.Register(guard.Metrics)
+	ctrl = ctrl.WithCardinality(guard)
 
-	httpServer, _ := http.NewHTTPServer(pgClient, storage, cfg.SecretKey, cfg.CryptoKey, cfg.TrustedSubnet, cfg.Address)
+	var ingestBuffer *ingest.Buffer
+	if cfg.IngestFlushInterval > 0 {
+		ingestBuffer = ingest.NewBuffer(
+			storage,
+			time.Duration(cfg.IngestFlushInterval)*time.Millisecond,
+			cfg.IngestBufferSize,
+		).WithMaxPending(cfg.IngestMaxPending)
+		ctrl = ctrl.WithBuffer(ingestBuffer)
+		go ingestBuffer.Run(ctx)
+	}
+
+	auditSink, err := BuildAuditSink(pgClient, cfg)
+	if err != nil {
+		logger.Logger().Fatal("can't create audit log", zap.Error(err))
+	}
+	if closer, ok := auditSink.(io.Closer); ok {
+		defer closer.Close()
+	}
+	auditLog := audit.NewLog(auditSink)
+	ctrl = ctrl.WithAudit(auditLog)
+
+	retentionRules, err := retention.ParseRules(cfg.RetentionRules)
+	if err != nil {
+		logger.Logger().Fatal("can't parse retention rules", zap.Error(err))
+	}
+	janitor := retention.NewJanitor(
+		storage,
+		retention.Policy{Default: time.Duration(cfg.Retention) * time.Second, Rules: retentionRules},
+		time.Duration(cfg.RetentionInterval)*time.Second,
+	).WithAudit(auditLog)
+	ctrl = ctrl.WithJanitor(janitor)
+	go janitor.Run(ctx)
+
+	httpServer, err := http.NewHTTPServer(ctrl, requestStorage, cfg)
+	if err != nil {
+		logger.Logger().Fatal("can't create http server", zap.Error(err))
+	}
 	go func() {
 		defer cancel()
 		if err := httpServer.Run(); err != nil {
@@ -88,7 +203,10 @@ func main() {
 		}
 	}()
 
-	grpcServer := grpc.NewGrpcServer(pgClient, storage, cfg.SecretKey, cfg.CryptoKey, cfg.TrustedSubnet, cfg.Address)
+	grpcServer, err := grpc.NewGrpcServer(ctrl, requestStorage, cfg)
+	if err != nil {
+		logger.Logger().Fatal("can't create grpc server", zap.Error(err))
+	}
 	go func() {
 		defer cancel()
 		if err := grpcServer.Run(); err != nil {
@@ -131,24 +249,84 @@ func main() {
 			}
 			logger.Logger().Info("server grpc stopped gracefully")
 
+			flushIngestBuffer(ingestBuffer)
+
 			if err := storage.BackupPeriodically(); err != nil {
 				logger.Logger().Fatal("backup failed", zap.Error(err))
 			}
 			return
 		case <-ctx.Done():
 			logger.Logger().Info("shutting down server context done...")
+			flushIngestBuffer(ingestBuffer)
 			return
 		}
 	}
 }
 
+// flushIngestBuffer saves metrics still pending in the ingest buffer, so that they are not lost on shutdown.
+// It uses its own context because the server context is already cancelled at this point.
+func flushIngestBuffer(ingestBuffer *ingest.Buffer) {
+	if ingestBuffer == nil {
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), ingestFlushTimeout)
+	defer cancel()
+	if err := ingestBuffer.Flush(ctx); err != nil {
+		logger.Logger().Error("failed to flush ingest buffer", zap.Error(err))
+		return
+	}
+	logger.Logger().Info("ingest buffer flushed")
+}
+
+// BuildAuditSink creates the sink of the audit log, it returns nil if auditing is disabled.
+func BuildAuditSink(pgClient *postgres.PgClient, cfg *config.ServerConfig) (audit.Sink, error) {
+	if cfg.AuditDatabase {
+		if pgClient == nil {
+			return nil, errors.New("audit database requires database dsn")
+		}
+		return postgres.NewAuditSink(pgClient), nil
+	}
+	if cfg.AuditFile == "" {
+		return nil, nil
+	}
+	return audit.NewFileSink(cfg.AuditFile, int64(cfg.AuditFileMaxSize)<<20, cfg.AuditFileMaxBackups)
+}
+
 func BuildPgClient(ctx context.Context, cfg *config.ServerConfig) (*postgres.PgClient, error) {
 	if cfg.DatabaseDsn == "" {
 		return nil, nil
 	}
 
 	// Create a PostgreSQL client and storage
-	pgClient, err := postgres.NewPgClient(cfg.DatabaseDsn)
+	pgClient, err := newPgClient(cfg.DatabaseDsn, cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = applyMigrations(ctx, pgClient); err != nil {
+		return nil, fmt.Errorf("failed to apply migrations to the database: %w", err)
+	}
+
+	return pgClient, nil
+}
+
+// BuildReplicaPgClient creates a client to the read-only replica, migrations are not applied to it.
+func BuildReplicaPgClient(cfg *config.ServerConfig) (*postgres.PgClient, error) {
+	if cfg.DatabaseDsn == "" || cfg.DatabaseReadDsn == "" {
+		return nil, nil
+	}
+
+	return newPgClient(cfg.DatabaseReadDsn, cfg)
+}
+
+func newPgClient(dsn string, cfg *config.ServerConfig) (*postgres.PgClient, error) {
+	pgClient, err := postgres.NewPgClient(dsn, &postgres.PoolOptional{
+		MaxOpenConns:     cfg.DatabaseMaxOpenConns,
+		MaxIdleConns:     cfg.DatabaseMaxIdleConns,
+		ConnMaxLifetime:  time.Duration(cfg.DatabaseConnMaxLifetime) * time.Second,
+		ConnMaxIdleTime:  time.Duration(cfg.DatabaseConnMaxIdleTime) * time.Second,
+		StatementTimeout: time.Duration(cfg.DatabaseStatementTimeout) * time.Second,
+	})
 	if err != nil {
 		return nil, fmt.Errorf("can't create database client: %w", err)
 	}
@@ -158,16 +336,33 @@ func BuildPgClient(ctx context.Context, cfg *config.ServerConfig) (*postgres.PgC
 		return nil, fmt.Errorf("can't ping database: %w", err)
 	}
 
-	if err = applyMigrations(ctx, pgClient); err != nil {
-		return nil, fmt.Errorf("failed to apply migrations to the database: %w", err)
-	}
-
 	return pgClient, nil
 }
 
-func BuildStorage(pgClient *postgres.PgClient, cfg *config.ServerConfig, storeInterval time.Duration) (store.Storage, error) {
+func BuildStorage(
+	pgClient *postgres.PgClient,
+	replicaPgClient *postgres.PgClient,
+	cfg *config.ServerConfig,
+	storeInterval time.Duration,
+) (store.Storage, error) {
 	if pgClient != nil {
-		return postgres.NewPgStorage(pgClient), nil
+		var pgStorage store.Storage
+		if replicaPgClient != nil {
+			pgStorage = postgres.NewPgStorageWithReplica(pgClient, replicaPgClient)
+		} else {
+			pgStorage = postgres.NewPgStorage(pgClient)
+		}
+		if cfg.CacheSize > 0 {
+			return cache.NewStorage(pgStorage, cfg.CacheSize, time.Duration(cfg.CacheTTL)*time.Second), nil
+		}
+		return pgStorage, nil
+	}
+	if cfg.BoltPath != "" {
+		boltStorage, err := bolt.NewStorage(cfg.BoltPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open bolt storage: %w", err)
+		}
+		return boltStorage, nil
 	}
 
 	memMetricStorage := mem.NewStorage(&mem.BackupOptional{
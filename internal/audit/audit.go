@@ -0,0 +1,208 @@
+// Package audit records who changed what: every write of metrics and every call of an admin endpoint
+// is stored as an Event with the client identity, the metric IDs and their old and new values.
+//
+// Events are written to a Sink, a rotating JSON-lines file (FileSink) or the audit table of Postgres,
+// and are read back by admins through the same Sink.
+package audit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/identity"
+	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"go.uber.org/zap"
+)
+
+// Actions of the events.
+const (
+	// ActionUpdate update of a single metric.
+	ActionUpdate = "update"
+	// ActionUpdates batch update of metrics.
+	ActionUpdates = "updates"
+	// ActionAdmin call of an admin endpoint.
+	ActionAdmin = "admin"
+	// ActionExpire deletion of an expired metric by the retention janitor.
+	ActionExpire = "expire"
+)
+
+// TargetRetention target of the events recorded by the retention janitor.
+const TargetRetention = "retention"
+
+const (
+	// DefaultLimit number of events returned by Query if the filter has no limit.
+	DefaultLimit = 100
+	// MaxLimit the maximum number of events returned by Query.
+	MaxLimit = 10000
+)
+
+// Value is the stored value of a metric: the delta of a counter or the value of a gauge.
+type Value struct {
+	Delta *int64   `json:"delta,omitempty"`
+	Value *float64 `json:"value,omitempty"`
+}
+
+// Change is a change of a single metric.
+type Change struct {
+	ID    string `json:"id"`
+	MType string `json:"type"`
+	// Old value before the write including buffered writes not flushed yet, nil if the metric didn't exist
+	Old *Value `json:"old,omitempty"`
+	// New value after the write, for a buffered write the value the metric gets when the buffer is flushed
+	New *Value `json:"new,omitempty"`
+}
+
+// Event is a single audited call.
+type Event struct {
+	Time   time.Time `json:"time"`
+	Action string    `json:"action"`
+	// Client key of the client the call is accounted by, see identity.Identity.Key
+	Client  string `json:"client"`
+	Tenant  string `json:"tenant,omitempty"`
+	Subject string `json:"subject,omitempty"`
+	User    string `json:"user,omitempty"`
+	IP      string `json:"ip,omitempty"`
+	// Target the admin endpoint or TargetRetention, empty for writes of metrics
+	Target  string   `json:"target,omitempty"`
+	Changes []Change `json:"changes,omitempty"`
+	// Error of the call, empty if it succeeded
+	Error string `json:"error,omitempty"`
+}
+
+// Filter selects events, zero fields match every event.
+type Filter struct {
+	Since  time.Time
+	Until  time.Time
+	Action string
+	Client string
+	Tenant string
+	// MetricID matches events changing the metric
+	MetricID string
+	// Limit the maximum number of the latest events, DefaultLimit if zero
+	Limit int
+}
+
+// Match reports whether the event matches the filter, the limit is not checked.
+func (f Filter) Match(e Event) bool {
+	if !f.Since.IsZero() && e.Time.Before(f.Since) {
+		return false
+	}
+	if !f.Until.IsZero() && !e.Time.Before(f.Until) {
+		return false
+	}
+	if (f.Action != "" && e.Action != f.Action) || (f.Client != "" && e.Client != f.Client) ||
+		(f.Tenant != "" && e.Tenant != f.Tenant) {
+		return false
+	}
+	if f.MetricID == "" {
+		return true
+	}
+	for _, c := range e.Changes {
+		if c.ID == f.MetricID {
+			return true
+		}
+	}
+	return false
+}
+
+// EffectiveLimit returns the limit of the filter bounded by MaxLimit.
+func (f Filter) EffectiveLimit() int {
+	if f.Limit <= 0 {
+		return DefaultLimit
+	}
+	return min(f.Limit, MaxLimit)
+}
+
+// Sink stores events.
+type Sink interface {
+	Write(ctx context.Context, e Event) error
+	// Query returns the latest events matching the filter, newest first.
+	Query(ctx context.Context, f Filter) ([]Event, error)
+}
+
+// Log records events of the calls to the sink.
+type Log struct {
+	sink Sink
+	now  func() time.Time
+}
+
+// NewLog creates a Log writing to sink, it returns nil if sink is nil, that is auditing is disabled.
+func NewLog(sink Sink) *Log {
+	if sink == nil {
+		return nil
+	}
+	return &Log{sink: sink, now: time.Now}
+}
+
+// Enabled reports whether the calls are audited.
+func (l *Log) Enabled() bool {
+	return l != nil
+}
+
+// Record writes the event of the call made by the client of ctx.
+// A failure to write the event is logged and doesn't fail the call.
+func (l *Log) Record(ctx context.Context, action, target string, changes []Change, callErr error) {
+	if l == nil {
+		return
+	}
+	id := identity.FromContext(ctx)
+	e := Event{
+		Time:    l.now().UTC(),
+		Action:  action,
+		Client:  id.Key(),
+		Tenant:  id.Tenant,
+		Subject: id.Subject,
+		User:    id.User,
+		IP:      id.IP,
+		Target:  target,
+		Changes: changes,
+	}
+	if callErr != nil {
+		e.Error = callErr.Error()
+	}
+	// событие пишется и после отмены запроса клиентом, иначе изменение останется без записи
+	if err := l.sink.Write(context.WithoutCancel(ctx), e); err != nil {
+		logger.Logger().Error("failed to write audit event",
+			zap.String("action", action),
+			zap.String("client", e.Client),
+			zap.Error(err),
+		)
+	}
+}
+
+// Query returns the latest events matching the filter, newest first.
+func (l *Log) Query(ctx context.Context, f Filter) ([]Event, error) {
+	if l == nil {
+		return []Event{}, nil
+	}
+	events, err := l.sink.Query(ctx, f)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query audit events: %w", err)
+	}
+	return events, nil
+}
+
+// ValueOf returns the value of the metric, nil for nil.
+func ValueOf(m *store.Metric) *Value {
+	if m == nil {
+		return nil
+	}
+	c := store.CopyMetric(m)
+	return &Value{Delta: c.Delta, Value: c.Value}
+}
+
+// Merge returns the value of the metric after writing m over the value old:
+// deltas of counters are summed and the value of a gauge is replaced. It returns old if m is nil.
+func Merge(old *Value, m *store.Metric) *Value {
+	if m == nil {
+		return old
+	}
+	v := ValueOf(m)
+	if m.MType == store.MTypeCounter && old != nil && old.Delta != nil && v.Delta != nil {
+		delta := *old.Delta + *v.Delta
+		v.Delta = &delta
+	}
+	return v
+}
@@ -0,0 +1,114 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/identity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "audit.log")
+	// маленький размер файла, чтобы каждые несколько событий происходила ротация
+	sink, err := NewFileSink(path, 512, 2)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 10; i++ {
+		delta := int64(i)
+		err = sink.Write(context.Background(), Event{
+			Time:    start.Add(time.Duration(i) * time.Minute),
+			Action:  ActionUpdate,
+			Client:  "tenant:team-a",
+			Tenant:  "team-a",
+			Changes: []Change{{ID: "PollCount", MType: "counter", New: &Value{Delta: &delta}}},
+		})
+		require.NoError(t, err)
+	}
+	_, err = os.Stat(path + ".2")
+	require.NoError(t, err)
+	_, err = os.Stat(path + ".3")
+	require.True(t, errors.Is(err, os.ErrNotExist), "old files are removed")
+
+	events, err := sink.Query(context.Background(), Filter{Limit: 3})
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	require.Equal(t, int64(9), *events[0].Changes[0].New.Delta, "newest first")
+	require.Equal(t, int64(7), *events[2].Changes[0].New.Delta)
+
+	events, err = sink.Query(context.Background(), Filter{Since: start.Add(8 * time.Minute)})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+
+	events, err = sink.Query(context.Background(), Filter{MetricID: "Alloc"})
+	require.NoError(t, err)
+	require.Empty(t, events)
+
+	// журнал дописывается после перезапуска
+	require.NoError(t, sink.Close())
+	sink, err = NewFileSink(path, 512, 2)
+	require.NoError(t, err)
+	require.NoError(t, sink.Write(context.Background(), Event{Time: start.Add(time.Hour), Action: ActionAdmin}))
+	events, err = sink.Query(context.Background(), Filter{Limit: 2})
+	require.NoError(t, err)
+	require.Equal(t, ActionAdmin, events[0].Action)
+	require.Equal(t, ActionUpdate, events[1].Action)
+}
+
+func TestFilter_Match(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	e := Event{
+		Time:    now,
+		Action:  ActionUpdates,
+		Client:  "cert:agent-1",
+		Tenant:  "team-a",
+		Changes: []Change{{ID: "Alloc"}, {ID: "PollCount"}},
+	}
+	require.True(t, Filter{}.Match(e))
+	require.True(t, Filter{Since: now, Until: now.Add(time.Second), Action: ActionUpdates,
+		Client: "cert:agent-1", Tenant: "team-a", MetricID: "PollCount"}.Match(e))
+	require.False(t, Filter{Until: now}.Match(e))
+	require.False(t, Filter{Since: now.Add(time.Second)}.Match(e))
+	require.False(t, Filter{Tenant: "team-b"}.Match(e))
+	require.False(t, Filter{MetricID: "HeapAlloc"}.Match(e))
+}
+
+type memorySink struct {
+	events []Event
+}
+
+func (s *memorySink) Write(_ context.Context, e Event) error {
+	s.events = append(s.events, e)
+	return nil
+}
+
+func (s *memorySink) Query(context.Context, Filter) ([]Event, error) {
+	return s.events, nil
+}
+
+func TestLog_Record(t *testing.T) {
+	var disabled *Log
+	require.False(t, disabled.Enabled())
+	disabled.Record(context.Background(), ActionUpdate, "", nil, nil)
+
+	sink := &memorySink{}
+	l := NewLog(sink)
+	ctx := identity.WithIdentity(context.Background(), identity.Identity{Tenant: "team-a", IP: "10.0.0.1"})
+	ctx, cancel := context.WithCancel(ctx)
+	cancel()
+	l.Record(ctx, ActionAdmin, "GET /admin/audit", nil, errors.New("failed"))
+
+	require.Len(t, sink.events, 1)
+	e := sink.events[0]
+	require.Equal(t, "tenant:team-a", e.Client)
+	require.Equal(t, "team-a", e.Tenant)
+	require.Equal(t, "10.0.0.1", e.IP)
+	require.Equal(t, "GET /admin/audit", e.Target)
+	require.Equal(t, "failed", e.Error)
+}
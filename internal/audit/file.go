@@ -0,0 +1,186 @@
+package audit
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"strconv"
+	"sync"
+)
+
+const (
+	// DefaultMaxSize size of the audit file in bytes after which it is rotated.
+	DefaultMaxSize = 100 << 20
+	// DefaultMaxBackups number of rotated audit files kept next to the current one.
+	DefaultMaxBackups = 5
+	// maxLineSize the maximum size of a single event in the file.
+	maxLineSize = 16 << 20
+)
+
+// FileSink writes events as JSON lines to a file. When the file exceeds maxSize it is renamed to
+// path.1, the previous path.1 to path.2 and so on, files older than path.<maxBackups> are removed.
+type FileSink struct {
+	path       string
+	maxSize    int64
+	maxBackups int
+
+	mu     sync.Mutex
+	file   *os.File
+	size   int64
+	closed bool
+}
+
+// NewFileSink opens the audit file for appending,
+// zero maxSize and maxBackups are replaced by DefaultMaxSize and DefaultMaxBackups.
+func NewFileSink(path string, maxSize int64, maxBackups int) (*FileSink, error) {
+	if maxSize <= 0 {
+		maxSize = DefaultMaxSize
+	}
+	if maxBackups <= 0 {
+		maxBackups = DefaultMaxBackups
+	}
+	s := &FileSink{path: path, maxSize: maxSize, maxBackups: maxBackups}
+	if err := s.open(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *FileSink) open() error {
+	file, err := os.OpenFile(s.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o600)
+	if err != nil {
+		return fmt.Errorf("failed to open audit file '%s': %w", s.path, err)
+	}
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return fmt.Errorf("failed to stat audit file '%s': %w", s.path, err)
+	}
+	s.file = file
+	s.size = info.Size()
+	return nil
+}
+
+// Write appends the event to the file, rotating it first if the event doesn't fit.
+func (s *FileSink) Write(_ context.Context, e Event) error {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit event: %w", err)
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return errors.New("audit file is closed")
+	}
+	// файл не открыт, если предыдущая ротация завершилась ошибкой
+	if s.file == nil {
+		if err = s.open(); err != nil {
+			return err
+		}
+	}
+	if s.size > 0 && s.size+int64(len(line)) > s.maxSize {
+		if err = s.rotate(); err != nil {
+			return err
+		}
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return fmt.Errorf("failed to write audit event: %w", err)
+	}
+	return nil
+}
+
+func (s *FileSink) rotate() error {
+	if err := s.file.Close(); err != nil {
+		return fmt.Errorf("failed to close audit file: %w", err)
+	}
+	s.file = nil
+	for i := s.maxBackups - 1; i >= 1; i-- {
+		err := os.Rename(s.backupPath(i), s.backupPath(i+1))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to rotate audit file: %w", err)
+		}
+	}
+	if err := os.Rename(s.path, s.backupPath(1)); err != nil {
+		return fmt.Errorf("failed to rotate audit file: %w", err)
+	}
+	return s.open()
+}
+
+func (s *FileSink) backupPath(i int) string {
+	return s.path + "." + strconv.Itoa(i)
+}
+
+// Query scans the current and the rotated files and returns the latest matching events, newest first.
+func (s *FileSink) Query(_ context.Context, f Filter) ([]Event, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	limit := f.EffectiveLimit()
+	events := []Event{}
+	// файлы читаются от нового к старому, пока не набрано limit событий
+	for i := 0; i <= s.maxBackups && len(events) < limit; i++ {
+		path := s.path
+		if i > 0 {
+			path = s.backupPath(i)
+		}
+		matched, err := readEvents(path, f)
+		if err != nil {
+			return nil, err
+		}
+		for j := len(matched) - 1; j >= 0 && len(events) < limit; j-- {
+			events = append(events, matched[j])
+		}
+	}
+	return events, nil
+}
+
+// readEvents returns the events of the file matching the filter in the order they were written.
+func readEvents(path string, f Filter) ([]Event, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to open audit file '%s': %w", path, err)
+	}
+	defer file.Close()
+
+	var events []Event
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64<<10), maxLineSize)
+	for scanner.Scan() {
+		var e Event
+		if err = json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			// строка, оборванная при аварийной остановке, не мешает чтению остальных событий
+			continue
+		}
+		if f.Match(e) {
+			events = append(events, e)
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read audit file '%s': %w", path, err)
+	}
+	return events, nil
+}
+
+// Close closes the audit file.
+func (s *FileSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
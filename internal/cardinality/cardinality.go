@@ -0,0 +1,287 @@
+// Package cardinality protects the storage from metric explosion: it validates metric names
+// and limits the number of distinct series in total and per name prefix.
+package cardinality
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/selfmetrics"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/tenant"
+	"go.uber.org/zap"
+)
+
+var (
+	// ErrInvalidName indicates a metric name that is empty, too long or contains forbidden characters.
+	ErrInvalidName = errors.New("invalid metric name")
+	// ErrLimitExceeded indicates that a new series doesn't fit into the cardinality limits.
+	ErrLimitExceeded = errors.New("cardinality limit exceeded")
+)
+
+// nameRegexp allowed metric name characters, '/' is reserved for tenant namespaces.
+var nameRegexp = regexp.MustCompile(`^[A-Za-z0-9_.:-]+$`)
+
+// PrefixLimit limits the number of series whose name starts with Prefix.
+type PrefixLimit struct {
+	Prefix string
+	Limit  int
+}
+
+// Limits configures the Guard, zero values disable the corresponding limit.
+type Limits struct {
+	// MaxNameLength maximum length of a metric name in bytes.
+	MaxNameLength int
+	// MaxSeries maximum number of distinct series in the storage.
+	MaxSeries int
+	// Prefixes limits per name prefix, a series is accounted by the first matching prefix.
+	Prefixes []PrefixLimit
+	// Drop drops series exceeding the limits from a batch and saves the rest,
+	// otherwise the whole batch is rejected.
+	Drop bool
+}
+
+// ParsePrefixLimits parses a comma separated list of "prefix=limit" pairs, e.g. "cpu_=64,disk.=32".
+func ParsePrefixLimits(s string) ([]PrefixLimit, error) {
+	var limits []PrefixLimit
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		prefix, limit, ok := strings.Cut(item, "=")
+		prefix = strings.TrimSpace(prefix)
+		if !ok || prefix == "" {
+			return nil, fmt.Errorf("prefix limit '%s' must look like prefix=limit", item)
+		}
+		n, err := strconv.Atoi(strings.TrimSpace(limit))
+		if err != nil || n < 0 {
+			return nil, fmt.Errorf("invalid limit of prefix limit '%s'", item)
+		}
+
+		limits = append(limits, PrefixLimit{Prefix: prefix, Limit: n})
+	}
+	return limits, nil
+}
+
+// Guard admits series into the storage according to the limits.
+// It keeps the set of known series, which is loaded from the storage by Sync.
+type Guard struct {
+	limits Limits
+
+	mu       sync.Mutex
+	series   map[string]struct{}
+	prefixes map[string]int
+	// admitted серии, учтённые после начала последней синхронизации, по ключу с именем метрики;
+	// они могут ещё не попасть в хранилище, например пока лежат в буфере записи
+	admitted map[string]string
+
+	rejectedSeries atomic.Int64
+	invalidNames   atomic.Int64
+}
+
+// NewGuard creates a Guard with the limits, it knows no series until Sync.
+func NewGuard(limits Limits) *Guard {
+	return &Guard{
+		limits:   limits,
+		series:   map[string]struct{}{},
+		prefixes: map[string]int{},
+		admitted: map[string]string{},
+	}
+}
+
+// ValidateName checks the metric name, maxLength limits its length unless it is zero.
+func ValidateName(id string, maxLength int) error {
+	if maxLength > 0 && len(id) > maxLength {
+		return fmt.Errorf("%w: name of %d bytes is longer than %d", ErrInvalidName, len(id), maxLength)
+	}
+	if !nameRegexp.MatchString(id) {
+		return fmt.Errorf("%w: '%s' must be non-empty and contain only latin letters, digits, '_', '.', ':' or '-'",
+			ErrInvalidName, id)
+	}
+	return nil
+}
+
+// Admit validates names of metrics and accounts new series.
+// An invalid name rejects the whole batch. Series exceeding the limits reject the batch,
+// or are dropped from it if Limits.Drop is set, in this case the accepted metrics are returned.
+func (g *Guard) Admit(ctx context.Context, metrics []*store.Metric) ([]*store.Metric, error) {
+	if g == nil {
+		return metrics, nil
+	}
+
+	for _, m := range metrics {
+		if err := ValidateName(m.ID, g.limits.MaxNameLength); err != nil {
+			g.invalidNames.Add(1)
+			return nil, err
+		}
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	accepted := make([]*store.Metric, 0, len(metrics))
+	added := map[string]string{}
+	var limitErr error
+	for _, m := range metrics {
+		key := tenant.QualifyID(ctx, m.ID) + "/" + m.MType
+		if _, ok := g.series[key]; ok {
+			accepted = append(accepted, m)
+			continue
+		}
+
+		if err := g.fits(m.ID); err != nil {
+			g.rejectedSeries.Add(1)
+			if !g.limits.Drop {
+				limitErr = err
+				break
+			}
+			logger.Logger().Warn("series dropped", zap.String("id", m.ID), zap.String("mType", m.MType), zap.Error(err))
+			continue
+		}
+		g.add(key, m.ID)
+		added[key] = m.ID
+		accepted = append(accepted, m)
+	}
+
+	if limitErr != nil {
+		// пачка отклоняется целиком, поэтому учтённые из неё серии забываются
+		for key, id := range added {
+			g.remove(key, id)
+		}
+		return nil, limitErr
+	}
+	return accepted, nil
+}
+
+// fits reports whether a new series with the name fits into the limits, g.mu must be held.
+func (g *Guard) fits(id string) error {
+	if g.limits.MaxSeries > 0 && len(g.series) >= g.limits.MaxSeries {
+		return fmt.Errorf("%w: storage already has %d series", ErrLimitExceeded, len(g.series))
+	}
+	if p, ok := g.prefixOf(id); ok && g.prefixes[p.Prefix] >= p.Limit {
+		return fmt.Errorf("%w: already %d series with prefix '%s'", ErrLimitExceeded, g.prefixes[p.Prefix], p.Prefix)
+	}
+	return nil
+}
+
+func (g *Guard) prefixOf(id string) (PrefixLimit, bool) {
+	for _, p := range g.limits.Prefixes {
+		if strings.HasPrefix(id, p.Prefix) {
+			return p, true
+		}
+	}
+	return PrefixLimit{}, false
+}
+
+func (g *Guard) add(key string, id string) {
+	g.series[key] = struct{}{}
+	g.admitted[key] = id
+	if p, ok := g.prefixOf(id); ok {
+		g.prefixes[p.Prefix]++
+	}
+}
+
+func (g *Guard) remove(key string, id string) {
+	delete(g.series, key)
+	delete(g.admitted, key)
+	if p, ok := g.prefixOf(id); ok {
+		g.prefixes[p.Prefix]--
+	}
+}
+
+// Sync replaces the known series with the series stored in storage and the series admitted
+// since the previous sync, which may be not saved yet,
+// so that deleted series, e.g. expired by retention, free their place.
+func (g *Guard) Sync(ctx context.Context, storage store.Storage) error {
+	g.mu.Lock()
+	previous := g.admitted
+	g.admitted = map[string]string{}
+	g.mu.Unlock()
+
+	metrics, err := storage.List(ctx)
+	if err != nil {
+		g.mu.Lock()
+		// серии остаются учтёнными до следующей синхронизации
+		for key, id := range previous {
+			g.admitted[key] = id
+		}
+		g.mu.Unlock()
+		return fmt.Errorf("failed to list metrics: %w", err)
+	}
+
+	series := make(map[string]struct{}, len(metrics))
+	prefixes := map[string]int{}
+	count := func(key string, id string) {
+		if _, ok := series[key]; ok {
+			return
+		}
+		series[key] = struct{}{}
+		if p, ok := g.prefixOf(id); ok {
+			prefixes[p.Prefix]++
+		}
+	}
+	for _, m := range metrics {
+		// ключ хранения может содержать пространство имён арендатора, лимиты префиксов считаются по имени метрики
+		name := m.ID
+		if i := strings.LastIndex(name, "/"); i >= 0 {
+			name = name[i+1:]
+		}
+		count(m.ID+"/"+m.MType, name)
+	}
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for key, id := range previous {
+		count(key, id)
+	}
+	// серии, учтённые во время чтения хранилища, остаются и для следующей синхронизации
+	for key, id := range g.admitted {
+		count(key, id)
+	}
+	g.series = series
+	g.prefixes = prefixes
+	return nil
+}
+
+// Run syncs the known series with storage every interval until ctx is done.
+func (g *Guard) Run(ctx context.Context, storage store.Storage, interval time.Duration) {
+	if interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := g.Sync(ctx, storage); err != nil {
+				logger.Logger().Error("failed to sync cardinality guard", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Metrics returns the guard statistics as gauge metrics, it is meant to be registered as a self-metrics source.
+func (g *Guard) Metrics() []*store.Metric {
+	g.mu.Lock()
+	series := len(g.series)
+	g.mu.Unlock()
+
+	return []*store.Metric{
+		selfmetrics.Gauge("CardinalitySeries", float64(series)),
+		selfmetrics.Gauge("CardinalityRejectedSeries", float64(g.rejectedSeries.Load())),
+		selfmetrics.Gauge("CardinalityInvalidNames", float64(g.invalidNames.Load())),
+	}
+}
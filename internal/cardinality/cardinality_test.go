@@ -0,0 +1,156 @@
+package cardinality
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/andreevym/metric-collector/internal/storage/mem"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/tenant"
+	"github.com/stretchr/testify/require"
+)
+
+func gauge(id string) *store.Metric {
+	value := 1.0
+	return &store.Metric{ID: id, MType: store.MTypeGauge, Value: &value}
+}
+
+func TestValidateName(t *testing.T) {
+	for _, valid := range []string{"Alloc", "cpu_0", "disk.sda:read-bytes", "123"} {
+		require.NoError(t, ValidateName(valid, 50), valid)
+	}
+	for _, invalid := range []string{"", "team/Alloc", "heap alloc", "Алгоритм", strings.Repeat("a", 51)} {
+		require.ErrorIs(t, ValidateName(invalid, 50), ErrInvalidName, invalid)
+	}
+	require.NoError(t, ValidateName(strings.Repeat("a", 51), 0))
+}
+
+func TestParsePrefixLimits(t *testing.T) {
+	limits, err := ParsePrefixLimits("cpu_=64, disk.=32")
+	require.NoError(t, err)
+	require.Equal(t, []PrefixLimit{{Prefix: "cpu_", Limit: 64}, {Prefix: "disk.", Limit: 32}}, limits)
+
+	for _, invalid := range []string{"cpu_", "=1", "cpu_=x", "cpu_=-1"} {
+		_, err = ParsePrefixLimits(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestGuard_Reject(t *testing.T) {
+	ctx := context.Background()
+	guard := NewGuard(Limits{MaxSeries: 3, Prefixes: []PrefixLimit{{Prefix: "cpu_", Limit: 1}}})
+
+	accepted, err := guard.Admit(ctx, []*store.Metric{gauge("Alloc"), gauge("cpu_0")})
+	require.NoError(t, err)
+	require.Len(t, accepted, 2)
+
+	// известные серии принимаются повторно
+	_, err = guard.Admit(ctx, []*store.Metric{gauge("cpu_0")})
+	require.NoError(t, err)
+
+	_, err = guard.Admit(ctx, []*store.Metric{gauge("HeapAlloc"), gauge("cpu_1")})
+	require.ErrorIs(t, err, ErrLimitExceeded)
+	// отклонённая пачка не занимает место
+	_, err = guard.Admit(ctx, []*store.Metric{gauge("HeapAlloc")})
+	require.NoError(t, err)
+
+	_, err = guard.Admit(ctx, []*store.Metric{gauge("Frees")})
+	require.ErrorIs(t, err, ErrLimitExceeded)
+
+	_, err = guard.Admit(ctx, []*store.Metric{gauge("Alloc"), gauge("bad name")})
+	require.ErrorIs(t, err, ErrInvalidName)
+
+	metrics := map[string]float64{}
+	for _, m := range guard.Metrics() {
+		metrics[m.ID] = *m.Value
+	}
+	require.Equal(t, map[string]float64{
+		"CardinalitySeries":         3,
+		"CardinalityRejectedSeries": 2,
+		"CardinalityInvalidNames":   1,
+	}, metrics)
+}
+
+func TestGuard_Drop(t *testing.T) {
+	ctx := context.Background()
+	guard := NewGuard(Limits{MaxSeries: 2, Drop: true})
+
+	accepted, err := guard.Admit(ctx, []*store.Metric{gauge("Alloc"), gauge("HeapAlloc"), gauge("Frees")})
+	require.NoError(t, err)
+	require.Len(t, accepted, 2)
+	require.Equal(t, "Alloc", accepted[0].ID)
+	require.Equal(t, "HeapAlloc", accepted[1].ID)
+}
+
+func TestGuard_Sync(t *testing.T) {
+	ctx := context.Background()
+	storage := mem.NewStorage(nil)
+	tenantStorage := tenant.NewStorage(storage)
+	tenantCtx := tenant.WithTenant(ctx, "team-a")
+	require.NoError(t, tenantStorage.Create(tenantCtx, gauge("cpu_0")))
+	require.NoError(t, storage.Create(ctx, gauge("Alloc")))
+
+	guard := NewGuard(Limits{MaxSeries: 3, Prefixes: []PrefixLimit{{Prefix: "cpu_", Limit: 1}}})
+	require.NoError(t, guard.Sync(ctx, storage))
+
+	// сохранённые метрики уже учтены, в том числе метрики арендаторов
+	_, err := guard.Admit(tenantCtx, []*store.Metric{gauge("cpu_0")})
+	require.NoError(t, err)
+	_, err = guard.Admit(tenantCtx, []*store.Metric{gauge("cpu_1")})
+	require.ErrorIs(t, err, ErrLimitExceeded)
+	_, err = guard.Admit(ctx, []*store.Metric{gauge("Alloc"), gauge("HeapAlloc")})
+	require.NoError(t, err)
+	_, err = guard.Admit(ctx, []*store.Metric{gauge("Frees")})
+	require.ErrorIs(t, err, ErrLimitExceeded)
+
+	// удалённая метрика освобождает место после сверки
+	require.NoError(t, storage.Delete(ctx, "Alloc", store.MTypeGauge))
+	require.NoError(t, guard.Sync(ctx, storage))
+	_, err = guard.Admit(ctx, []*store.Metric{gauge("Frees")})
+	require.NoError(t, err)
+}
+
+// admittingStorage admits a series while the storage is listed, like a write racing with the sync.
+type admittingStorage struct {
+	store.Storage
+	guard *Guard
+	id    string
+}
+
+func (s admittingStorage) List(ctx context.Context) ([]*store.Metric, error) {
+	if _, err := s.guard.Admit(ctx, []*store.Metric{gauge(s.id)}); err != nil {
+		return nil, err
+	}
+	return s.Storage.List(ctx)
+}
+
+func TestGuard_SyncKeepsAdmittedSeries(t *testing.T) {
+	ctx := context.Background()
+	storage := mem.NewStorage(nil)
+	tenantCtx := tenant.WithTenant(ctx, "team-a")
+	guard := NewGuard(Limits{MaxSeries: 3, Prefixes: []PrefixLimit{{Prefix: "cpu_", Limit: 1}}})
+	require.NoError(t, guard.Sync(ctx, storage))
+
+	// допущенные серии ещё не сохранены, например лежат в буфере записи
+	_, err := guard.Admit(tenantCtx, []*store.Metric{gauge("cpu_0")})
+	require.NoError(t, err)
+	_, err = guard.Admit(ctx, []*store.Metric{gauge("Alloc")})
+	require.NoError(t, err)
+
+	require.NoError(t, guard.Sync(ctx, admittingStorage{Storage: storage, guard: guard, id: "HeapAlloc"}))
+	_, err = guard.Admit(tenantCtx, []*store.Metric{gauge("cpu_1")})
+	require.ErrorIs(t, err, ErrLimitExceeded, "prefix limit")
+	_, err = guard.Admit(ctx, []*store.Metric{gauge("Frees")})
+	require.ErrorIs(t, err, ErrLimitExceeded, "series limit")
+
+	// серии, так и не попавшие в хранилище, забываются следующей сверкой,
+	// кроме допущенной во время предыдущей
+	require.NoError(t, guard.Sync(ctx, storage))
+	_, err = guard.Admit(tenantCtx, []*store.Metric{gauge("cpu_1")})
+	require.NoError(t, err)
+	_, err = guard.Admit(ctx, []*store.Metric{gauge("Frees")})
+	require.NoError(t, err)
+	_, err = guard.Admit(ctx, []*store.Metric{gauge("Sys")})
+	require.ErrorIs(t, err, ErrLimitExceeded)
+}
@@ -2,6 +2,7 @@ package config
 
 import (
 	"encoding/json"
+	"errors"
 	"flag"
 	"fmt"
 	"os"
@@ -20,11 +21,44 @@ type AgentConfig struct {
 	PollInterval int `env:"POLL_INTERVAL" json:"poll_interval"`
 	// LogLevel уровень логирования агента
 	LogLevel string `env:"LOG_LEVEL" json:"log_level"`
-	// SecretKey секретный ключ, если указан, то будем добавлять заголовок HashSHA256 в каждый запрос
+	// SecretKey секретный ключ, если указан, то каждый запрос подписывается HMAC-SHA256 в заголовке HashSHA256
 	SecretKey string `env:"KEY" json:"key"`
 	RateLimit int    `env:"RATE_LIMIT" json:"rate_limit"`
-	// CryptoKey путь до файла с публичным ключом.
+	// CryptoKey путь до файла (или содержимое) с сертификатом или публичным ключом сервера в формате PEM,
+	// если указан, то тело каждого запроса шифруется
 	CryptoKey string `env:"CRYPTO_KEY" json:"crypto_key"`
+	// TenantKey API ключ арендатора, если указан, то передаётся в каждом запросе к серверу
+	TenantKey string `env:"TENANT_KEY" json:"tenant_key"`
+	// TLSCA путь до файла с сертификатом удостоверяющего центра сервера,
+	// если указан он или TLSCert, то агент подключается к серверу по TLS
+	TLSCA string `env:"TLS_CA" json:"tls_ca"`
+	// TLSCert путь до файла с сертификатом агента для mTLS
+	TLSCert string `env:"TLS_CERT" json:"tls_cert"`
+	// TLSKey путь до файла с приватным ключом сертификата агента
+	TLSKey string `env:"TLS_KEY" json:"tls_key"`
+	// SpoolDir каталог очереди пакетов, не отправленных из-за недоступности сервера,
+	// если указан, то пакеты отправляются после восстановления сервера, в том числе после перезапуска агента
+	SpoolDir string `env:"SPOOL_DIR" json:"spool_dir"`
+	// SpoolMaxBatches количество пакетов в очереди, при переполнении старые пакеты объединяются
+	SpoolMaxBatches int `env:"SPOOL_MAX_BATCHES" json:"spool_max_batches"`
+	// Collectors включённые сборщики метрик через запятую, например "runtime,memory",
+	// пустое значение включает все сборщики, имя с '-' отключает сборщик, например "-cpu"
+	Collectors string `env:"COLLECTORS" json:"collectors"`
+	// CollectorIntervals интервалы опроса сборщиков в секундах в формате сборщик=секунды через запятую,
+	// например "cpu=5,memory=30", по умолчанию сборщик опрашивается с интервалом PollInterval
+	CollectorIntervals string `env:"COLLECTOR_INTERVALS" json:"collector_intervals"`
+	// CollectorTimeouts время на опрос сборщиков в секундах в формате сборщик=секунды через запятую,
+	// по умолчанию равно интервалу опроса сборщика
+	CollectorTimeouts string `env:"COLLECTOR_TIMEOUTS" json:"collector_timeouts"`
+	// LiveTime время работы агента в секундах, 0 — агент работает до получения сигнала остановки
+	LiveTime int `env:"LIVE_TIME" json:"live_time"`
+	// ShutdownTimeout время в секундах на отправку собранных метрик при остановке агента
+	ShutdownTimeout int `env:"SHUTDOWN_TIMEOUT" json:"shutdown_timeout"`
+
+	// configPath путь до конфиг файла из флага, перечитывается при Reload
+	configPath string
+	// flagValues значения флагов, поверх которых Reload применяет конфиг файл и переменные окружения
+	flagValues *AgentConfig
 }
 
 func NewAgentConfig() *AgentConfig {
@@ -49,16 +83,60 @@ func (c *AgentConfig) Init() (*AgentConfig, error) {
 	flag.StringVar(&c.Address, "a", "localhost:8080", "адрес и порт для запуска сервера")
 	flag.BoolVar(&c.IsGrpcRequest, "g", false, "если true отправляем запросы через grpc client, если false через http")
 	flag.StringVar(&c.SecretKey, "k", "", "secret key, if variable is not empty will "+
-		"make hash from request body and add header HashSHA256 for each http request")
+		"sign each request with HMAC-SHA256 and add header HashSHA256")
 	flag.IntVar(&c.ReportInterval, "r", 10, "report interval (seconds)")
 	flag.IntVar(&c.PollInterval, "p", 2, "poll interval (seconds)")
 	flag.StringVar(&c.LogLevel, "l", "info", "log level")
 	flag.IntVar(&c.RateLimit, "i", 1, "количество одновременно исходящих запросов на сервер")
-	flag.StringVar(&c.CryptoKey, "crypto-key", "", "путь до файла с публичным ключом")
-	var configPath string
-	flag.StringVar(&configPath, "config", "", "путь до конфиг файла, пример './config/agent.json'")
+	flag.StringVar(&c.CryptoKey, "crypto-key", "", "путь до файла с сертификатом или публичным ключом сервера "+
+		"для шифрования запросов")
+	flag.StringVar(&c.TenantKey, "tenant-key", "", "API ключ арендатора, передаётся в каждом запросе к серверу")
+	flag.StringVar(&c.TLSCA, "tls-ca", "", "путь до файла с сертификатом удостоверяющего центра сервера, "+
+		"включает подключение к серверу по TLS")
+	flag.StringVar(&c.TLSCert, "tls-cert", "", "путь до файла с сертификатом агента для mTLS")
+	flag.StringVar(&c.TLSKey, "tls-key", "", "путь до файла с приватным ключом сертификата агента")
+	flag.StringVar(&c.SpoolDir, "spool-dir", "", "каталог очереди неотправленных пакетов метрик, "+
+		"пустое значение отключает очередь")
+	flag.IntVar(&c.SpoolMaxBatches, "spool-max-batches", 1000, "количество пакетов в очереди, "+
+		"при переполнении старые пакеты объединяются")
+	flag.StringVar(&c.Collectors, "collectors", "", "включённые сборщики метрик через запятую, "+
+		"пустое значение включает все сборщики, имя с '-' отключает сборщик")
+	flag.StringVar(&c.CollectorIntervals, "collector-intervals", "", "интервалы опроса сборщиков "+
+		"в формате сборщик=секунды через запятую")
+	flag.StringVar(&c.CollectorTimeouts, "collector-timeouts", "", "время на опрос сборщиков "+
+		"в формате сборщик=секунды через запятую")
+	flag.IntVar(&c.LiveTime, "live-time", 0, "время работы агента в секундах, 0 — без ограничения")
+	flag.IntVar(&c.ShutdownTimeout, "shutdown-timeout", 10, "время в секундах на отправку собранных метрик "+
+		"при остановке агента")
+	flag.StringVar(&c.configPath, "config", "", "путь до конфиг файла, пример './config/agent.json'")
 	flag.Parse()
 
+	flagValues := *c
+	c.flagValues = &flagValues
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// Reload returns the config with the config file and the environment variables read again,
+// the flags keep the values given on start.
+func (c *AgentConfig) Reload() (*AgentConfig, error) {
+	if c.flagValues == nil {
+		return nil, errors.New("config is not initialized")
+	}
+	reloaded := *c.flagValues
+	reloaded.flagValues = c.flagValues
+	if err := reloaded.load(); err != nil {
+		return nil, err
+	}
+	return &reloaded, nil
+}
+
+// load applies the config file and the environment variables on top of the current values.
+func (c *AgentConfig) load() error {
+	configPath := c.configPath
 	if config := os.Getenv("CONFIG"); config != "" {
 		configPath = config
 	}
@@ -66,13 +144,12 @@ func (c *AgentConfig) Init() (*AgentConfig, error) {
 	if configPath != "" {
 		err := c.GetConfigFromFile(configPath)
 		if err != nil {
-			return nil, fmt.Errorf("failed to read config file '%s': %w", configPath, err)
+			return fmt.Errorf("failed to read config file '%s': %w", configPath, err)
 		}
 	}
 
 	if err := env.Parse(c); err != nil {
-		return nil, fmt.Errorf("failed to parse config: %w", err)
+		return fmt.Errorf("failed to parse config: %w", err)
 	}
-
-	return c, nil
+	return nil
 }
@@ -1,6 +1,8 @@
 package config
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -19,3 +21,26 @@ func TestAgentGetConfigFromFileSuccess(t *testing.T) {
 	require.Equal(t, c.RateLimit, 0)
 	require.Equal(t, c.CryptoKey, "/path/to/key.pem")
 }
+
+func TestAgentConfig_Reload(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "agent.json")
+	require.NoError(t, os.WriteFile(configPath, []byte(`{"report_interval": 5}`), 0o600))
+	c := &AgentConfig{Address: "localhost:8080", ReportInterval: 10, configPath: configPath}
+	flagValues := *c
+	c.flagValues = &flagValues
+	require.NoError(t, c.load())
+	require.Equal(t, 5, c.ReportInterval)
+
+	_, err := NewAgentConfig().Reload()
+	require.Error(t, err)
+
+	// значение, удалённое из конфиг файла, возвращается к значению флага
+	require.NoError(t, os.WriteFile(configPath, []byte(`{"address": "collector:8080"}`), 0o600))
+	t.Setenv("POLL_INTERVAL", "3")
+	reloaded, err := c.Reload()
+	require.NoError(t, err)
+	require.Equal(t, "collector:8080", reloaded.Address)
+	require.Equal(t, 10, reloaded.ReportInterval)
+	require.Equal(t, 3, reloaded.PollInterval)
+	require.Equal(t, "localhost:8080", c.Address, "current config is not changed")
+}
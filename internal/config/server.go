@@ -27,15 +27,126 @@ type ServerConfig struct {
 	// Restore определяем загружать или не загружать ранее сохранённые значения из указанного
 	// файла при старте сервера.
 	Restore bool `env:"RESTORE" json:"restore"`
+	// BoltPath путь до файла встроенного key-value хранилища bbolt,
+	// если указан и DatabaseDsn пустой, то метрики хранятся в нём.
+	BoltPath string `env:"BOLT_PATH" json:"bolt_path"`
 	// DatabaseDsn строка с адресом подключения к БД должна получаться из переменной окружения DATABASE_DSN
 	DatabaseDsn string `env:"DATABASE_DSN" json:"database_dsn"`
-	// SecretKey секретный ключ, если переменная не пустая "+
-	// тогда добавляем в заголовок каждого запроса hash от request body под ключом HashSHA256
+	// DatabaseReadDsn строка подключения к реплике БД только для чтения,
+	// если указана, то запросы чтения метрик выполняются на реплике
+	DatabaseReadDsn string `env:"DATABASE_READ_DSN" json:"database_read_dsn"`
+	// DatabaseMaxOpenConns максимальное количество открытых соединений с БД, 0 — без ограничений
+	DatabaseMaxOpenConns int `env:"DATABASE_MAX_OPEN_CONNS" json:"database_max_open_conns"`
+	// DatabaseMaxIdleConns максимальное количество простаивающих соединений с БД, 0 — по умолчанию database/sql
+	DatabaseMaxIdleConns int `env:"DATABASE_MAX_IDLE_CONNS" json:"database_max_idle_conns"`
+	// DatabaseConnMaxLifetime максимальное время жизни соединения с БД в секундах, 0 — без ограничений
+	DatabaseConnMaxLifetime int `env:"DATABASE_CONN_MAX_LIFETIME" json:"database_conn_max_lifetime"`
+	// DatabaseConnMaxIdleTime максимальное время простоя соединения с БД в секундах, 0 — без ограничений
+	DatabaseConnMaxIdleTime int `env:"DATABASE_CONN_MAX_IDLE_TIME" json:"database_conn_max_idle_time"`
+	// DatabaseStatementTimeout ограничение времени выполнения запроса к БД в секундах, 0 — без ограничений
+	DatabaseStatementTimeout int `env:"DATABASE_STATEMENT_TIMEOUT" json:"database_statement_timeout"`
+	// CacheSize максимальное количество метрик в кеше чтения перед БД, значение 0 отключает кеш
+	CacheSize int `env:"CACHE_SIZE" json:"cache_size"`
+	// CacheTTL время жизни метрики в кеше чтения в секундах, значение 0 — без ограничений
+	CacheTTL int `env:"CACHE_TTL" json:"cache_ttl"`
+	// IngestFlushInterval окно в миллисекундах, за которое пакетные обновления метрик накапливаются в буфере
+	// перед записью в хранилище, значение 0 отключает буфер и делает запись синхронной.
+	IngestFlushInterval int `env:"INGEST_FLUSH_INTERVAL" json:"ingest_flush_interval"`
+	// IngestBufferSize количество различных метрик в буфере, при достижении которого он сбрасывается досрочно
+	IngestBufferSize int `env:"INGEST_BUFFER_SIZE" json:"ingest_buffer_size"`
+	// IngestMaxPending максимальное количество несохранённых метрик в буфере, пока хранилище недоступно,
+	// запись новых метрик сверх него отклоняется с кодом 503, значение 0 — без ограничений
+	IngestMaxPending int `env:"INGEST_MAX_PENDING" json:"ingest_max_pending"`
+	// SelfMetricsInterval интервал в секундах, с которым сервер сохраняет собственные метрики,
+	// значение 0 отключает публикацию собственных метрик.
+	SelfMetricsInterval int `env:"SELF_METRICS_INTERVAL" json:"self_metrics_interval"`
+	// Retention срок хранения в секундах метрик, которые не обновлялись,
+	// значение 0 — без ограничений.
+	Retention int `env:"RETENTION" json:"retention"`
+	// RetentionRules сроки хранения для отдельных метрик через запятую в формате шаблон=длительность,
+	// например "cpu_*=1h,Custom*=720h", первое совпавшее правило имеет приоритет над Retention.
+	// Шаблон сравнивается с именем метрики без пространства имён арендатора и с ключом хранения,
+	// поэтому "cpu_*=1h" действует для всех арендаторов, а "team-a/*=24h" — только для арендатора team-a.
+	RetentionRules string `env:"RETENTION_RULES" json:"retention_rules"`
+	// RetentionInterval интервал в секундах, с которым удаляются устаревшие метрики
+	RetentionInterval int `env:"RETENTION_INTERVAL" json:"retention_interval"`
+	// MetricNameMaxLength максимальная длина имени метрики в байтах, значение 0 — без ограничений
+	MetricNameMaxLength int `env:"METRIC_NAME_MAX_LENGTH" json:"metric_name_max_length"`
+	// MaxSeries максимальное количество различных метрик в хранилище, значение 0 — без ограничений
+	MaxSeries int `env:"MAX_SERIES" json:"max_series"`
+	// SeriesPrefixLimits ограничения количества метрик с общим префиксом имени через запятую
+	// в формате префикс=количество, например "cpu_=64,disk.=32".
+	SeriesPrefixLimits string `env:"SERIES_PREFIX_LIMITS" json:"series_prefix_limits"`
+	// CardinalityDrop если true, то метрики сверх ограничений отбрасываются, а остальные метрики пачки сохраняются,
+	// если false, то пачка отклоняется целиком.
+	CardinalityDrop bool `env:"CARDINALITY_DROP" json:"cardinality_drop"`
+	// ClientRateLimit допустимое количество запросов на запись метрик в секунду от одного клиента,
+	// клиент определяется по арендатору, сертификату или IP адресу, значение 0 отключает ограничение.
+	ClientRateLimit float64 `env:"CLIENT_RATE_LIMIT" json:"client_rate_limit"`
+	// ClientRateBurst количество запросов, которое клиент может отправить разом сверх ClientRateLimit
+	ClientRateBurst int `env:"CLIENT_RATE_BURST" json:"client_rate_burst"`
+	// ClientSeriesQuota максимальное количество различных метрик от одного клиента, значение 0 — без ограничений
+	ClientSeriesQuota int `env:"CLIENT_SERIES_QUOTA" json:"client_series_quota"`
+	// ClientSeriesWindow время в секундах, после которого метрика, не присылаемая клиентом, перестаёт учитываться в квоте
+	ClientSeriesWindow int `env:"CLIENT_SERIES_WINDOW" json:"client_series_window"`
+	// TenantKeys API ключи арендаторов через запятую в формате арендатор=ключ, например "team-a=secret1,team-b=secret2",
+	// если указаны, то каждый запрос должен содержать ключ арендатора, а метрики арендаторов хранятся раздельно.
+	TenantKeys string `env:"TENANT_KEYS" json:"tenant_keys"`
+	// RBACBindings роли клиентов через запятую в формате учётные_данные=роль+роль, например
+	// "tenant:team-a=ingest+read,cert:ops=admin,*=read", где учётные данные — арендатор по API ключу,
+	// субъект клиентского сертификата или * для всех клиентов, а роли — ingest, read и admin.
+	// Если указаны, то каждый маршрут и RPC доступны только клиентам с нужной ролью.
+	RBACBindings string `env:"RBAC_BINDINGS" json:"rbac_bindings"`
+	// OIDCJWKS путь до файла или URL с JWKS провайдера OIDC, если указан, то запросы на чтение метрик
+	// принимаются с bearer токеном пользователя в заголовке Authorization наравне с API ключом арендатора
+	OIDCJWKS string `env:"OIDC_JWKS" json:"oidc_jwks"`
+	// OIDCIssuer ожидаемое значение утверждения iss токена, пустое значение отключает проверку
+	OIDCIssuer string `env:"OIDC_ISSUER" json:"oidc_issuer"`
+	// OIDCAudience ожидаемое значение утверждения aud токена, пустое значение отключает проверку
+	OIDCAudience string `env:"OIDC_AUDIENCE" json:"oidc_audience"`
+	// OIDCTenantClaim утверждение токена с именем арендатора, вложенные утверждения указываются через точку
+	OIDCTenantClaim string `env:"OIDC_TENANT_CLAIM" json:"oidc_tenant_claim"`
+	// OIDCRolesClaim утверждение токена с ролями, например "realm_access.roles",
+	// токен без этого утверждения даёт только роль read
+	OIDCRolesClaim string `env:"OIDC_ROLES_CLAIM" json:"oidc_roles_claim"`
+	// OIDCJWKSCacheTTL время в секундах, в течение которого ключи JWKS не перечитываются
+	OIDCJWKSCacheTTL int `env:"OIDC_JWKS_CACHE_TTL" json:"oidc_jwks_cache_ttl"`
+	// AuditFile путь до файла журнала аудита в формате JSON lines, в журнал записываются изменения метрик
+	// и вызовы административных маршрутов, пустое значение отключает запись в файл
+	AuditFile string `env:"AUDIT_FILE" json:"audit_file"`
+	// AuditFileMaxSize размер файла журнала аудита в мегабайтах, после которого файл ротируется
+	AuditFileMaxSize int `env:"AUDIT_FILE_MAX_SIZE" json:"audit_file_max_size"`
+	// AuditFileMaxBackups количество хранимых ротированных файлов журнала аудита
+	AuditFileMaxBackups int `env:"AUDIT_FILE_MAX_BACKUPS" json:"audit_file_max_backups"`
+	// AuditDatabase записывать журнал аудита в таблицу audit базы данных DatabaseDsn вместо файла
+	AuditDatabase bool `env:"AUDIT_DATABASE" json:"audit_database"`
+	// SecretKey секретный ключ, если переменная не пустая,
+	// то сервер проверяет HMAC-SHA256 подпись запросов и подписывает ответы в заголовке HashSHA256
 	SecretKey string `env:"KEY" json:"key"`
-	// CryptoKey путь до файла с публичным ключом.
+	// SecretKeys дополнительные активные секретные ключи через запятую, подписи ими тоже принимаются,
+	// что позволяет перевести агентов на новый ключ без простоя
+	SecretKeys string `env:"SECRET_KEYS" json:"secret_keys"`
+	// SignatureMaxSkew допустимое расхождение в секундах времени подписи запроса со временем сервера
+	SignatureMaxSkew int `env:"SIGNATURE_MAX_SKEW" json:"signature_max_skew"`
+	// RequireSignature отклонять запросы без подписи, если задан секретный ключ
+	RequireSignature bool `env:"REQUIRE_SIGNATURE" json:"require_signature"`
+	// CryptoKey путь до файла (или содержимое) с приватными ключами в формате PEM для расшифровки запросов агента,
+	// файл может содержать несколько ключей, чтобы агенты переходили на новый ключ без потери метрик
 	CryptoKey string `env:"CRYPTO_KEY" json:"crypto_key"`
-	// TrustedSubnet строковое представление бесклассовой адресации (CIDR)
+	// TrustedSubnet доверенные подсети IPv4 и IPv6 в бесклассовой адресации (CIDR) через запятую,
+	// например "192.168.1.0/24,fd00::/8", запросы с других адресов отклоняются
 	TrustedSubnet string `env:"TRUSTED_SUBNET" json:"trusted_subnet"`
+	// TrustedProxies адреса или подсети прокси через запятую, только для запросов от них
+	// адрес клиента берётся из заголовка X-Real-IP, иначе используется адрес соединения.
+	// Адрес клиента проверяется доверенными подсетями, учитывается лимитами и журналом аудита
+	TrustedProxies string `env:"TRUSTED_PROXIES" json:"trusted_proxies"`
+	// TLSCert путь до файла с сертификатом сервера в формате PEM, вместе с TLSKey включает HTTPS и TLS для gRPC
+	TLSCert string `env:"TLS_CERT" json:"tls_cert"`
+	// TLSKey путь до файла с приватным ключом сертификата сервера в формате PEM
+	TLSKey string `env:"TLS_KEY" json:"tls_key"`
+	// TLSClientCA путь до файла с сертификатом удостоверяющего центра клиентов,
+	// если указан, то клиенты обязаны предъявить подписанный им сертификат (mTLS)
+	TLSClientCA string `env:"TLS_CLIENT_CA" json:"tls_client_ca"`
 }
 
 func NewServerConfig() *ServerConfig {
@@ -68,10 +179,83 @@ func (c *ServerConfig) Init() (*ServerConfig, error) {
 	flag.BoolVar(&c.Restore, "r", true, "определяющее, загружать или нет ранее сохранённые значения"+
 		" из указанного файла при старте сервера")
 	flag.StringVar(&c.DatabaseDsn, "d", "", "строка с адресом подключения к БД")
+	flag.StringVar(&c.BoltPath, "bolt-path", "", "путь до файла встроенного key-value хранилища bbolt, "+
+		"используется, если не задана строка подключения к БД")
+	flag.StringVar(&c.DatabaseReadDsn, "database-read-dsn", "", "строка с адресом подключения к реплике БД только для чтения")
+	flag.IntVar(&c.DatabaseMaxOpenConns, "db-max-open-conns", 25, "максимальное количество открытых соединений с БД")
+	flag.IntVar(&c.DatabaseMaxIdleConns, "db-max-idle-conns", 5, "максимальное количество простаивающих соединений с БД")
+	flag.IntVar(&c.DatabaseConnMaxLifetime, "db-conn-max-lifetime", 300, "максимальное время жизни "+
+		"соединения с БД в секундах")
+	flag.IntVar(&c.DatabaseConnMaxIdleTime, "db-conn-max-idle-time", 60, "максимальное время простоя "+
+		"соединения с БД в секундах")
+	flag.IntVar(&c.DatabaseStatementTimeout, "db-statement-timeout", 5, "ограничение времени выполнения "+
+		"запроса к БД в секундах")
+	flag.IntVar(&c.CacheSize, "cache-size", 0, "максимальное количество метрик в кеше чтения перед БД "+
+		"(значение 0 отключает кеш)")
+	flag.IntVar(&c.CacheTTL, "cache-ttl", 60, "время жизни метрики в кеше чтения в секундах")
+	flag.IntVar(&c.IngestFlushInterval, "ingest-flush-interval", 0, "окно в миллисекундах, за которое "+
+		"пакетные обновления метрик накапливаются в буфере (значение 0 делает запись синхронной)")
+	flag.IntVar(&c.IngestBufferSize, "ingest-buffer-size", 10000, "количество различных метрик в буфере, "+
+		"при достижении которого он сбрасывается досрочно")
+	flag.IntVar(&c.IngestMaxPending, "ingest-max-pending", 100000, "максимальное количество несохранённых "+
+		"метрик в буфере, запись новых метрик сверх него отклоняется (значение 0 — без ограничений)")
+	flag.IntVar(&c.SelfMetricsInterval, "self-metrics-interval", 10, "интервал в секундах, с которым сервер "+
+		"сохраняет собственные метрики (значение 0 отключает публикацию).")
+	flag.IntVar(&c.Retention, "retention", 0, "срок хранения в секундах метрик, которые не обновлялись "+
+		"(значение 0 — без ограничений)")
+	flag.StringVar(&c.RetentionRules, "retention-rules", "", "сроки хранения для отдельных метрик "+
+		"в формате шаблон=длительность через запятую, например 'cpu_*=1h,Custom*=720h'")
+	flag.IntVar(&c.RetentionInterval, "retention-interval", 60, "интервал в секундах, "+
+		"с которым удаляются устаревшие метрики")
+	flag.IntVar(&c.MetricNameMaxLength, "metric-name-max-length", 255, "максимальная длина имени метрики в байтах")
+	flag.IntVar(&c.MaxSeries, "max-series", 0, "максимальное количество различных метрик в хранилище "+
+		"(значение 0 — без ограничений)")
+	flag.StringVar(&c.SeriesPrefixLimits, "series-prefix-limits", "", "ограничения количества метрик "+
+		"с общим префиксом имени в формате префикс=количество через запятую, например 'cpu_=64,disk.=32'")
+	flag.BoolVar(&c.CardinalityDrop, "cardinality-drop", false, "отбрасывать метрики сверх ограничений "+
+		"и сохранять остальные метрики пачки вместо отклонения пачки целиком")
+	flag.Float64Var(&c.ClientRateLimit, "client-rate-limit", 0, "допустимое количество запросов на запись метрик "+
+		"в секунду от одного клиента (значение 0 отключает ограничение)")
+	flag.IntVar(&c.ClientRateBurst, "client-rate-burst", 10, "количество запросов, которое клиент может отправить разом")
+	flag.IntVar(&c.ClientSeriesQuota, "client-series-quota", 0, "максимальное количество различных метрик "+
+		"от одного клиента (значение 0 — без ограничений)")
+	flag.IntVar(&c.ClientSeriesWindow, "client-series-window", 3600, "время в секундах, после которого метрика, "+
+		"не присылаемая клиентом, перестаёт учитываться в квоте")
+	flag.StringVar(&c.TenantKeys, "tenant-keys", "", "API ключи арендаторов в формате арендатор=ключ через запятую, "+
+		"пустое значение отключает разделение метрик по арендаторам")
+	flag.StringVar(&c.RBACBindings, "rbac-bindings", "", "роли клиентов в формате учётные_данные=роль+роль через запятую, "+
+		"например tenant:team-a=ingest+read,cert:ops=admin,*=read, пустое значение отключает проверку ролей")
+	flag.StringVar(&c.OIDCJWKS, "oidc-jwks", "", "путь до файла или URL с JWKS провайдера OIDC, "+
+		"пустое значение отключает bearer токены")
+	flag.StringVar(&c.OIDCIssuer, "oidc-issuer", "", "ожидаемый издатель (iss) bearer токенов")
+	flag.StringVar(&c.OIDCAudience, "oidc-audience", "", "ожидаемая аудитория (aud) bearer токенов")
+	flag.StringVar(&c.OIDCTenantClaim, "oidc-tenant-claim", "tenant", "утверждение токена с именем арендатора")
+	flag.StringVar(&c.OIDCRolesClaim, "oidc-roles-claim", "roles", "утверждение токена с ролями")
+	flag.IntVar(&c.OIDCJWKSCacheTTL, "oidc-jwks-cache-ttl", 300, "время в секундах, "+
+		"в течение которого ключи JWKS не перечитываются")
+	flag.StringVar(&c.AuditFile, "audit-file", "", "путь до файла журнала аудита, "+
+		"пустое значение отключает запись журнала в файл")
+	flag.IntVar(&c.AuditFileMaxSize, "audit-file-max-size", 100, "размер файла журнала аудита в мегабайтах, "+
+		"после которого файл ротируется")
+	flag.IntVar(&c.AuditFileMaxBackups, "audit-file-max-backups", 5, "количество хранимых ротированных "+
+		"файлов журнала аудита")
+	flag.BoolVar(&c.AuditDatabase, "audit-database", false, "записывать журнал аудита в таблицу audit базы данных")
 	flag.StringVar(&c.SecretKey, "k", "", "секретный ключ, если переменная не пустая "+
 		"тогда добавляем в заголовок каждого запроса hash от request body под ключом HashSHA256")
-	flag.StringVar(&c.CryptoKey, "crypto-key", "", "путь до файла с публичным ключом")
-	flag.StringVar(&c.TrustedSubnet, "t", "", "строковое представление бесклассовой адресации (CIDR)")
+	flag.StringVar(&c.SecretKeys, "secret-keys", "", "дополнительные активные секретные ключи через запятую "+
+		"для ротации ключей без простоя")
+	flag.IntVar(&c.SignatureMaxSkew, "signature-max-skew", 300, "допустимое расхождение в секундах "+
+		"времени подписи запроса со временем сервера")
+	flag.BoolVar(&c.RequireSignature, "require-signature", false, "отклонять запросы без подписи, "+
+		"если задан секретный ключ")
+	flag.StringVar(&c.CryptoKey, "crypto-key", "", "путь до файла с приватными ключами для расшифровки запросов агента")
+	flag.StringVar(&c.TrustedSubnet, "t", "", "доверенные подсети в бесклассовой адресации (CIDR) через запятую")
+	flag.StringVar(&c.TrustedProxies, "trusted-proxies", "", "адреса или подсети прокси через запятую, "+
+		"которым разрешено передавать адрес клиента в заголовке X-Real-IP")
+	flag.StringVar(&c.TLSCert, "tls-cert", "", "путь до файла с сертификатом сервера, включает HTTPS и TLS для gRPC")
+	flag.StringVar(&c.TLSKey, "tls-key", "", "путь до файла с приватным ключом сертификата сервера")
+	flag.StringVar(&c.TLSClientCA, "tls-client-ca", "", "путь до файла с сертификатом удостоверяющего центра клиентов, "+
+		"если указан, то клиенты обязаны предъявить подписанный им сертификат")
 	var configPath string
 	flag.StringVar(&configPath, "config", "", "путь до конфиг файла, пример './config/server.json'")
 	flag.Parse()
@@ -0,0 +1,54 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/andreevym/metric-collector/internal/audit"
+	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// AuditEvents returns the latest audit events matching the filter, newest first.
+// A tenant sees only events of its own clients.
+func (c Controller) AuditEvents(ctx context.Context, f audit.Filter) ([]audit.Event, error) {
+	if name, ok := tenant.FromContext(ctx); ok {
+		f.Tenant = name
+	}
+	events, err := c.audit.Query(ctx, f)
+	if err != nil {
+		logger.Logger().Error("error querying audit events", zap.Error(err))
+		return nil, err
+	}
+	return events, nil
+}
+
+// RecordAdmin records the call of the admin endpoint target by the client of ctx.
+func (c Controller) RecordAdmin(ctx context.Context, target string) {
+	c.audit.Record(ctx, audit.ActionAdmin, target, nil, nil)
+}
+
+// changesOf returns the changes writing the submitted values of metrics.
+func changesOf(metrics []*store.Metric) []audit.Change {
+	changes := make([]audit.Change, 0, len(metrics))
+	for _, m := range metrics {
+		changes = append(changes, audit.Change{ID: m.ID, MType: m.MType, New: audit.ValueOf(m)})
+	}
+	return changes
+}
+
+// withPrevious sets the old values of changes to the values stored now.
+func (c Controller) withPrevious(ctx context.Context, changes []audit.Change) error {
+	ctx = store.WithConsistentRead(ctx)
+	for i := range changes {
+		previous, err := c.storage.Read(ctx, changes[i].ID, changes[i].MType)
+		if err != nil && !errors.Is(err, store.ErrValueNotFound) {
+			return fmt.Errorf("failed to read metric: %w", err)
+		}
+		changes[i].Old = audit.ValueOf(previous)
+	}
+	return nil
+}
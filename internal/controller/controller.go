@@ -1,12 +1,29 @@
 package controller
 
 import (
+	"github.com/andreevym/metric-collector/internal/audit"
+	"github.com/andreevym/metric-collector/internal/cardinality"
+	"github.com/andreevym/metric-collector/internal/ingest"
+	"github.com/andreevym/metric-collector/internal/ratelimit"
+	"github.com/andreevym/metric-collector/internal/retention"
 	"github.com/andreevym/metric-collector/internal/storage/store"
 )
 
 type Controller struct {
 	storage  store.Storage
 	dbClient store.Client
+	// buffer буфер отложенной записи для пакетных обновлений, nil — запись сразу в хранилище
+	buffer *ingest.Buffer
+	// janitor удаляет устаревшие метрики, nil — срок хранения метрик не ограничен
+	janitor *retention.Janitor
+	// limiter ограничивает частоту запросов на запись от одного клиента, nil — без ограничений
+	limiter *ratelimit.Limiter
+	// quota ограничивает количество различных метрик от одного клиента, nil — без ограничений
+	quota *ratelimit.SeriesQuota
+	// guard проверяет имена метрик и ограничивает количество различных метрик в хранилище, nil — без ограничений
+	guard *cardinality.Guard
+	// audit журнал аудита изменений метрик, nil — изменения не записываются
+	audit *audit.Log
 }
 
 func NewController(storage store.Storage, dbClient store.Client) Controller {
@@ -15,3 +32,38 @@ func NewController(storage store.Storage, dbClient store.Client) Controller {
 		dbClient: dbClient,
 	}
 }
+
+// WithBuffer returns a copy of the controller that coalesces batch updates in buffer
+// instead of writing them to the storage immediately.
+// The buffer must write into the storage not scoped by tenant.Storage, metrics are added to it with tenant IDs.
+func (c Controller) WithBuffer(buffer *ingest.Buffer) Controller {
+	c.buffer = buffer
+	return c
+}
+
+// WithJanitor returns a copy of the controller that previews expired metrics with janitor.
+func (c Controller) WithJanitor(janitor *retention.Janitor) Controller {
+	c.janitor = janitor
+	return c
+}
+
+// WithLimits returns a copy of the controller that rejects updates of clients
+// exceeding the request rate of limiter or the series quota.
+func (c Controller) WithLimits(limiter *ratelimit.Limiter, quota *ratelimit.SeriesQuota) Controller {
+	c.limiter = limiter
+	c.quota = quota
+	return c
+}
+
+// WithCardinality returns a copy of the controller that validates metric names
+// and admits new series according to the limits of guard.
+func (c Controller) WithCardinality(guard *cardinality.Guard) Controller {
+	c.guard = guard
+	return c
+}
+
+// WithAudit returns a copy of the controller that records every write of metrics to log.
+func (c Controller) WithAudit(log *audit.Log) Controller {
+	c.audit = log
+	return c
+}
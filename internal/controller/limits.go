@@ -0,0 +1,31 @@
+package controller
+
+import (
+	"context"
+
+	"github.com/andreevym/metric-collector/internal/identity"
+	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"go.uber.org/zap"
+)
+
+// admit checks the rate limit and the series quota of the client sending metrics
+// and the cardinality limits of the storage. It returns the metrics to save,
+// which may be fewer than metrics if the cardinality guard drops excess series.
+func (c Controller) admit(ctx context.Context, metrics []*store.Metric) ([]*store.Metric, error) {
+	client := identity.FromContext(ctx).Key()
+	if err := c.limiter.Allow(client); err != nil {
+		logger.Logger().Warn("update rejected", zap.String("client", client), zap.Error(err))
+		return nil, err
+	}
+	if err := c.quota.Admit(client, metrics); err != nil {
+		logger.Logger().Warn("update rejected", zap.String("client", client), zap.Error(err))
+		return nil, err
+	}
+	accepted, err := c.guard.Admit(ctx, metrics)
+	if err != nil {
+		logger.Logger().Warn("update rejected", zap.String("client", client), zap.Error(err))
+		return nil, err
+	}
+	return accepted, nil
+}
@@ -0,0 +1,36 @@
+package controller
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/retention"
+	"github.com/andreevym/metric-collector/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// RetentionPreview returns the metrics that would be deleted by the next retention sweep.
+// A tenant sees only its own metrics.
+func (c Controller) RetentionPreview(ctx context.Context) ([]retention.Expired, error) {
+	if c.janitor == nil {
+		return []retention.Expired{}, nil
+	}
+
+	expired, err := c.janitor.Preview(ctx)
+	if err != nil {
+		logger.Logger().Error("error previewing expired metrics", zap.Error(err))
+		return nil, fmt.Errorf("error previewing expired metrics: %w", err)
+	}
+
+	owned := make([]retention.Expired, 0, len(expired))
+	for _, e := range expired {
+		id, ok := tenant.UnqualifyID(ctx, e.ID)
+		if !ok {
+			continue
+		}
+		e.ID = id
+		owned = append(owned, e)
+	}
+	return owned, nil
+}
@@ -4,28 +4,56 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/andreevym/metric-collector/internal/audit"
+	"github.com/andreevym/metric-collector/internal/cardinality"
 	"github.com/andreevym/metric-collector/internal/logger"
 	"github.com/andreevym/metric-collector/internal/storage/store"
 	"go.uber.org/zap"
 )
 
 func (c Controller) Update(ctx context.Context, metric *store.Metric) (*store.Metric, error) {
+	if !c.audit.Enabled() {
+		updated, _, err := c.update(ctx, metric)
+		return updated, err
+	}
+
+	change := changesOf([]*store.Metric{metric})[0]
+	updated, previous, err := c.update(ctx, metric)
+	change.Old = audit.ValueOf(previous)
+	if err == nil {
+		change.New = audit.ValueOf(updated)
+	}
+	c.audit.Record(ctx, audit.ActionUpdate, "", []audit.Change{change}, err)
+	return updated, err
+}
+
+// update saves the metric and returns it with the accumulated delta of a counter
+// together with the value stored before.
+func (c Controller) update(ctx context.Context, metric *store.Metric) (*store.Metric, *store.Metric, error) {
 	if metric.MType != store.MTypeGauge && metric.MType != store.MTypeCounter {
 		logger.Logger().Warn("unknown metric type", zap.String("type", metric.MType))
-		return nil, fmt.Errorf("unknown metric type: %s", metric.MType)
+		return nil, nil, fmt.Errorf("unknown metric type: %s", metric.MType)
+	}
+
+	accepted, err := c.admit(ctx, []*store.Metric{metric})
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to admit metric: %w", err)
+	}
+	if len(accepted) == 0 {
+		return nil, nil, fmt.Errorf("%w: metric %s is dropped", cardinality.ErrLimitExceeded, metric.ID)
 	}
 
-	foundValue, err := c.storage.Read(ctx, metric.ID, metric.MType)
+	foundValue, err := c.storage.Read(store.WithConsistentRead(ctx), metric.ID, metric.MType)
 	if err != nil && !errors.Is(err, store.ErrValueNotFound) {
 		logger.Logger().Error("failed to read metric", zap.Error(err))
-		return nil, fmt.Errorf("failed to read metric: %w", err)
+		return nil, nil, fmt.Errorf("failed to read metric: %w", err)
 	}
 
 	if foundValue == nil {
 		err = c.storage.Create(ctx, metric)
 		if err != nil {
 			logger.Logger().Error("failed create metric", zap.Error(err))
-			return nil, fmt.Errorf("failed create metric: %w", err)
+			return nil, nil, fmt.Errorf("failed create metric: %w", err)
 		}
 	} else {
 		if metric.MType == store.MTypeCounter {
@@ -35,9 +63,9 @@ func (c Controller) Update(ctx context.Context, metric *store.Metric) (*store.Me
 		err = c.storage.Update(ctx, metric)
 		if err != nil {
 			logger.Logger().Error("failed update metric", zap.Error(err))
-			return nil, fmt.Errorf("failed update metric: %w", err)
+			return nil, nil, fmt.Errorf("failed update metric: %w", err)
 		}
 	}
 
-	return metric, nil
+	return metric, foundValue, nil
 }
@@ -3,16 +3,65 @@ package controller
 import (
 	"context"
 	"fmt"
+
+	"github.com/andreevym/metric-collector/internal/audit"
 	"github.com/andreevym/metric-collector/internal/logger"
 	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/tenant"
 	"go.uber.org/zap"
 )
 
-func (c Controller) Updates(ctx context.Context, metrics []*store.Metric) error {
-	err := store.SaveAllMetric(ctx, c.storage, metrics)
+// Updates saves a batch of metrics. With a buffer the batch is only merged into it
+// and becomes visible to reads after the next flush.
+func (c Controller) Updates(ctx context.Context, metrics []*store.Metric) (err error) {
+	var changes []audit.Change
+	if c.audit.Enabled() {
+		changes = changesOf(metrics)
+		defer func() {
+			c.audit.Record(ctx, audit.ActionUpdates, "", changes, err)
+		}()
+	}
+
+	metrics, err = c.admit(ctx, metrics)
+	if err != nil {
+		return fmt.Errorf("failed to admit metrics: %w", err)
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	if changes != nil {
+		// метрики, отброшенные ограничением количества, не изменяются
+		changes = changesOf(metrics)
+		if err = c.withPrevious(ctx, changes); err != nil {
+			logger.Logger().Error("error reading previous values of metrics", zap.Error(err))
+			return fmt.Errorf("error reading previous values of metrics: %w", err)
+		}
+	}
+
+	if c.buffer != nil {
+		// буфер сохраняет метрики без контекста запроса, поэтому пространство имён арендатора добавляется заранее
+		pending, err := c.buffer.Merge(tenant.Qualify(ctx, metrics))
+		if err != nil {
+			logger.Logger().Error("error buffering metrics", zap.Error(err))
+			return fmt.Errorf("error buffering metrics: %w", err)
+		}
+		for i := range changes {
+			// до сброса буфера значение метрики складывается из сохранённого и ещё не сброшенного
+			changes[i].Old = audit.Merge(changes[i].Old, pending[i])
+			changes[i].New = audit.Merge(changes[i].Old, metrics[i])
+		}
+		return nil
+	}
+
+	err = store.SaveAllMetric(ctx, c.storage, metrics)
 	if err != nil {
 		logger.Logger().Error("error updating metrics", zap.Error(err))
 		return fmt.Errorf("error updating metrics: %w", err)
 	}
+	for i := range changes {
+		// SaveAllMetric записывает в метрики сохранённые значения с накопленным счётчиком
+		changes[i].New = audit.ValueOf(metrics[i])
+	}
 	return nil
 }
@@ -15,6 +15,7 @@ import (
 	"time"
 )
 
+// Decode decrypts the base64 encoded envelope produced by Encode with one of the PEM encoded private keys.
 func Decode(private string, message string) (string, error) {
 	if private == "" {
 		return "", errors.New("private key is empty")
@@ -23,11 +24,9 @@ func Decode(private string, message string) (string, error) {
 		return "", errors.New("message is empty")
 	}
 
-	block, _ := pem.Decode([]byte(private))
-
-	privateKey, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+	decrypter, err := NewDecrypter(private)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse private key: %v", err)
+		return "", err
 	}
 
 	decoded, err := base64.StdEncoding.DecodeString(message)
@@ -35,14 +34,16 @@ func Decode(private string, message string) (string, error) {
 		return "", fmt.Errorf("failed to decode message: %w", err)
 	}
 
-	b, err := rsa.DecryptPKCS1v15(rand.Reader, privateKey, decoded)
+	b, err := decrypter.Decrypt(decoded)
 	if err != nil {
-		return "", fmt.Errorf("failed to decrypt message: %w", err)
+		return "", err
 	}
 
 	return string(b), nil
 }
 
+// Encode encrypts the message for the owner of the PEM encoded certificate or public key
+// and returns the base64 encoded envelope.
 func Encode(public string, message string) (string, error) {
 	if public == "" {
 		return "", errors.New("public key is empty")
@@ -51,34 +52,52 @@ func Encode(public string, message string) (string, error) {
 		return "", errors.New("message is empty")
 	}
 
-	block, _ := pem.Decode([]byte(public))
-
-	cert, err := x509.ParseCertificate(block.Bytes)
+	encrypter, err := NewEncrypter(public)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse private key: %v", err)
-	}
-
-	var rsaPublic *rsa.PublicKey
-	switch pub := cert.PublicKey.(type) {
-	case *rsa.PublicKey:
-		rsaPublic = pub
-	default:
-		return "", fmt.Errorf("unsupported public key type: %T", pub)
+		return "", err
 	}
 
-	b, err := rsa.EncryptPKCS1v15(rand.Reader, rsaPublic, []byte(message))
+	b, err := encrypter.Encrypt([]byte(message))
 	if err != nil {
-		return "", fmt.Errorf("failed to encrypt message: %w", err)
+		return "", err
 	}
 
 	return base64.StdEncoding.EncodeToString(b), nil
 }
 
+// GenerateCrypto returns PEM encoded RSA private key and self-signed certificate for 127.0.0.1 and ::1.
 func GenerateCrypto() (string, string, error) {
-	// создаём новый приватный RSA-ключ длиной 4096 бит
+	return GenerateCertificate(CertificateOptions{
+		Hosts: []string{"127.0.0.1", "::1"},
+	})
+}
+
+// CertificateOptions parameters of a certificate created by GenerateCertificate.
+type CertificateOptions struct {
+	// CommonName имя владельца сертификата, по нему сервер определяет клиента при mTLS
+	CommonName string
+	// Hosts IP-адреса и DNS-имена, для которых действителен сертификат
+	Hosts []string
+	// IsCA сертификат удостоверяющего центра, которым подписываются другие сертификаты
+	IsCA bool
+	// ParentCert и ParentKey сертификат и ключ удостоверяющего центра в формате PEM,
+	// если не указаны, то сертификат самоподписанный
+	ParentCert string
+	ParentKey  string
+	// Bits длина RSA-ключа, по умолчанию 4096 бит
+	Bits int
+}
+
+// GenerateCertificate returns PEM encoded RSA private key and certificate created by options.
+func GenerateCertificate(opts CertificateOptions) (string, string, error) {
+	bits := opts.Bits
+	if bits == 0 {
+		bits = 4096
+	}
+	// создаём новый приватный RSA-ключ
 	// обратите внимание, что для генерации ключа и сертификата
 	// используется rand.Reader в качестве источника случайных данных
-	privateKey, err := rsa.GenerateKey(rand.Reader, 4096)
+	privateKey, err := rsa.GenerateKey(rand.Reader, bits)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to generate private key: %s", err)
 	}
@@ -92,30 +111,54 @@ func GenerateCrypto() (string, string, error) {
 		return "", "", fmt.Errorf("failed to encode private key: %w", err)
 	}
 
+	// уникальный номер сертификата, сертификаты одного удостоверяющего центра не должны совпадать
+	serialNumber, err := rand.Int(rand.Reader, new(big.Int).Lsh(big.NewInt(1), 128))
+	if err != nil {
+		return "", "", fmt.Errorf("failed to generate serial number: %w", err)
+	}
+
 	// создаём шаблон сертификата
 	cert := &x509.Certificate{
-		// указываем уникальный номер сертификата
-		SerialNumber: big.NewInt(1658),
+		SerialNumber: serialNumber,
 		// заполняем базовую информацию о владельце сертификата
 		Subject: pkix.Name{
 			Organization: []string{"Yandex.Praktikum"},
 			Country:      []string{"RU"},
+			CommonName:   opts.CommonName,
 		},
-		// разрешаем использование сертификата для 127.0.0.1 и ::1
-		IPAddresses: []net.IP{net.IPv4(127, 0, 0, 1), net.IPv6loopback},
 		// сертификат верен, начиная со времени создания
 		NotBefore: time.Now(),
 		// время жизни сертификата — 10 лет
-		NotAfter:     time.Now().AddDate(10, 0, 0),
-		SubjectKeyId: []byte{1, 2, 3, 4, 6},
+		NotAfter: time.Now().AddDate(10, 0, 0),
 		// устанавливаем использование ключа для цифровой подписи,
 		// а также клиентской и серверной авторизации
 		ExtKeyUsage: []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth, x509.ExtKeyUsageServerAuth},
-		KeyUsage:    x509.KeyUsageDigitalSignature,
+		KeyUsage:    x509.KeyUsageDigitalSignature | x509.KeyUsageKeyEncipherment,
+	}
+	for _, host := range opts.Hosts {
+		if ip := net.ParseIP(host); ip != nil {
+			cert.IPAddresses = append(cert.IPAddresses, ip)
+		} else {
+			cert.DNSNames = append(cert.DNSNames, host)
+		}
+	}
+	if opts.IsCA {
+		cert.IsCA = true
+		cert.BasicConstraintsValid = true
+		cert.KeyUsage |= x509.KeyUsageCertSign
+	}
+
+	// по умолчанию сертификат подписывается собственным ключом
+	parent, parentKey := cert, privateKey
+	if opts.ParentCert != "" {
+		parent, parentKey, err = parseKeyPair(opts.ParentCert, opts.ParentKey)
+		if err != nil {
+			return "", "", fmt.Errorf("failed to parse parent certificate: %w", err)
+		}
 	}
 
 	// создаём сертификат x.509
-	certBytes, err := x509.CreateCertificate(rand.Reader, cert, cert, &privateKey.PublicKey, privateKey)
+	certBytes, err := x509.CreateCertificate(rand.Reader, cert, parent, &privateKey.PublicKey, parentKey)
 	if err != nil {
 		return "", "", fmt.Errorf("failed to create certificate: %s", err)
 	}
@@ -133,3 +176,24 @@ func GenerateCrypto() (string, string, error) {
 
 	return privateKeyPEM.String(), certPEM.String(), nil
 }
+
+func parseKeyPair(certPEM string, keyPEM string) (*x509.Certificate, *rsa.PrivateKey, error) {
+	certBlock, _ := pem.Decode([]byte(certPEM))
+	if certBlock == nil {
+		return nil, nil, errors.New("certificate is not PEM encoded")
+	}
+	cert, err := x509.ParseCertificate(certBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse certificate: %w", err)
+	}
+
+	keyBlock, _ := pem.Decode([]byte(keyPEM))
+	if keyBlock == nil {
+		return nil, nil, errors.New("private key is not PEM encoded")
+	}
+	key, err := x509.ParsePKCS1PrivateKey(keyBlock.Bytes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse private key: %w", err)
+	}
+	return cert, key, nil
+}
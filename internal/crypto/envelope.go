@@ -0,0 +1,291 @@
+package crypto
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// EnvelopeVersion1 version of the envelope format produced by Encrypter:
+//
+//	version (1 byte) | key id (8 bytes) | wrapped key length (2 bytes, big endian) | wrapped key |
+//	nonce (12 bytes) | AES-GCM ciphertext
+//
+// The data key is a random AES-256 key wrapped with RSA-OAEP (SHA-256) by the public key identified by key id,
+// the header before the nonce is authenticated as additional data of AES-GCM.
+const EnvelopeVersion1 byte = 1
+
+const (
+	keyIDSize   = 8
+	dataKeySize = 32
+)
+
+// oaepLabel binds the wrapped data keys to this application.
+var oaepLabel = []byte("metric-collector")
+
+var (
+	// ErrUnsupportedEnvelope the envelope has an unknown version or is truncated.
+	ErrUnsupportedEnvelope = errors.New("unsupported envelope")
+	// ErrUnknownKey the envelope is encrypted with a key that is not active on the server.
+	ErrUnknownKey = errors.New("unknown key")
+)
+
+type keyID [keyIDSize]byte
+
+func (id keyID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+// publicKeyID returns the first bytes of SHA-256 of the DER encoded public key.
+func publicKeyID(pub *rsa.PublicKey) (keyID, error) {
+	var id keyID
+	der, err := x509.MarshalPKIXPublicKey(pub)
+	if err != nil {
+		return id, fmt.Errorf("failed to marshal public key: %w", err)
+	}
+	sum := sha256.Sum256(der)
+	copy(id[:], sum[:keyIDSize])
+	return id, nil
+}
+
+// Encrypter encrypts payloads for the owner of a single public key.
+type Encrypter struct {
+	public *rsa.PublicKey
+	id     keyID
+}
+
+// NewEncrypter creates an Encrypter from a PEM encoded certificate or public key.
+func NewEncrypter(publicPEM string) (*Encrypter, error) {
+	block, _ := pem.Decode([]byte(publicPEM))
+	if block == nil {
+		return nil, errors.New("public key is not PEM encoded")
+	}
+
+	var key any
+	switch block.Type {
+	case "CERTIFICATE":
+		cert, err := x509.ParseCertificate(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse certificate: %w", err)
+		}
+		key = cert.PublicKey
+	case "PUBLIC KEY":
+		pub, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		key = pub
+	case "RSA PUBLIC KEY":
+		pub, err := x509.ParsePKCS1PublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse public key: %w", err)
+		}
+		key = pub
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+
+	public, ok := key.(*rsa.PublicKey)
+	if !ok {
+		return nil, fmt.Errorf("unsupported public key type: %T", key)
+	}
+	id, err := publicKeyID(public)
+	if err != nil {
+		return nil, err
+	}
+	return &Encrypter{public: public, id: id}, nil
+}
+
+// KeyID returns the hex encoded id of the public key written to every envelope.
+func (e *Encrypter) KeyID() string {
+	return e.id.String()
+}
+
+// Encrypt returns the envelope with plaintext encrypted by a new random data key.
+func (e *Encrypter) Encrypt(plaintext []byte) ([]byte, error) {
+	dataKey := make([]byte, dataKeySize)
+	if _, err := rand.Read(dataKey); err != nil {
+		return nil, fmt.Errorf("failed to generate data key: %w", err)
+	}
+	wrappedKey, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, e.public, dataKey, oaepLabel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to wrap data key: %w", err)
+	}
+
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err = rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("failed to generate nonce: %w", err)
+	}
+
+	header := make([]byte, 0, 1+keyIDSize+2+len(wrappedKey))
+	header = append(header, EnvelopeVersion1)
+	header = append(header, e.id[:]...)
+	header = binary.BigEndian.AppendUint16(header, uint16(len(wrappedKey)))
+	header = append(header, wrappedKey...)
+
+	envelope := make([]byte, 0, len(header)+len(nonce)+len(plaintext)+aead.Overhead())
+	envelope = append(envelope, header...)
+	envelope = append(envelope, nonce...)
+	return aead.Seal(envelope, nonce, plaintext, header), nil
+}
+
+// Decrypter decrypts envelopes encrypted for any of its private keys,
+// so that the keys can be rotated without losing payloads of agents that still use the previous key.
+type Decrypter struct {
+	keys map[keyID]*rsa.PrivateKey
+}
+
+// NewDecrypter creates a Decrypter from one or more PEM encoded RSA private keys.
+func NewDecrypter(privatePEM string) (*Decrypter, error) {
+	d := &Decrypter{keys: map[keyID]*rsa.PrivateKey{}}
+	rest := []byte(privatePEM)
+	for {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			break
+		}
+
+		var key any
+		var err error
+		switch block.Type {
+		case "RSA PRIVATE KEY":
+			key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		case "PRIVATE KEY":
+			key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+		default:
+			// сертификаты и другие блоки в файле с ключами пропускаются
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse private key: %w", err)
+		}
+		private, ok := key.(*rsa.PrivateKey)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key type: %T", key)
+		}
+		id, err := publicKeyID(&private.PublicKey)
+		if err != nil {
+			return nil, err
+		}
+		d.keys[id] = private
+	}
+	if len(d.keys) == 0 {
+		return nil, errors.New("no private keys found")
+	}
+	return d, nil
+}
+
+// KeyIDs returns the hex encoded ids of the active private keys.
+func (d *Decrypter) KeyIDs() []string {
+	ids := make([]string, 0, len(d.keys))
+	for id := range d.keys {
+		ids = append(ids, id.String())
+	}
+	return ids
+}
+
+// Decrypt returns the plaintext of the envelope.
+func (d *Decrypter) Decrypt(envelope []byte) ([]byte, error) {
+	if len(envelope) < 1+keyIDSize+2 || envelope[0] != EnvelopeVersion1 {
+		return nil, ErrUnsupportedEnvelope
+	}
+	var id keyID
+	copy(id[:], envelope[1:1+keyIDSize])
+	private, ok := d.keys[id]
+	if !ok {
+		return nil, fmt.Errorf("%w %s", ErrUnknownKey, id)
+	}
+
+	offset := 1 + keyIDSize
+	wrappedKeyLen := int(binary.BigEndian.Uint16(envelope[offset:]))
+	offset += 2
+	if len(envelope) < offset+wrappedKeyLen {
+		return nil, ErrUnsupportedEnvelope
+	}
+	wrappedKey := envelope[offset : offset+wrappedKeyLen]
+	offset += wrappedKeyLen
+	header := envelope[:offset]
+
+	dataKey, err := rsa.DecryptOAEP(sha256.New(), nil, private, wrappedKey, oaepLabel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unwrap data key: %w", err)
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return nil, err
+	}
+	if len(envelope) < offset+aead.NonceSize() {
+		return nil, ErrUnsupportedEnvelope
+	}
+	nonce := envelope[offset : offset+aead.NonceSize()]
+	plaintext, err := aead.Open(nil, nonce, envelope[offset+aead.NonceSize():], header)
+	if err != nil {
+		return nil, fmt.Errorf("failed to decrypt message: %w", err)
+	}
+	return plaintext, nil
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create cipher: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create GCM: %w", err)
+	}
+	return aead, nil
+}
+
+// ReadKey returns the PEM contents of the key, the value is either the PEM itself or a path to the file with it.
+func ReadKey(value string) (string, error) {
+	if value == "" || strings.Contains(value, "-----BEGIN") {
+		return value, nil
+	}
+	data, err := os.ReadFile(value)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file by path '%s': %w", value, err)
+	}
+	return string(data), nil
+}
+
+// LoadEncrypter creates an Encrypter from the certificate or public key given as PEM or path to the file with it,
+// it returns nil if the key is not set.
+func LoadEncrypter(publicKey string) (*Encrypter, error) {
+	if publicKey == "" {
+		return nil, nil
+	}
+	publicPEM, err := ReadKey(publicKey)
+	if err != nil {
+		return nil, err
+	}
+	return NewEncrypter(publicPEM)
+}
+
+// LoadDecrypter creates a Decrypter from the private keys given as PEM or path to the file with them,
+// it returns nil if the keys are not set.
+func LoadDecrypter(privateKeys string) (*Decrypter, error) {
+	if privateKeys == "" {
+		return nil, nil
+	}
+	privatePEM, err := ReadKey(privateKeys)
+	if err != nil {
+		return nil, err
+	}
+	return NewDecrypter(privatePEM)
+}
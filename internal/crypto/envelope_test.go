@@ -0,0 +1,96 @@
+package crypto
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func generateTestKey(t *testing.T) (string, string) {
+	t.Helper()
+	private, public, err := GenerateCertificate(CertificateOptions{Bits: 2048})
+	require.NoError(t, err)
+	return private, public
+}
+
+func TestEnvelope_LargePayload(t *testing.T) {
+	private, public := generateTestKey(t)
+	encrypter, err := NewEncrypter(public)
+	require.NoError(t, err)
+	decrypter, err := NewDecrypter(private)
+	require.NoError(t, err)
+
+	// пачка метрик намного больше размера блока RSA
+	plaintext := bytes.Repeat([]byte(`{"id":"Alloc","type":"gauge","value":1.5},`), 10000)
+	envelope, err := encrypter.Encrypt(plaintext)
+	require.NoError(t, err)
+	require.Equal(t, EnvelopeVersion1, envelope[0])
+
+	decrypted, err := decrypter.Decrypt(envelope)
+	require.NoError(t, err)
+	require.Equal(t, plaintext, decrypted)
+
+	// изменение любого байта конверта обнаруживается
+	for _, i := range []int{5, 20, len(envelope) - 1} {
+		tampered := bytes.Clone(envelope)
+		tampered[i] ^= 0xff
+		_, err = decrypter.Decrypt(tampered)
+		require.Error(t, err)
+	}
+
+	_, err = decrypter.Decrypt(append([]byte{2}, envelope[1:]...))
+	require.ErrorIs(t, err, ErrUnsupportedEnvelope)
+	_, err = decrypter.Decrypt(envelope[:4])
+	require.ErrorIs(t, err, ErrUnsupportedEnvelope)
+}
+
+func TestEnvelope_KeyRotation(t *testing.T) {
+	oldPrivate, oldPublic := generateTestKey(t)
+	newPrivate, newPublic := generateTestKey(t)
+	_, unknownPublic := generateTestKey(t)
+
+	decrypter, err := NewDecrypter(oldPrivate + newPrivate)
+	require.NoError(t, err)
+	require.Len(t, decrypter.KeyIDs(), 2)
+
+	for _, public := range []string{oldPublic, newPublic} {
+		encrypter, err := NewEncrypter(public)
+		require.NoError(t, err)
+		require.Contains(t, decrypter.KeyIDs(), encrypter.KeyID())
+		envelope, err := encrypter.Encrypt([]byte("message"))
+		require.NoError(t, err)
+		decrypted, err := decrypter.Decrypt(envelope)
+		require.NoError(t, err)
+		require.Equal(t, "message", string(decrypted))
+	}
+
+	encrypter, err := NewEncrypter(unknownPublic)
+	require.NoError(t, err)
+	envelope, err := encrypter.Encrypt([]byte("message"))
+	require.NoError(t, err)
+	_, err = decrypter.Decrypt(envelope)
+	require.ErrorIs(t, err, ErrUnknownKey)
+
+	_, err = NewDecrypter(oldPublic)
+	require.Error(t, err)
+}
+
+func TestReadKey(t *testing.T) {
+	private, _ := generateTestKey(t)
+
+	key, err := ReadKey(private)
+	require.NoError(t, err)
+	require.Equal(t, private, key)
+
+	path := filepath.Join(t.TempDir(), "key.pem")
+	require.NoError(t, os.WriteFile(path, []byte(private), 0o600))
+	key, err = ReadKey(path)
+	require.NoError(t, err)
+	require.Equal(t, private, key)
+
+	_, err = ReadKey(filepath.Join(t.TempDir(), "missing.pem"))
+	require.Error(t, err)
+}
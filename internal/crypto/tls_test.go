@@ -0,0 +1,92 @@
+package crypto
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testPKI struct {
+	caCert, serverCert, serverKey, clientCert, clientKey string
+}
+
+func newTestPKI(t *testing.T) testPKI {
+	t.Helper()
+	dir := t.TempDir()
+	write := func(name string, data string) string {
+		path := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(path, []byte(data), 0o600))
+		return path
+	}
+
+	caKey, caCert, err := GenerateCertificate(CertificateOptions{CommonName: "test CA", IsCA: true, Bits: 2048})
+	require.NoError(t, err)
+	serverKey, serverCert, err := GenerateCertificate(CertificateOptions{
+		CommonName: "server", Hosts: []string{"127.0.0.1"}, ParentCert: caCert, ParentKey: caKey, Bits: 2048,
+	})
+	require.NoError(t, err)
+	clientKey, clientCert, err := GenerateCertificate(CertificateOptions{
+		CommonName: "agent-1", ParentCert: caCert, ParentKey: caKey, Bits: 2048,
+	})
+	require.NoError(t, err)
+
+	return testPKI{
+		caCert:     write("ca.pem", caCert),
+		serverCert: write("server.pem", serverCert),
+		serverKey:  write("server-key.pem", serverKey),
+		clientCert: write("client.pem", clientCert),
+		clientKey:  write("client-key.pem", clientKey),
+	}
+}
+
+func TestTLSConfig_Disabled(t *testing.T) {
+	cfg, err := ServerTLSConfig("", "", "")
+	require.NoError(t, err)
+	require.Nil(t, cfg)
+
+	cfg, err = ClientTLSConfig("", "", "")
+	require.NoError(t, err)
+	require.Nil(t, cfg)
+
+	_, err = ServerTLSConfig("", "", "ca.pem")
+	require.Error(t, err)
+}
+
+func TestTLSConfig_MutualTLS(t *testing.T) {
+	pki := newTestPKI(t)
+
+	serverConfig, err := ServerTLSConfig(pki.serverCert, pki.serverKey, pki.caCert)
+	require.NoError(t, err)
+	ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(r.TLS.VerifiedChains[0][0].Subject.CommonName))
+	}))
+	ts.TLS = serverConfig
+	ts.StartTLS()
+	defer ts.Close()
+
+	clientConfig, err := ClientTLSConfig(pki.caCert, pki.clientCert, pki.clientKey)
+	require.NoError(t, err)
+	client := &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+	resp, err := client.Get(ts.URL)
+	require.NoError(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.NoError(t, err)
+	require.Equal(t, "agent-1", string(body))
+
+	// без сертификата клиента сервер разрывает соединение
+	clientConfig, err = ClientTLSConfig(pki.caCert, "", "")
+	require.NoError(t, err)
+	client = &http.Client{Transport: &http.Transport{TLSClientConfig: clientConfig}}
+	_, err = client.Get(ts.URL)
+	require.Error(t, err)
+
+	// сертификат сервера не подписан системными удостоверяющими центрами
+	_, err = http.Get(ts.URL)
+	require.Error(t, err)
+}
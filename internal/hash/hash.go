@@ -1,52 +1,92 @@
+// Package hash signs requests and responses with HMAC-SHA256.
+//
+// A request signature covers the method, the path, the timestamp, a random nonce and the body,
+// so that a captured request can neither be modified nor sent again.
 package hash
 
 import (
-	"crypto/aes"
-	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
 	"crypto/sha256"
 	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
 )
 
-func EncodeHash(msgBytes []byte, password string) string {
-	key := sha256.Sum256([]byte(password))
-
-	aesblock, err := aes.NewCipher(key[:])
-	if err != nil {
-		panic(err)
-	}
-	aesgcm, err := cipher.NewGCM(aesblock)
-	if err != nil {
-		panic(err)
-	}
+const (
+	// Header заголовок с подписью запроса или ответа.
+	Header = "HashSHA256"
+	// TimestampHeader заголовок со временем подписи запроса в секундах Unix.
+	TimestampHeader = "X-Signature-Timestamp"
+	// NonceHeader заголовок со случайным значением, которое сервер принимает только один раз.
+	NonceHeader = "X-Signature-Nonce"
+)
 
-	nonce := key[len(key)-aesgcm.NonceSize():]
+// Sum returns hex encoded HMAC-SHA256 of data with the secret.
+func Sum(data []byte, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(data)
+	return hex.EncodeToString(mac.Sum(nil))
+}
 
-	dst := aesgcm.Seal(nil, nonce, msgBytes, nil) // зашифровываем
-	return hex.EncodeToString(dst)
+// Equal reports whether the signature is HMAC-SHA256 of data with the secret, in constant time.
+func Equal(data []byte, secret string, signature string) bool {
+	return hmac.Equal([]byte(signature), []byte(Sum(data, secret)))
 }
 
-func DecodeHash(msg string, password string) string {
-	key := sha256.Sum256([]byte(password))
+// Request is the signed part of a request.
+type Request struct {
+	Method string
+	Path   string
+	// Timestamp время подписи в секундах Unix
+	Timestamp int64
+	Nonce     string
+	Body      []byte
+}
 
-	aesblock, err := aes.NewCipher(key[:])
-	if err != nil {
-		panic(err)
-	}
-	aesgcm, err := cipher.NewGCM(aesblock)
-	if err != nil {
-		panic(err)
+// NewRequest returns the request signed now with a new random nonce.
+func NewRequest(method string, path string, body []byte) (Request, error) {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return Request{}, fmt.Errorf("failed to generate nonce: %w", err)
 	}
+	return Request{
+		Method:    method,
+		Path:      path,
+		Timestamp: time.Now().Unix(),
+		Nonce:     hex.EncodeToString(nonce),
+		Body:      body,
+	}, nil
+}
 
-	decodedMsg, err := hex.DecodeString(msg)
-	if err != nil {
-		panic(err)
-	}
+// canonical returns the string to sign, the body is included as its SHA-256.
+func (r Request) canonical() []byte {
+	bodySum := sha256.Sum256(r.Body)
+	return []byte(strings.Join([]string{
+		strings.ToUpper(r.Method),
+		r.Path,
+		strconv.FormatInt(r.Timestamp, 10),
+		r.Nonce,
+		hex.EncodeToString(bodySum[:]),
+	}, "\n"))
+}
+
+// Sign returns the signature of the request with the secret.
+func (r Request) Sign(secret string) string {
+	return Sum(r.canonical(), secret)
+}
 
-	nonce := key[len(key)-aesgcm.NonceSize():]
-	decrypted, err := aesgcm.Open(nil, nonce, decodedMsg, nil)
+// SignHTTPRequest signs the HTTP request with the body and sets the signature headers.
+func SignHTTPRequest(req *http.Request, body []byte, secret string) error {
+	signed, err := NewRequest(req.Method, req.URL.Path, body)
 	if err != nil {
-		panic(err)
+		return err
 	}
-
-	return string(decrypted)
+	req.Header.Set(TimestampHeader, strconv.FormatInt(signed.Timestamp, 10))
+	req.Header.Set(NonceHeader, signed.Nonce)
+	req.Header.Set(Header, signed.Sign(secret))
+	return nil
 }
@@ -1,17 +1,144 @@
 package hash
 
 import (
+	"net/http"
+	"strconv"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 )
 
-func TestEncodeHash(t *testing.T) {
-	sourceMsg := "source message"
-	key := "testpassword"
-	encodeHash := EncodeHash([]byte(sourceMsg), key)
-	require.NotEmpty(t, sourceMsg)
-	resultMsg := DecodeHash(encodeHash, key)
-	require.NotEmpty(t, resultMsg)
-	require.Equal(t, sourceMsg, resultMsg)
+func TestSum(t *testing.T) {
+	// RFC 4231, test case 2
+	require.Equal(t,
+		"5bdcc146bf60754e6a042426089575c75a003f089d2739839dec58b964ec3843",
+		Sum([]byte("what do ya want for nothing?"), "Jefe"),
+	)
+	require.Len(t, Sum(make([]byte, 1<<20), "key"), 64)
+}
+
+func TestRequest_Sign(t *testing.T) {
+	r, err := NewRequest(http.MethodPost, "/updates/", []byte(`[{"id":"Alloc"}]`))
+	require.NoError(t, err)
+	signature := r.Sign("secret")
+
+	for _, changed := range []Request{
+		{Method: http.MethodPut, Path: r.Path, Timestamp: r.Timestamp, Nonce: r.Nonce, Body: r.Body},
+		{Method: r.Method, Path: "/update/", Timestamp: r.Timestamp, Nonce: r.Nonce, Body: r.Body},
+		{Method: r.Method, Path: r.Path, Timestamp: r.Timestamp + 1, Nonce: r.Nonce, Body: r.Body},
+		{Method: r.Method, Path: r.Path, Timestamp: r.Timestamp, Nonce: "other", Body: r.Body},
+		{Method: r.Method, Path: r.Path, Timestamp: r.Timestamp, Nonce: r.Nonce, Body: []byte(`[]`)},
+	} {
+		require.NotEqual(t, signature, changed.Sign("secret"))
+	}
+	require.NotEqual(t, signature, r.Sign("other"))
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	v := NewVerifier(ParseSecrets("new", "old, "), time.Minute)
+	v.now = func() time.Time { return now }
+
+	signed := func(secret string, nonce string, at time.Time) (Request, string) {
+		r := Request{Method: http.MethodPost, Path: "/updates/", Timestamp: at.Unix(), Nonce: nonce, Body: []byte("body")}
+		return r, r.Sign(secret)
+	}
+	verify := func(r Request, signature string, wantSecret string) {
+		t.Helper()
+		secret, err := v.Verify(r, signature)
+		require.NoError(t, err)
+		require.Equal(t, wantSecret, secret)
+	}
+	requireRejected := func(r Request, signature string, wantErr error) {
+		t.Helper()
+		_, err := v.Verify(r, signature)
+		require.ErrorIs(t, err, wantErr)
+	}
+
+	r, signature := signed("new", "n1", now)
+	verify(r, signature, "new")
+	requireRejected(r, signature, ErrReplayedNonce)
+
+	// запросы, подписанные предыдущим ключом, принимаются во время ротации
+	r, signature = signed("old", "n2", now.Add(-30*time.Second))
+	verify(r, signature, "old")
+
+	r, signature = signed("unknown", "n3", now)
+	requireRejected(r, signature, ErrInvalidSignature)
+	// отклонённая подпись не занимает nonce
+	r, signature = signed("new", "n3", now)
+	verify(r, signature, "new")
+
+	r, signature = signed("new", "n4", now.Add(-2*time.Minute))
+	requireRejected(r, signature, ErrStaleTimestamp)
+	r, signature = signed("new", "n4", now.Add(2*time.Minute))
+	requireRejected(r, signature, ErrStaleTimestamp)
+
+	r, _ = signed("new", "n5", now)
+	requireRejected(r, "", ErrMissingSignature)
+
+	// после истечения окна nonce освобождается, а старый запрос с ним отклоняется по времени
+	replayed, replayedSignature := signed("new", "n1", now)
+	now = now.Add(2 * time.Minute)
+	requireRejected(replayed, replayedSignature, ErrStaleTimestamp)
+	r, signature = signed("new", "n1", now)
+	verify(r, signature, "new")
+}
+
+func TestVerifier_NonceLimit(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	v := NewVerifier([]string{"secret"}, time.Minute)
+	v.now = func() time.Time { return now }
+	v.maxNonces = 2
+
+	verify := func(nonce string, at time.Time) error {
+		r := Request{Method: http.MethodPost, Path: "/updates/", Timestamp: at.Unix(), Nonce: nonce}
+		_, err := v.Verify(r, r.Sign("secret"))
+		return err
+	}
+
+	require.NoError(t, verify("n1", now.Add(-30*time.Second)))
+	require.NoError(t, verify("n2", now))
+	// при заполненном кеше отклоняется только новый запрос
+	require.ErrorIs(t, verify("n3", now), ErrTooManyNonces)
+	require.ErrorIs(t, verify("n1", now), ErrReplayedNonce)
+
+	// истёкший nonce удаляется при следующем запросе и освобождает место
+	now = now.Add(45 * time.Second)
+	require.NoError(t, verify("n3", now))
+	require.Len(t, v.nonces, 2)
+	require.ErrorIs(t, verify("n2", now), ErrReplayedNonce)
+
+	now = now.Add(2 * time.Minute)
+	require.NoError(t, verify("n4", now))
+	require.Len(t, v.nonces, 1)
+	require.Len(t, v.expiry, 1)
+}
+
+func TestNewVerifier_NoSecrets(t *testing.T) {
+	v := NewVerifier(ParseSecrets("", ""), time.Minute)
+	require.Nil(t, v)
+	_, err := v.Verify(Request{}, "signature")
+	require.ErrorIs(t, err, ErrMissingSignature)
+}
+
+func TestSignHTTPRequest(t *testing.T) {
+	body := []byte("body")
+	req, err := http.NewRequest(http.MethodPost, "http://localhost:8080/updates/", nil)
+	require.NoError(t, err)
+	require.NoError(t, SignHTTPRequest(req, body, "secret"))
+
+	timestamp, err := strconv.ParseInt(req.Header.Get(TimestampHeader), 10, 64)
+	require.NoError(t, err)
+	r := Request{
+		Method:    req.Method,
+		Path:      req.URL.Path,
+		Timestamp: timestamp,
+		Nonce:     req.Header.Get(NonceHeader),
+		Body:      body,
+	}
+	secret, err := NewVerifier([]string{"secret"}, 0).Verify(r, req.Header.Get(Header))
+	require.NoError(t, err)
+	require.Equal(t, "secret", secret)
 }
@@ -0,0 +1,160 @@
+package hash
+
+import (
+	"container/heap"
+	"crypto/hmac"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	// DefaultMaxSkew допустимое по умолчанию расхождение времени подписи запроса со временем сервера.
+	DefaultMaxSkew = 5 * time.Minute
+	// maxNonceLength ограничивает память, которую занимает одно значение в кеше nonce.
+	maxNonceLength = 64
+	// defaultMaxNonces ограничивает количество действующих nonce, новые запросы сверх него отклоняются,
+	// пока не истечёт окно ранее принятых.
+	defaultMaxNonces = 1 << 20
+)
+
+var (
+	// ErrMissingSignature the request has no signature, timestamp or nonce.
+	ErrMissingSignature = errors.New("missing signature")
+	// ErrInvalidSignature the signature does not match any of the active secrets.
+	ErrInvalidSignature = errors.New("invalid signature")
+	// ErrStaleTimestamp the request was signed outside of the allowed clock skew.
+	ErrStaleTimestamp = errors.New("signature timestamp outside of allowed clock skew")
+	// ErrReplayedNonce the nonce of the request has already been accepted.
+	ErrReplayedNonce = errors.New("replayed nonce")
+	// ErrTooManyNonces too many requests were accepted within the clock skew window to remember another nonce.
+	ErrTooManyNonces = errors.New("too many signed requests within the clock skew window")
+)
+
+// Verifier verifies request signatures with any of the active secrets,
+// so that a new secret can be rolled out to agents while the previous one is still accepted.
+// A nonce is accepted once within the clock skew window, older requests are rejected by the timestamp.
+type Verifier struct {
+	secrets []string
+	maxSkew time.Duration
+	now     func() time.Time
+
+	mu        sync.Mutex
+	nonces    map[string]time.Time
+	expiry    nonceQueue
+	maxNonces int
+}
+
+// NewVerifier returns the verifier for the secrets, empty secrets are ignored.
+// Returns nil if there are no secrets, a nil verifier accepts nothing.
+func NewVerifier(secrets []string, maxSkew time.Duration) *Verifier {
+	active := make([]string, 0, len(secrets))
+	for _, secret := range secrets {
+		if secret != "" {
+			active = append(active, secret)
+		}
+	}
+	if len(active) == 0 {
+		return nil
+	}
+	if maxSkew <= 0 {
+		maxSkew = DefaultMaxSkew
+	}
+	return &Verifier{
+		secrets:   active,
+		maxSkew:   maxSkew,
+		now:       time.Now,
+		nonces:    map[string]time.Time{},
+		maxNonces: defaultMaxNonces,
+	}
+}
+
+// ParseSecrets returns the primary secret followed by the additional comma separated secrets.
+func ParseSecrets(primary string, additional string) []string {
+	secrets := []string{primary}
+	for _, secret := range strings.Split(additional, ",") {
+		secrets = append(secrets, strings.TrimSpace(secret))
+	}
+	return secrets
+}
+
+// Verify checks the signature of the request and remembers its nonce.
+// It returns the secret that matched the signature, the response to the request is signed with it,
+// so that agents which still use the previous secret can verify it.
+func (v *Verifier) Verify(r Request, signature string) (string, error) {
+	if v == nil || signature == "" || r.Nonce == "" || r.Timestamp == 0 {
+		return "", ErrMissingSignature
+	}
+	if len(r.Nonce) > maxNonceLength {
+		return "", ErrInvalidSignature
+	}
+
+	now := v.now()
+	signedAt := time.Unix(r.Timestamp, 0)
+	if signedAt.Before(now.Add(-v.maxSkew)) || signedAt.After(now.Add(v.maxSkew)) {
+		return "", ErrStaleTimestamp
+	}
+
+	secret, ok := v.match(r, signature)
+	if !ok {
+		return "", ErrInvalidSignature
+	}
+
+	// nonce запоминается только после проверки подписи, иначе кеш можно заполнить без знания секрета
+	if err := v.useNonce(r.Nonce, signedAt.Add(v.maxSkew), now); err != nil {
+		return "", err
+	}
+	return secret, nil
+}
+
+func (v *Verifier) match(r Request, signature string) (string, bool) {
+	got := []byte(signature)
+	for _, secret := range v.secrets {
+		if hmac.Equal(got, []byte(r.Sign(secret))) {
+			return secret, true
+		}
+	}
+	return "", false
+}
+
+func (v *Verifier) useNonce(nonce string, expiresAt time.Time, now time.Time) error {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	// истёкшие nonce удаляются в порядке истечения, поэтому в кеше остаются только действующие
+	for len(v.expiry) > 0 && !v.expiry[0].expiresAt.After(now) {
+		delete(v.nonces, heap.Pop(&v.expiry).(nonceEntry).nonce)
+	}
+	if _, ok := v.nonces[nonce]; ok {
+		return ErrReplayedNonce
+	}
+	if len(v.nonces) >= v.maxNonces {
+		return ErrTooManyNonces
+	}
+	v.nonces[nonce] = expiresAt
+	heap.Push(&v.expiry, nonceEntry{nonce: nonce, expiresAt: expiresAt})
+	return nil
+}
+
+type nonceEntry struct {
+	nonce     string
+	expiresAt time.Time
+}
+
+// nonceQueue is a min-heap of nonces ordered by expiration time.
+type nonceQueue []nonceEntry
+
+func (q nonceQueue) Len() int           { return len(q) }
+func (q nonceQueue) Less(i, j int) bool { return q[i].expiresAt.Before(q[j].expiresAt) }
+func (q nonceQueue) Swap(i, j int)      { q[i], q[j] = q[j], q[i] }
+
+func (q *nonceQueue) Push(x any) { *q = append(*q, x.(nonceEntry)) }
+
+func (q *nonceQueue) Pop() any {
+	old := *q
+	n := len(old)
+	e := old[n-1]
+	*q = old[:n-1]
+	return e
+}
@@ -0,0 +1,127 @@
+// Package identity describes the client that sent a request: its tenant, TLS certificate subject,
+// bearer token user and IP address.
+// Transports attach the identity to the request context, so that limits and access rules work the same for HTTP and gRPC.
+package identity
+
+import (
+	"context"
+	"crypto/x509"
+	"net/http"
+
+	"github.com/andreevym/metric-collector/internal/oidc"
+	"github.com/andreevym/metric-collector/internal/subnet"
+	"github.com/andreevym/metric-collector/internal/tenant"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+// RealIPHeader header with the IP address of the agent, it is used only if set by a trusted proxy.
+const RealIPHeader = "X-Real-IP"
+
+// RealIPMetadataKey gRPC metadata key with the IP address of the agent.
+const RealIPMetadataKey = "x-real-ip"
+
+// Identity is the client that sent a request.
+type Identity struct {
+	// Tenant name of the tenant resolved by the API key, empty without tenants
+	Tenant string
+	// Subject common name of the verified client certificate, empty without mTLS
+	Subject string
+	// User subject of the bearer token, empty for requests without a token
+	User string
+	// Roles granted by the bearer token
+	Roles []string
+	// IP address of the client, empty if unknown
+	IP string
+}
+
+// Key returns the key the client is accounted by: the tenant, the certificate subject or the IP address,
+// whichever is known first.
+func (i Identity) Key() string {
+	switch {
+	case i.Tenant != "":
+		return "tenant:" + i.Tenant
+	case i.Subject != "":
+		return "cert:" + i.Subject
+	case i.User != "":
+		return "user:" + i.User
+	case i.IP != "":
+		return "ip:" + i.IP
+	default:
+		return "anonymous"
+	}
+}
+
+type identityKey struct{}
+
+// WithIdentity returns a copy of ctx carrying the client identity.
+func WithIdentity(ctx context.Context, id Identity) context.Context {
+	return context.WithValue(ctx, identityKey{}, id)
+}
+
+// FromContext returns the identity of ctx, the zero Identity for contexts without it.
+func FromContext(ctx context.Context) Identity {
+	id, _ := ctx.Value(identityKey{}).(Identity)
+	return id
+}
+
+// FromHTTPRequest builds the identity of the HTTP request, the tenant is taken from the request context.
+// The IP address is the peer address, X-Real-IP is used only if the peer is a proxy trusted by policy.
+func FromHTTPRequest(r *http.Request, policy *subnet.Policy) Identity {
+	id := Identity{IP: clientIP(policy, r.RemoteAddr, r.Header.Get(RealIPHeader))}
+	if r.TLS != nil {
+		id.Subject = subjectOf(r.TLS.VerifiedChains)
+	}
+	id.Tenant, _ = tenant.FromContext(r.Context())
+	id.User, id.Roles = userOf(r.Context())
+	return id
+}
+
+// FromGRPCContext builds the identity of the incoming gRPC call, the tenant is taken from ctx.
+// The IP address is the peer address, x-real-ip metadata is used only if the peer is a proxy trusted by policy.
+func FromGRPCContext(ctx context.Context, policy *subnet.Policy) Identity {
+	var id Identity
+	var peerAddr, realIP string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(RealIPMetadataKey); len(values) > 0 {
+			realIP = values[0]
+		}
+	}
+	if p, ok := peer.FromContext(ctx); ok {
+		if p.Addr != nil {
+			peerAddr = p.Addr.String()
+		}
+		if tlsInfo, ok := p.AuthInfo.(credentials.TLSInfo); ok {
+			id.Subject = subjectOf(tlsInfo.State.VerifiedChains)
+		}
+	}
+	id.IP = clientIP(policy, peerAddr, realIP)
+	id.Tenant, _ = tenant.FromContext(ctx)
+	id.User, id.Roles = userOf(ctx)
+	return id
+}
+
+func userOf(ctx context.Context) (string, []string) {
+	claims, ok := oidc.FromContext(ctx)
+	if !ok {
+		return "", nil
+	}
+	return claims.Subject, claims.Roles
+}
+
+func subjectOf(chains [][]*x509.Certificate) string {
+	if len(chains) == 0 || len(chains[0]) == 0 {
+		return ""
+	}
+	return chains[0][0].Subject.CommonName
+}
+
+// clientIP returns the address of the client or an empty string if it is unknown, e.g. for in-memory connections.
+func clientIP(policy *subnet.Policy, peerAddr, realIP string) string {
+	addr, ok := policy.ClientIP(peerAddr, realIP)
+	if !ok {
+		return ""
+	}
+	return addr.String()
+}
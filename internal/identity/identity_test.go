@@ -0,0 +1,56 @@
+package identity
+
+import (
+	"context"
+	"net"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andreevym/metric-collector/internal/subnet"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+)
+
+func TestFromHTTPRequest_RealIP(t *testing.T) {
+	policy, err := subnet.ParsePolicy("", "10.0.0.5")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name       string
+		policy     *subnet.Policy
+		remoteAddr string
+		realIP     string
+		ip         string
+	}{
+		{name: "peer", policy: policy, remoteAddr: "10.0.0.1:5000", ip: "10.0.0.1"},
+		{name: "header of client is ignored", policy: policy, remoteAddr: "10.0.0.1:5000", realIP: "192.168.1.10", ip: "10.0.0.1"},
+		{name: "header of proxy", policy: policy, remoteAddr: "10.0.0.5:5000", realIP: "192.168.1.10", ip: "192.168.1.10"},
+		{name: "proxy without header", policy: policy, remoteAddr: "10.0.0.5:5000"},
+		{name: "no proxies", remoteAddr: "10.0.0.1:5000", realIP: "192.168.1.10", ip: "10.0.0.1"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest("POST", "/update/", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				r.Header.Set(RealIPHeader, tt.realIP)
+			}
+			id := FromHTTPRequest(r, tt.policy)
+			require.Equal(t, tt.ip, id.IP)
+		})
+	}
+}
+
+func TestFromGRPCContext_RealIP(t *testing.T) {
+	policy, err := subnet.ParsePolicy("", "10.0.0.5")
+	require.NoError(t, err)
+
+	ctx := func(peerAddr string, realIP string) context.Context {
+		ctx := peer.NewContext(context.Background(), &peer.Peer{Addr: &net.TCPAddr{IP: net.ParseIP(peerAddr), Port: 5000}})
+		return metadata.NewIncomingContext(ctx, metadata.Pairs(RealIPMetadataKey, realIP))
+	}
+	require.Equal(t, "10.0.0.1", FromGRPCContext(ctx("10.0.0.1", "192.168.1.10"), policy).IP)
+	require.Equal(t, "192.168.1.10", FromGRPCContext(ctx("10.0.0.5", "192.168.1.10"), policy).IP)
+	require.Equal(t, "ip:10.0.0.1", FromGRPCContext(ctx("10.0.0.1", "192.168.1.10"), nil).Key())
+}
@@ -0,0 +1,224 @@
+// Package ingest provides a write-behind buffer between the controller and the metric storage.
+//
+// Agents report the same series every report interval, so the buffer coalesces updates
+// over a short flush window: gauges keep the last written value and counter deltas are summed.
+// Buffered metrics are saved with store.SaveAllMetric when the window elapses,
+// when the number of pending series reaches the limit and on shutdown.
+// While the storage is failing unsaved series stay pending, writes of new series are rejected
+// with ErrBufferFull once the maximum number of pending series is reached.
+package ingest
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"go.uber.org/zap"
+)
+
+// ErrBufferFull the buffer can't accept new series until the pending ones are saved.
+var ErrBufferFull = errors.New("ingest buffer is full")
+
+type Buffer struct {
+	storage store.Storage
+	window  time.Duration
+	maxSize int
+	// maxPending максимальное количество несохранённых метрик, 0 — без ограничений
+	maxPending int
+
+	mu      sync.Mutex
+	pending map[string]*store.Metric
+	// flushing количество метрик сбрасываемого пакета, при ошибке они возвращаются в pending
+	flushing int
+
+	// flushMu serializes flushes, so that a batch is never saved concurrently with the next one
+	flushMu sync.Mutex
+	flushCh chan struct{}
+}
+
+// NewBuffer creates a Buffer flushing into storage every window
+// or as soon as maxSize distinct series are pending, a non-positive maxSize disables the size limit.
+func NewBuffer(storage store.Storage, window time.Duration, maxSize int) *Buffer {
+	return &Buffer{
+		storage: storage,
+		window:  window,
+		maxSize: maxSize,
+		pending: map[string]*store.Metric{},
+		flushCh: make(chan struct{}, 1),
+	}
+}
+
+// WithMaxPending limits the number of series that are not saved yet, including the batch being flushed,
+// a non-positive n disables the limit.
+func (b *Buffer) WithMaxPending(n int) *Buffer {
+	b.maxPending = n
+	return b
+}
+
+// Add validates metrics and merges them into the pending batch.
+func (b *Buffer) Add(metrics []*store.Metric) error {
+	_, err := b.Merge(metrics)
+	return err
+}
+
+// Merge adds metrics like Add and returns the pending value of the series of every metric
+// as it was right before the metric was merged, nil if the series wasn't pending.
+func (b *Buffer) Merge(metrics []*store.Metric) ([]*store.Metric, error) {
+	for _, m := range metrics {
+		if err := validate(m); err != nil {
+			return nil, err
+		}
+	}
+
+	previous := make([]*store.Metric, 0, len(metrics))
+	b.mu.Lock()
+	if b.maxPending > 0 && b.flushing+len(b.pending)+b.newSeries(metrics) > b.maxPending {
+		b.mu.Unlock()
+		return nil, fmt.Errorf("%w: %d series are not saved yet", ErrBufferFull, b.flushing+len(b.pending))
+	}
+	for _, m := range metrics {
+		if found, ok := b.pending[m.ID+m.MType]; ok {
+			previous = append(previous, store.CopyMetric(found))
+		} else {
+			previous = append(previous, nil)
+		}
+		b.merge(m)
+	}
+	full := b.maxSize > 0 && len(b.pending) >= b.maxSize
+	b.mu.Unlock()
+
+	if full {
+		select {
+		case b.flushCh <- struct{}{}:
+		default:
+		}
+	}
+	return previous, nil
+}
+
+// Len returns the number of pending series.
+func (b *Buffer) Len() int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return len(b.pending)
+}
+
+// Flush saves pending metrics into the storage.
+// If saving fails the batch is merged back, so that counter deltas are not lost.
+func (b *Buffer) Flush(ctx context.Context) error {
+	b.flushMu.Lock()
+	defer b.flushMu.Unlock()
+
+	b.mu.Lock()
+	batch := b.pending
+	b.pending = make(map[string]*store.Metric, len(batch))
+	b.flushing = len(batch)
+	b.mu.Unlock()
+	defer func() {
+		b.mu.Lock()
+		b.flushing = 0
+		b.mu.Unlock()
+	}()
+
+	if len(batch) == 0 {
+		return nil
+	}
+
+	metrics := make([]*store.Metric, 0, len(batch))
+	for _, m := range batch {
+		metrics = append(metrics, m)
+	}
+	// SaveAllMetric accumulates counters into the passed metrics, so it gets copies
+	// and the batch keeps the buffered deltas in case it has to be retried
+	if err := store.SaveAllMetric(ctx, b.storage, copyMetrics(metrics)); err != nil {
+		b.mu.Lock()
+		for _, m := range metrics {
+			b.restore(m)
+		}
+		b.mu.Unlock()
+		return fmt.Errorf("failed to flush %d buffered metrics: %w", len(metrics), err)
+	}
+	return nil
+}
+
+// Run flushes the buffer every window or when it is full until ctx is done.
+// The final flush on shutdown is up to the caller.
+func (b *Buffer) Run(ctx context.Context) {
+	ticker := time.NewTicker(b.window)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-b.flushCh:
+		}
+		if err := b.Flush(ctx); err != nil {
+			logger.Logger().Error("failed to flush ingest buffer", zap.Error(err))
+		}
+	}
+}
+
+// merge applies a new metric to the pending batch, b.mu must be held.
+func (b *Buffer) merge(m *store.Metric) {
+	k := m.ID + m.MType
+	found, ok := b.pending[k]
+	if !ok {
+		b.pending[k] = store.CopyMetric(m)
+		return
+	}
+
+	switch m.MType {
+	case store.MTypeCounter:
+		delta := *found.Delta + *m.Delta
+		found.Delta = &delta
+	case store.MTypeGauge:
+		b.pending[k] = store.CopyMetric(m)
+	}
+}
+
+// newSeries returns the number of series of metrics that are not pending, b.mu must be held.
+func (b *Buffer) newSeries(metrics []*store.Metric) int {
+	keys := make(map[string]struct{}, len(metrics))
+	for _, m := range metrics {
+		if _, ok := b.pending[m.ID+m.MType]; !ok {
+			keys[m.ID+m.MType] = struct{}{}
+		}
+	}
+	return len(keys)
+}
+
+// restore returns a metric of a failed batch into the pending one, b.mu must be held.
+// Gauges written after the failed batch are newer and win, counter deltas are summed.
+func (b *Buffer) restore(m *store.Metric) {
+	if _, ok := b.pending[m.ID+m.MType]; ok && m.MType == store.MTypeGauge {
+		return
+	}
+	b.merge(m)
+}
+
+func validate(m *store.Metric) error {
+	switch {
+	case m == nil:
+		return fmt.Errorf("metric is nil")
+	case m.MType == store.MTypeCounter && m.Delta == nil:
+		return fmt.Errorf("counter %s has no delta", m.ID)
+	case m.MType == store.MTypeGauge && m.Value == nil:
+		return fmt.Errorf("gauge %s has no value", m.ID)
+	case m.MType != store.MTypeCounter && m.MType != store.MTypeGauge:
+		return fmt.Errorf("metric type %s is not valid for ID %s", m.MType, m.ID)
+	}
+	return nil
+}
+
+func copyMetrics(metrics []*store.Metric) []*store.Metric {
+	copies := make([]*store.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		copies = append(copies, store.CopyMetric(m))
+	}
+	return copies
+}
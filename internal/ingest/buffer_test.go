@@ -0,0 +1,191 @@
+package ingest
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/storage/mem"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/stretchr/testify/require"
+)
+
+func counter(id string, delta int64) *store.Metric {
+	return &store.Metric{ID: id, MType: store.MTypeCounter, Delta: &delta}
+}
+
+func gauge(id string, value float64) *store.Metric {
+	return &store.Metric{ID: id, MType: store.MTypeGauge, Value: &value}
+}
+
+func TestBuffer_Coalesce(t *testing.T) {
+	ctx := context.TODO()
+	memStorage := mem.NewStorage(nil)
+	require.NoError(t, memStorage.Create(ctx, counter("PollCount", 10)))
+	b := NewBuffer(memStorage, time.Minute, 0)
+
+	require.NoError(t, b.Add([]*store.Metric{counter("PollCount", 1), gauge("Alloc", 1)}))
+	require.NoError(t, b.Add([]*store.Metric{counter("PollCount", 2), gauge("Alloc", 2)}))
+	require.Equal(t, 2, b.Len())
+
+	_, err := memStorage.Read(ctx, "Alloc", store.MTypeGauge)
+	require.ErrorIs(t, err, store.ErrValueNotFound)
+
+	require.NoError(t, b.Flush(ctx))
+	require.Equal(t, 0, b.Len())
+
+	m, err := memStorage.Read(ctx, "PollCount", store.MTypeCounter)
+	require.NoError(t, err)
+	require.Equal(t, int64(13), *m.Delta)
+	m, err = memStorage.Read(ctx, "Alloc", store.MTypeGauge)
+	require.NoError(t, err)
+	require.Equal(t, 2.0, *m.Value)
+
+	// an empty flush is a no-op
+	require.NoError(t, b.Flush(ctx))
+}
+
+func TestBuffer_MergeReturnsPending(t *testing.T) {
+	b := NewBuffer(mem.NewStorage(nil), time.Minute, 0)
+	pending, err := b.Merge([]*store.Metric{counter("PollCount", 1), gauge("Alloc", 1), counter("PollCount", 2)})
+	require.NoError(t, err)
+	require.Len(t, pending, 3)
+	require.Nil(t, pending[0])
+	require.Nil(t, pending[1])
+	require.Equal(t, int64(1), *pending[2].Delta)
+
+	pending, err = b.Merge([]*store.Metric{gauge("Alloc", 2), counter("PollCount", 4)})
+	require.NoError(t, err)
+	require.Equal(t, 1.0, *pending[0].Value)
+	require.Equal(t, int64(3), *pending[1].Delta)
+}
+
+func TestBuffer_Validate(t *testing.T) {
+	b := NewBuffer(mem.NewStorage(nil), time.Minute, 0)
+
+	tests := []struct {
+		name   string
+		metric *store.Metric
+	}{
+		{name: "counter without delta", metric: &store.Metric{ID: "PollCount", MType: store.MTypeCounter}},
+		{name: "gauge without value", metric: &store.Metric{ID: "Alloc", MType: store.MTypeGauge}},
+		{name: "unknown type", metric: &store.Metric{ID: "Alloc", MType: "unknown"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Error(t, b.Add([]*store.Metric{gauge("Valid", 1), tt.metric}))
+			require.Equal(t, 0, b.Len())
+		})
+	}
+}
+
+func TestBuffer_RunFlushesWhenFull(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	memStorage := mem.NewStorage(nil)
+	b := NewBuffer(memStorage, time.Hour, 2)
+	go b.Run(ctx)
+
+	require.NoError(t, b.Add([]*store.Metric{gauge("Alloc", 1), gauge("HeapAlloc", 2)}))
+	require.Eventually(t, func() bool {
+		_, err := memStorage.Read(ctx, "HeapAlloc", store.MTypeGauge)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestBuffer_RunFlushesByWindow(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	memStorage := mem.NewStorage(nil)
+	b := NewBuffer(memStorage, 10*time.Millisecond, 0)
+	go b.Run(ctx)
+
+	require.NoError(t, b.Add([]*store.Metric{gauge("Alloc", 1)}))
+	require.Eventually(t, func() bool {
+		_, err := memStorage.Read(ctx, "Alloc", store.MTypeGauge)
+		return err == nil
+	}, time.Second, 10*time.Millisecond)
+}
+
+// failingStorage fails every batch write.
+type failingStorage struct {
+	store.Storage
+}
+
+func (s failingStorage) CreateAll(context.Context, map[string]store.MetricR) error {
+	return errors.New("database is down")
+}
+
+func TestBuffer_FlushErrorKeepsBatch(t *testing.T) {
+	ctx := context.TODO()
+	memStorage := mem.NewStorage(nil)
+	b := NewBuffer(failingStorage{Storage: memStorage}, time.Minute, 0)
+
+	require.NoError(t, b.Add([]*store.Metric{counter("PollCount", 1), gauge("Alloc", 1)}))
+	require.Error(t, b.Flush(ctx))
+	require.NoError(t, b.Add([]*store.Metric{counter("PollCount", 2), gauge("Alloc", 2)}))
+
+	b.storage = memStorage
+	require.NoError(t, b.Flush(ctx))
+
+	m, err := memStorage.Read(ctx, "PollCount", store.MTypeCounter)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), *m.Delta)
+	m, err = memStorage.Read(ctx, "Alloc", store.MTypeGauge)
+	require.NoError(t, err)
+	require.Equal(t, 2.0, *m.Value)
+}
+
+func TestBuffer_MaxPending(t *testing.T) {
+	ctx := context.TODO()
+	memStorage := mem.NewStorage(nil)
+	b := NewBuffer(failingStorage{Storage: memStorage}, time.Minute, 0).WithMaxPending(3)
+
+	require.NoError(t, b.Add([]*store.Metric{counter("PollCount", 1), gauge("Alloc", 1)}))
+	// пакет с новыми метриками сверх ограничения отклоняется целиком
+	require.ErrorIs(t, b.Add([]*store.Metric{gauge("HeapAlloc", 1), gauge("Sys", 1)}), ErrBufferFull)
+	require.Equal(t, 2, b.Len())
+	require.NoError(t, b.Add([]*store.Metric{counter("PollCount", 2), gauge("HeapAlloc", 1)}))
+
+	// метрики неудачного сброса остаются в буфере и продолжают занимать место
+	require.Error(t, b.Flush(ctx))
+	require.Equal(t, 3, b.Len())
+	require.ErrorIs(t, b.Add([]*store.Metric{gauge("Sys", 1)}), ErrBufferFull)
+	require.NoError(t, b.Add([]*store.Metric{counter("PollCount", 3)}))
+
+	b.storage = memStorage
+	require.NoError(t, b.Flush(ctx))
+	require.NoError(t, b.Add([]*store.Metric{gauge("Sys", 1)}))
+	m, err := memStorage.Read(ctx, "PollCount", store.MTypeCounter)
+	require.NoError(t, err)
+	require.Equal(t, int64(6), *m.Delta)
+}
+
+// blockingStorage blocks batch writes until release is closed.
+type blockingStorage struct {
+	store.Storage
+	started chan struct{}
+	release chan struct{}
+}
+
+func (s blockingStorage) CreateAll(ctx context.Context, metrics map[string]store.MetricR) error {
+	close(s.started)
+	<-s.release
+	return s.Storage.CreateAll(ctx, metrics)
+}
+
+func TestBuffer_MaxPendingCountsFlushingBatch(t *testing.T) {
+	storage := blockingStorage{Storage: mem.NewStorage(nil), started: make(chan struct{}), release: make(chan struct{})}
+	b := NewBuffer(storage, time.Minute, 0).WithMaxPending(2)
+	require.NoError(t, b.Add([]*store.Metric{gauge("Alloc", 1), gauge("HeapAlloc", 1)}))
+
+	done := make(chan error, 1)
+	go func() { done <- b.Flush(context.TODO()) }()
+	<-storage.started
+	// пока пакет сохраняется, он может вернуться в буфер, поэтому место не освобождается
+	require.ErrorIs(t, b.Add([]*store.Metric{gauge("Sys", 1)}), ErrBufferFull)
+	close(storage.release)
+	require.NoError(t, <-done)
+	require.NoError(t, b.Add([]*store.Metric{gauge("Sys", 1)}))
+}
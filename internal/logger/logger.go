@@ -1,12 +1,15 @@
 package logger
 
 import (
+	"sync/atomic"
+
 	"go.uber.org/zap"
 )
 
 const defaultLogLevel = "INFO"
 
-var log *zap.Logger
+// log логгер хранится атомарно, так как горутины сборщиков и отправки пишут в лог одновременно
+var log atomic.Pointer[zap.Logger]
 
 func NewLogger(level string) (*zap.Logger, error) {
 	lvl, err := zap.ParseAtomicLevel(level)
@@ -22,21 +25,20 @@ func NewLogger(level string) (*zap.Logger, error) {
 		return nil, err
 	}
 
-	log = zl
+	log.Store(zl)
 
 	return zl, err
 }
 
 func Logger() *zap.Logger {
-	if log != nil {
-		return log
+	if l := log.Load(); l != nil {
+		return l
 	}
 
-	var err error
-	log, err = NewLogger(defaultLogLevel)
+	l, err := NewLogger(defaultLogLevel)
 	if err != nil {
 		panic(err)
 	}
 
-	return log
+	return l
 }
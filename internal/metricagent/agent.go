@@ -1,15 +1,21 @@
 package metricagent
 
 import (
+	"context"
+	"crypto/tls"
 	"fmt"
-	"github.com/andreevym/metric-collector/internal/transport/grpc/proto"
-	"os"
-	"os/signal"
+	"net/http"
 	"sync"
-	"syscall"
+	"sync/atomic"
 	"time"
 
-	"golang.org/x/net/context"
+	"github.com/andreevym/metric-collector/internal/crypto"
+	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/transport/grpc/proto"
+	"github.com/andreevym/metric-collector/internal/utils"
+	"github.com/avast/retry-go"
+	"go.uber.org/zap"
 )
 
 type Agent struct {
@@ -17,16 +23,35 @@ type Agent struct {
 	PollDuration   time.Duration
 	ReportDuration time.Duration
 	LiveTime       time.Duration
-	SecretKey      string
-	CryptoKey      string
-	RateLimit      int
-	grpcClient     proto.MetricCollectorClient
-	isGrpcEnabled  bool
+	// ShutdownTimeout время на отправку собранных пакетов после остановки агента
+	ShutdownTimeout time.Duration
+	SecretKey       string
+	Encrypter       *crypto.Encrypter
+	TenantKey       string
+	RateLimit       int
+	grpcClient      proto.MetricCollectorClient
+	isGrpcEnabled   bool
+	httpClient      *http.Client
+	scheme          string
+	// spool очередь неотправленных пакетов на диске, nil — пакеты теряются при недоступности сервера
+	spool *Spool
+	// pollCount значение счётчика PollCount, переживает пересоздание агента при перечитывании конфига
+	pollCount *atomic.Int64
+	// collectors включённые сборщики метрик, nil — все зарегистрированные сборщики
+	collectors []CollectorConfig
+	// scheduled созданные сборщики по имени, переживают пересоздание агента вместе с pollCount
+	scheduled map[string]*scheduledCollector
+	// retryDelay задержка перед повторной отправкой пакета
+	retryDelay retry.DelayTypeFunc
 }
 
+// DefaultShutdownTimeout time the agent has to send the collected batches after it is stopped.
+const DefaultShutdownTimeout = 10 * time.Second
+
 func NewAgent(
 	secretKey string,
-	cryptoKey string,
+	encrypter *crypto.Encrypter,
+	tenantKey string,
 	address string,
 	pollDuration time.Duration,
 	reportDuration time.Duration,
@@ -36,50 +61,124 @@ func NewAgent(
 	isGrpcEnabled bool,
 ) *Agent {
 	return &Agent{
-		Address:        address,
-		PollDuration:   pollDuration,
-		ReportDuration: reportDuration,
-		LiveTime:       liveTime,
-		SecretKey:      secretKey,
-		CryptoKey:      cryptoKey,
-		RateLimit:      rateLimit,
-		grpcClient:     grpcClient,
-		isGrpcEnabled:  isGrpcEnabled,
+		Address:         address,
+		PollDuration:    pollDuration,
+		ReportDuration:  reportDuration,
+		LiveTime:        liveTime,
+		SecretKey:       secretKey,
+		Encrypter:       encrypter,
+		TenantKey:       tenantKey,
+		RateLimit:       rateLimit,
+		grpcClient:      grpcClient,
+		isGrpcEnabled:   isGrpcEnabled,
+		httpClient:      http.DefaultClient,
+		scheme:          "http",
+		ShutdownTimeout: DefaultShutdownTimeout,
+		pollCount:       &atomic.Int64{},
+		scheduled:       map[string]*scheduledCollector{},
+		retryDelay:      utils.RetryDelayType,
 	}
 }
 
-func (a Agent) Run() error {
-	// время жизни клиента для сбора метрик
-	ctx, cancelFunc := context.WithTimeout(context.Background(), a.LiveTime)
-	defer cancelFunc()
-	metricsCh, err := collectMetric(ctx, a.PollDuration, a.RateLimit)
-	if err != nil {
-		return fmt.Errorf("failed to collect metric: %w", err)
+// WithTLS sends http requests over HTTPS with the given TLS config,
+// the grpc client must be created with the same config by the caller.
+func (a *Agent) WithTLS(tlsConfig *tls.Config) *Agent {
+	if tlsConfig == nil {
+		return a
 	}
+	a.httpClient = &http.Client{Transport: &http.Transport{TLSClientConfig: tlsConfig}}
+	a.scheme = "https"
+	return a
+}
 
-	wg := sync.WaitGroup{}
-	for i := 0; i < a.RateLimit; i++ {
-		select {
-		case <-ctx.Done():
-			return ctx.Err()
-		default:
-			wg.Add(1)
-			go func() {
-				// откладываем уменьшение счетчика в WaitGroup, когда завершится горутина
-				defer wg.Done()
-				a.sendMetric(ctx, metricsCh)
-			}()
-		}
+// WithSpool keeps batches the agent failed to send in the spool and replays them once the server is back.
+func (a *Agent) WithSpool(spool *Spool) *Agent {
+	a.spool = spool
+	return a
+}
+
+// WithShutdownTimeout sets the time the agent has to send the collected batches after it is stopped.
+func (a *Agent) WithShutdownTimeout(timeout time.Duration) *Agent {
+	if timeout > 0 {
+		a.ShutdownTimeout = timeout
+	}
+	return a
+}
+
+// WithCountersFrom continues the counters and the collectors of the previous agent, so that PollCount
+// and the baselines of host counters such as disk and network bytes are not reset
+// when the agent is recreated with a reloaded config. The previous agent must be stopped before Run.
+func (a *Agent) WithCountersFrom(prev *Agent) *Agent {
+	if prev != nil {
+		a.pollCount = prev.pollCount
+		a.scheduled = prev.scheduled
 	}
+	return a
+}
+
+// WithCollectors runs only the given collectors with their schedules, see ParseCollectorConfigs.
+func (a *Agent) WithCollectors(configs []CollectorConfig) *Agent {
+	a.collectors = configs
+	return a
+}
 
-	quit := make(chan os.Signal, 1)
-	signal.Notify(quit, os.Interrupt, syscall.SIGTERM, syscall.SIGINT, syscall.SIGQUIT)
+// Run collects and sends metrics until ctx is done or the live time is over, zero LiveTime means no limit.
+// Then it stops collecting and sends the collected batches within ShutdownTimeout,
+// batches that can't be sent in time are kept in the spool.
+func (a *Agent) Run(ctx context.Context) error {
+	runCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	if a.LiveTime > 0 {
+		var cancelLiveTime context.CancelFunc
+		runCtx, cancelLiveTime = context.WithTimeout(runCtx, a.LiveTime)
+		defer cancelLiveTime()
+	}
 
-	go func() {
-		<-quit
-		cancelFunc()
-	}()
+	configs := a.collectors
+	if configs == nil {
+		for _, name := range Collectors() {
+			configs = append(configs, CollectorConfig{Name: name})
+		}
+	}
+	collectors, err := newScheduledCollectors(configs, a.PollDuration, a.scheduled)
+	if err != nil {
+		return fmt.Errorf("failed to create collectors: %w", err)
+	}
+	metricsCh := collectMetric(runCtx, a.PollDuration, a.RateLimit, a.pollCount, collectors)
 
+	wg := sync.WaitGroup{}
+	for i := 0; i < a.RateLimit; i++ {
+		wg.Add(1)
+		go func() {
+			// откладываем уменьшение счетчика в WaitGroup, когда завершится горутина
+			defer wg.Done()
+			a.sendMetric(runCtx, metricsCh)
+		}()
+	}
 	wg.Wait()
+
+	// на отправку оставшихся пакетов отводится отдельный срок, контекст запуска уже отменён
+	flushCtx, cancelFlush := context.WithTimeout(context.WithoutCancel(ctx), a.ShutdownTimeout)
+	defer cancelFlush()
+	a.flush(flushCtx, metricsCh)
 	return nil
 }
+
+// flush sends the batches left in the channel after collecting stopped and replays the spool.
+func (a *Agent) flush(ctx context.Context, metricsCh <-chan []*store.Metric) {
+	logger.Logger().Info("flushing collected metrics", zap.Int("spooled", a.spool.Len()))
+	for metrics := range metricsCh {
+		if err := a.deliver(ctx, metrics); err != nil {
+			logger.Logger().Error("failed to flush metrics", zap.Error(err))
+		}
+	}
+	if a.spool.Len() == 0 {
+		return
+	}
+	err := a.spool.Replay(func(batch []*store.Metric) error {
+		return a.sendRequest(ctx, batch)
+	})
+	if err != nil {
+		logger.Logger().Error("failed to replay spooled metrics", zap.Error(err))
+	}
+}
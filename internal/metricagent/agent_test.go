@@ -0,0 +1,57 @@
+package metricagent
+
+import (
+	"context"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/storage/mem"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/transport/http/handlers"
+	"github.com/andreevym/metric-collector/internal/transport/http/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAgent_RunFlushesOnShutdown(t *testing.T) {
+	storage := mem.NewStorage(nil)
+	m := middleware.NewMiddleware("", nil, nil)
+	ts := httptest.NewServer(handlers.NewRouter(handlers.NewServiceHandlers(storage, nil),
+		m.RequestGzipMiddleware, m.ResponseGzipMiddleware))
+	defer ts.Close()
+
+	// интервал отправки больше времени работы, поэтому метрики отправляются только при остановке
+	agent := newTestAgent(ts, "")
+	agent.PollDuration = 10 * time.Millisecond
+	agent.ReportDuration = time.Hour
+	agent.LiveTime = 0
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- agent.Run(ctx) }()
+	require.Eventually(t, func() bool { return agent.pollCount.Load() > 0 }, 5*time.Second, 10*time.Millisecond)
+	cancel()
+
+	select {
+	case err := <-done:
+		require.NoError(t, err)
+	case <-time.After(agent.ShutdownTimeout):
+		t.Fatal("agent didn't stop")
+	}
+	pollCount, err := storage.Read(context.Background(), "PollCount", store.MTypeCounter)
+	require.NoError(t, err)
+	require.Positive(t, *pollCount.Delta)
+
+	// агент, пересозданный после перечитывания конфига, продолжает счётчики
+	next := newTestAgent(ts, "").WithCountersFrom(agent)
+	require.Equal(t, agent.pollCount.Load(), next.pollCount.Load())
+	require.Equal(t, int64(0), newTestAgent(ts, "").pollCount.Load())
+}
+
+func TestAgent_RunLiveTime(t *testing.T) {
+	ts := httptest.NewServer(handlers.NewRouter(handlers.NewServiceHandlers(mem.NewStorage(nil), nil)))
+	defer ts.Close()
+	agent := newTestAgent(ts, "").WithShutdownTimeout(time.Second)
+	agent.LiveTime = 50 * time.Millisecond
+	require.NoError(t, agent.Run(context.Background()))
+}
@@ -2,93 +2,130 @@ package metricagent
 
 import (
 	"context"
+	"fmt"
 	"runtime"
+	"sync"
 	"sync/atomic"
 	"time"
 
 	"github.com/andreevym/metric-collector/internal/logger"
 	"github.com/andreevym/metric-collector/internal/storage/store"
-	"github.com/shirou/gopsutil/v3/cpu"
 	"github.com/shirou/gopsutil/v3/mem"
 	"go.uber.org/zap"
 )
 
+// Names of the built-in collectors.
+const (
+	// RuntimeCollector статистика памяти Go из пакета runtime и случайное значение RandomValue.
+	RuntimeCollector = "runtime"
+	// MemoryCollector общий и свободный объём оперативной памяти.
+	MemoryCollector = "memory"
+)
+
+func init() {
+	RegisterCollector(RuntimeCollector, func() Collector { return CollectorFunc(collectRuntime) })
+	RegisterCollector(MemoryCollector, func() Collector { return CollectorFunc(collectMemory) })
+}
+
+// collectMetric polls the collectors by their schedules until ctx is done, then closes the returned channel.
+// Every pollDuration the metrics collected since the previous batch are sent to the channel as a batch.
+// Once ctx is done, the metrics collected since the last batch are sent as the final batch,
+// the channel must be drained until it is closed.
 func collectMetric(
 	ctx context.Context,
 	pollDuration time.Duration,
 	rateLimit int,
-) (chan []*store.Metric, error) {
+	pollCountAtomic *atomic.Int64,
+	collectors []*scheduledCollector,
+) chan []*store.Metric {
 	// создаем буферизованный канал для отправки результатов
 	metricsCh := make(chan []*store.Metric, rateLimit)
 
+	wg := sync.WaitGroup{}
+	for _, c := range collectors {
+		wg.Add(1)
+		go func(c *scheduledCollector) {
+			defer wg.Done()
+			c.run(ctx)
+		}(c)
+	}
+
 	go func() {
 		defer close(metricsCh)
 
-		// pollCountAtomic (тип counter) — счётчик, увеличивающийся на 1
-		// при каждом обновлении метрики из пакета runtime (на каждый pollInterval — см. ниже).
-		var pollCountAtomic atomic.Int64
-		ticker := time.NewTicker(pollDuration)
-		for t := range ticker.C {
-			metrics := make([]*store.Metric, 0)
-
-			logger.Logger().Debug("pollLastMemStatByTicker", zap.String("ticker", t.String()))
-			memStats := runtime.MemStats{}
-			runtime.ReadMemStats(&memStats)
-
-			statMetrics, err := mapMemStatToMetrics(&memStats)
-			if err != nil {
-				return
-			}
-			metrics = append(metrics, statMetrics...)
-
-			pollCountAtomic.Add(1)
-			pollCount := pollCountAtomic.Load()
-			metrics = append(metrics, &store.Metric{
-				ID:    "PollCount",
-				MType: store.MTypeCounter,
-				Delta: &pollCount,
-			})
-
-			total, free, err := Memory()
-			if err != nil {
-				logger.Logger().Error("failed to get memory statistics",
-					zap.Error(err),
-				)
-				return
-			}
-			metrics = append(metrics, &store.Metric{
-				ID:    "TotalMemory",
-				MType: store.MTypeGauge,
-				Value: total,
-			})
-
-			metrics = append(metrics, &store.Metric{
-				ID:    "FreeMemory",
-				MType: store.MTypeGauge,
-				Value: free,
-			})
-			cpuUtilization, err := CPUUtilization()
-			if err != nil {
-				logger.Logger().Error("failed to get cpu utilization",
-					zap.Error(err),
-				)
-				return
-			}
-			metrics = append(metrics, &store.Metric{
-				ID:    "PollCount",
-				MType: store.MTypeGauge,
-				Value: cpuUtilization,
-			})
-
-			select {
-			case <-ctx.Done():
-				return
-			case metricsCh <- metrics:
-			}
+		// пакет, который не успели передать до остановки, отправляется вместе с последними результатами сборщиков
+		batches := [][]*store.Metric{sendBatches(ctx, pollDuration, pollCountAtomic, collectors, metricsCh)}
+		wg.Wait()
+		for _, c := range collectors {
+			batches = append(batches, c.take())
+		}
+		if final := mergeBatches(batches...); len(final) > 0 {
+			metricsCh <- final
 		}
 	}()
 
-	return metricsCh, nil
+	return metricsCh
+}
+
+// sendBatches sends a batch of the collected metrics every pollDuration until ctx is done,
+// it returns the batch that was not sent because ctx is done.
+func sendBatches(
+	ctx context.Context,
+	pollDuration time.Duration,
+	pollCountAtomic *atomic.Int64,
+	collectors []*scheduledCollector,
+	metricsCh chan<- []*store.Metric,
+) []*store.Metric {
+	// pollCountAtomic (тип counter) — счётчик, увеличивающийся на 1
+	// при каждом формировании пакета метрик (на каждый pollInterval — см. ниже).
+	ticker := time.NewTicker(pollDuration)
+	defer ticker.Stop()
+	for {
+		var t time.Time
+		select {
+		case <-ctx.Done():
+			return nil
+		case t = <-ticker.C:
+		}
+		logger.Logger().Debug("pollLastMemStatByTicker", zap.String("ticker", t.String()))
+
+		metrics := make([]*store.Metric, 0)
+		// сборщики опрашиваются независимо, в пакет попадают результаты, полученные после предыдущего пакета
+		for _, c := range collectors {
+			metrics = append(metrics, c.take()...)
+		}
+
+		pollCountAtomic.Add(1)
+		pollCount := pollCountAtomic.Load()
+		metrics = append(metrics, &store.Metric{
+			ID:    "PollCount",
+			MType: store.MTypeCounter,
+			Delta: &pollCount,
+		})
+
+		select {
+		case metricsCh <- metrics:
+		case <-ctx.Done():
+			return metrics
+		}
+	}
+}
+
+func collectRuntime(context.Context) ([]*store.Metric, error) {
+	memStats := runtime.MemStats{}
+	runtime.ReadMemStats(&memStats)
+	return mapMemStatToMetrics(&memStats)
+}
+
+func collectMemory(context.Context) ([]*store.Metric, error) {
+	total, free, err := Memory()
+	if err != nil {
+		return nil, fmt.Errorf("failed to get memory statistics: %w", err)
+	}
+	return []*store.Metric{
+		{ID: "TotalMemory", MType: store.MTypeGauge, Value: total},
+		{ID: "FreeMemory", MType: store.MTypeGauge, Value: free},
+	}, nil
 }
 
 // Memory received virtual memory
@@ -105,14 +142,3 @@ func Memory() (*float64, *float64, error) {
 	freeFloat := float64(v.Free)
 	return &totalFloat, &freeFloat, nil
 }
-
-// CPUUtilization точное количество — по числу CPU, определяемому во время исполнения
-// CPU utilization indicates the amount of load handled by individual processor
-// cores to run various programs on a computer. Definition.
-func CPUUtilization() (*float64, error) {
-	percent, err := cpu.Percent(time.Millisecond, false)
-	if err != nil {
-		return nil, err
-	}
-	return &percent[0], nil
-}
@@ -0,0 +1,290 @@
+package metricagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"go.uber.org/zap"
+)
+
+// Collector gathers a group of metrics of the host or the agent process.
+//
+// Collectors are registered by name with RegisterCollector and are polled independently,
+// each with its own interval and timeout, so a slow or failing collector doesn't delay the others.
+type Collector interface {
+	// Collect returns the current values of the metrics, it should return once ctx is done.
+	Collect(ctx context.Context) ([]*store.Metric, error)
+}
+
+// CollectorFunc adapts a function to the Collector interface.
+type CollectorFunc func(ctx context.Context) ([]*store.Metric, error)
+
+// Collect calls f(ctx).
+func (f CollectorFunc) Collect(ctx context.Context) ([]*store.Metric, error) {
+	return f(ctx)
+}
+
+// CollectorFactory creates a collector for a run of the agent.
+type CollectorFactory func() Collector
+
+var (
+	collectorsMu sync.RWMutex
+	collectors   = map[string]CollectorFactory{}
+)
+
+// RegisterCollector makes the collector available by name, it panics if the name is already registered.
+func RegisterCollector(name string, factory CollectorFactory) {
+	collectorsMu.Lock()
+	defer collectorsMu.Unlock()
+	if factory == nil {
+		panic("metricagent: collector factory of " + name + " is nil")
+	}
+	if _, ok := collectors[name]; ok {
+		panic("metricagent: collector " + name + " is already registered")
+	}
+	collectors[name] = factory
+}
+
+// Collectors returns the sorted names of the registered collectors.
+func Collectors() []string {
+	collectorsMu.RLock()
+	defer collectorsMu.RUnlock()
+	names := make([]string, 0, len(collectors))
+	for name := range collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func collectorFactory(name string) (CollectorFactory, bool) {
+	collectorsMu.RLock()
+	defer collectorsMu.RUnlock()
+	factory, ok := collectors[name]
+	return factory, ok
+}
+
+// CollectorConfig is the schedule of a collector.
+type CollectorConfig struct {
+	Name string
+	// Interval between polls, the poll interval of the agent if zero
+	Interval time.Duration
+	// Timeout of a poll, the interval if zero
+	Timeout time.Duration
+}
+
+// ParseCollectorConfigs parses the enabled collectors and their schedules.
+//
+// enabled is a comma separated list of collector names, empty means every registered collector,
+// a name prefixed with '-' disables the collector, e.g. "-cpu" enables every collector except cpu.
+// intervals and timeouts are comma separated "name=seconds" pairs, e.g. "cpu=5,memory=30".
+func ParseCollectorConfigs(enabled, intervals, timeouts string) ([]CollectorConfig, error) {
+	var names, disabled []string
+	for _, name := range strings.Split(enabled, ",") {
+		name = strings.TrimSpace(name)
+		if name == "" {
+			continue
+		}
+		if n, ok := strings.CutPrefix(name, "-"); ok {
+			disabled = append(disabled, n)
+			continue
+		}
+		names = append(names, name)
+	}
+	if len(names) == 0 {
+		names = Collectors()
+	}
+	for _, name := range append(names, disabled...) {
+		if _, ok := collectorFactory(name); !ok {
+			return nil, fmt.Errorf("unknown collector '%s', known collectors: %s", name, strings.Join(Collectors(), ","))
+		}
+	}
+
+	intervalOf, err := parseCollectorDurations(intervals)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse collector intervals: %w", err)
+	}
+	timeoutOf, err := parseCollectorDurations(timeouts)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse collector timeouts: %w", err)
+	}
+
+	configs := make([]CollectorConfig, 0, len(names))
+	seen := map[string]struct{}{}
+	for _, name := range names {
+		if _, ok := seen[name]; ok || contains(disabled, name) {
+			continue
+		}
+		seen[name] = struct{}{}
+		configs = append(configs, CollectorConfig{Name: name, Interval: intervalOf[name], Timeout: timeoutOf[name]})
+	}
+	return configs, nil
+}
+
+func parseCollectorDurations(s string) (map[string]time.Duration, error) {
+	durations := map[string]time.Duration{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		name, value, ok := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		if !ok {
+			return nil, fmt.Errorf("'%s' must look like collector=seconds", item)
+		}
+		if _, ok = collectorFactory(name); !ok {
+			return nil, fmt.Errorf("unknown collector '%s'", name)
+		}
+		seconds, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || seconds <= 0 {
+			return nil, fmt.Errorf("invalid number of seconds of collector '%s': '%s'", name, value)
+		}
+		durations[name] = time.Duration(seconds) * time.Second
+	}
+	return durations, nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+// errCollectorBusy the previous poll of the collector has not returned yet.
+var errCollectorBusy = errors.New("previous poll is still running")
+
+// scheduledCollector polls a collector by its schedule and keeps the results until they are taken.
+type scheduledCollector struct {
+	CollectorConfig
+	collector Collector
+
+	// running опрос, не уложившийся в таймаут, ещё выполняется, новый опрос не запускается
+	running atomic.Bool
+
+	mu      sync.Mutex
+	metrics []*store.Metric
+	fresh   bool
+}
+
+// newScheduledCollectors creates the collectors of configs. Collectors found in previous by name are reused
+// with the new schedule, so that their state such as baselines of host counters survives a reload of the agent,
+// the created collectors are added to previous. A nil previous creates every collector.
+func newScheduledCollectors(
+	configs []CollectorConfig,
+	pollDuration time.Duration,
+	previous map[string]*scheduledCollector,
+) ([]*scheduledCollector, error) {
+	scheduled := make([]*scheduledCollector, 0, len(configs))
+	for _, cfg := range configs {
+		factory, ok := collectorFactory(cfg.Name)
+		if !ok {
+			return nil, fmt.Errorf("unknown collector '%s'", cfg.Name)
+		}
+		if cfg.Interval <= 0 {
+			cfg.Interval = pollDuration
+		}
+		if cfg.Timeout <= 0 {
+			cfg.Timeout = cfg.Interval
+		}
+		// расписание меняется только между запусками агента, когда опросы сборщика не выполняются по расписанию
+		if s, ok := previous[cfg.Name]; ok {
+			s.CollectorConfig = cfg
+			scheduled = append(scheduled, s)
+			continue
+		}
+		s := &scheduledCollector{CollectorConfig: cfg, collector: factory()}
+		if previous != nil {
+			previous[cfg.Name] = s
+		}
+		scheduled = append(scheduled, s)
+	}
+	return scheduled, nil
+}
+
+// run polls the collector right away and then every interval until ctx is done.
+func (s *scheduledCollector) run(ctx context.Context) {
+	ticker := time.NewTicker(s.Interval)
+	defer ticker.Stop()
+	for {
+		if err := s.poll(ctx); err != nil && ctx.Err() == nil {
+			logger.Logger().Error("failed to collect metrics",
+				zap.String("collector", s.Name),
+				zap.Error(err),
+			)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll collects the metrics within the timeout, a panic of the collector is returned as an error.
+func (s *scheduledCollector) poll(ctx context.Context) error {
+	if !s.running.CompareAndSwap(false, true) {
+		return errCollectorBusy
+	}
+	ctx, cancel := context.WithTimeout(ctx, s.Timeout)
+	defer cancel()
+
+	type result struct {
+		metrics []*store.Metric
+		err     error
+	}
+	resultCh := make(chan result, 1)
+	go func() {
+		var r result
+		defer func() {
+			if p := recover(); p != nil {
+				r = result{err: fmt.Errorf("collector panicked: %v", p)}
+			}
+			s.running.Store(false)
+			resultCh <- r
+		}()
+		r.metrics, r.err = s.collector.Collect(ctx)
+	}()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("collector timed out after %s: %w", s.Timeout, ctx.Err())
+	case r := <-resultCh:
+		if r.err != nil {
+			return r.err
+		}
+		s.mu.Lock()
+		// результаты, не попавшие в пакет, объединяются: приращения счётчиков суммируются
+		if s.fresh {
+			s.metrics = mergeBatches(s.metrics, r.metrics)
+		} else {
+			s.metrics = r.metrics
+		}
+		s.fresh = true
+		s.mu.Unlock()
+		return nil
+	}
+}
+
+// take returns the metrics collected since the previous call, merged like spooled batches.
+func (s *scheduledCollector) take() []*store.Metric {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if !s.fresh {
+		return nil
+	}
+	s.fresh = false
+	return s.metrics
+}
@@ -0,0 +1,199 @@
+package metricagent
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/stretchr/testify/require"
+)
+
+func init() {
+	RegisterCollector("test-ok", func() Collector {
+		return CollectorFunc(func(context.Context) ([]*store.Metric, error) {
+			value := 1.0
+			return []*store.Metric{{ID: "TestValue", MType: store.MTypeGauge, Value: &value}}, nil
+		})
+	})
+	RegisterCollector("test-counter", func() Collector {
+		return CollectorFunc(func(context.Context) ([]*store.Metric, error) {
+			delta := int64(1)
+			return []*store.Metric{{ID: "TestCounter", MType: store.MTypeCounter, Delta: &delta}}, nil
+		})
+	})
+	RegisterCollector("test-stateful", func() Collector {
+		// сборщик возвращает число своих опросов
+		var polls int64
+		return CollectorFunc(func(context.Context) ([]*store.Metric, error) {
+			polls++
+			delta := polls
+			return []*store.Metric{{ID: "TestPolls", MType: store.MTypeCounter, Delta: &delta}}, nil
+		})
+	})
+	RegisterCollector("test-failing", func() Collector {
+		return CollectorFunc(func(context.Context) ([]*store.Metric, error) {
+			return nil, errors.New("broken")
+		})
+	})
+	RegisterCollector("test-panicking", func() Collector {
+		return CollectorFunc(func(context.Context) ([]*store.Metric, error) {
+			panic("broken")
+		})
+	})
+	RegisterCollector("test-hanging", func() Collector {
+		return CollectorFunc(func(ctx context.Context) ([]*store.Metric, error) {
+			// сборщик не учитывает отмену контекста
+			time.Sleep(time.Hour)
+			return nil, nil
+		})
+	})
+}
+
+func TestRegisterCollector(t *testing.T) {
+	require.Subset(t, Collectors(), []string{RuntimeCollector, MemoryCollector, CPUCollector, "test-ok"})
+	require.Panics(t, func() { RegisterCollector(RuntimeCollector, func() Collector { return nil }) })
+	require.Panics(t, func() { RegisterCollector("test-nil", nil) })
+}
+
+func TestParseCollectorConfigs(t *testing.T) {
+	configs, err := ParseCollectorConfigs("runtime, cpu,runtime", "cpu=5", "cpu=2,runtime=1")
+	require.NoError(t, err)
+	require.Equal(t, []CollectorConfig{
+		{Name: RuntimeCollector, Timeout: time.Second},
+		{Name: CPUCollector, Interval: 5 * time.Second, Timeout: 2 * time.Second},
+	}, configs)
+
+	configs, err = ParseCollectorConfigs("-cpu,-test-hanging", "", "")
+	require.NoError(t, err)
+	var names []string
+	for _, c := range configs {
+		names = append(names, c.Name)
+	}
+	require.Contains(t, names, RuntimeCollector)
+	require.NotContains(t, names, CPUCollector)
+	require.NotContains(t, names, "test-hanging")
+
+	for _, tt := range [][3]string{
+		{"unknown", "", ""},
+		{"-unknown", "", ""},
+		{"", "unknown=1", ""},
+		{"", "cpu", ""},
+		{"", "cpu=0", ""},
+		{"", "", "cpu=soon"},
+	} {
+		_, err = ParseCollectorConfigs(tt[0], tt[1], tt[2])
+		require.Error(t, err, tt)
+	}
+}
+
+func TestCollectMetric_IsolatesBrokenCollectors(t *testing.T) {
+	configs := []CollectorConfig{{Name: "test-failing"}, {Name: "test-panicking"}, {Name: "test-hanging"}, {Name: "test-ok"}}
+	collectors, err := newScheduledCollectors(configs, 10*time.Millisecond, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	var pollCount atomic.Int64
+	metricsCh := collectMetric(ctx, 10*time.Millisecond, 1, &pollCount, collectors)
+
+	// сломанные сборщики не мешают остальным, и каждый пакет содержит PollCount
+	for i := 0; i < 3; i++ {
+		metrics := <-metricsCh
+		ids := map[string]string{}
+		for _, m := range metrics {
+			ids[m.ID] = m.MType
+		}
+		require.Equal(t, store.MTypeCounter, ids["PollCount"])
+		if _, ok := ids["TestValue"]; ok {
+			cancel()
+			for range metricsCh {
+			}
+			return
+		}
+	}
+	t.Fatal("metrics of the working collector are not collected")
+}
+
+func TestCollectMetric_SendsFinalBatch(t *testing.T) {
+	collectors, err := newScheduledCollectors([]CollectorConfig{{Name: "test-ok"}}, time.Hour, nil)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	var pollCount atomic.Int64
+	// пакет по таймеру не формируется, сборщик опрашивается сразу после запуска
+	metricsCh := collectMetric(ctx, time.Hour, 1, &pollCount, collectors)
+	require.Eventually(t, func() bool {
+		collectors[0].mu.Lock()
+		defer collectors[0].mu.Unlock()
+		return collectors[0].fresh
+	}, time.Second, time.Millisecond)
+	cancel()
+
+	// результаты, собранные после последнего пакета, отправляются при остановке
+	var batches [][]*store.Metric
+	for metrics := range metricsCh {
+		batches = append(batches, metrics)
+	}
+	require.Len(t, batches, 1)
+	require.Len(t, batches[0], 1)
+	require.Equal(t, "TestValue", batches[0][0].ID)
+}
+
+func TestNewScheduledCollectors_ReusesPrevious(t *testing.T) {
+	previous := map[string]*scheduledCollector{}
+	collectors, err := newScheduledCollectors([]CollectorConfig{{Name: "test-stateful"}}, time.Second, previous)
+	require.NoError(t, err)
+	require.NoError(t, collectors[0].poll(context.Background()))
+	require.Len(t, collectors[0].take(), 1)
+
+	// после перечитывания конфига сборщик сохраняет состояние и получает новое расписание
+	reloaded, err := newScheduledCollectors([]CollectorConfig{{Name: "test-stateful", Interval: 5 * time.Second}}, time.Second, previous)
+	require.NoError(t, err)
+	require.Same(t, collectors[0], reloaded[0])
+	require.Equal(t, 5*time.Second, reloaded[0].Interval)
+	require.NoError(t, reloaded[0].poll(context.Background()))
+	metrics := reloaded[0].take()
+	require.Len(t, metrics, 1)
+	require.Equal(t, int64(2), *metrics[0].Delta)
+
+	// агент, пересозданный после перечитывания конфига, использует сборщики предыдущего агента
+	agent := NewAgent("", nil, "", "", time.Second, time.Second, 0, 1, nil, false)
+	agent.scheduled = previous
+	next := NewAgent("", nil, "", "", time.Second, time.Second, 0, 1, nil, false).WithCountersFrom(agent)
+	collectors, err = newScheduledCollectors([]CollectorConfig{{Name: "test-stateful"}}, time.Second, next.scheduled)
+	require.NoError(t, err)
+	require.Same(t, reloaded[0], collectors[0])
+}
+
+func TestScheduledCollector_Poll(t *testing.T) {
+	collectors, err := newScheduledCollectors([]CollectorConfig{{Name: "test-hanging", Timeout: 10 * time.Millisecond}}, time.Second, nil)
+	require.NoError(t, err)
+	c := collectors[0]
+	require.Equal(t, time.Second, c.Interval)
+
+	require.ErrorIs(t, c.poll(context.Background()), context.DeadlineExceeded)
+	// зависший опрос не запускается повторно
+	require.ErrorIs(t, c.poll(context.Background()), errCollectorBusy)
+	require.Nil(t, c.take())
+
+	collectors, err = newScheduledCollectors([]CollectorConfig{{Name: "test-panicking"}, {Name: "test-ok"}}, time.Second, nil)
+	require.NoError(t, err)
+	require.ErrorContains(t, collectors[0].poll(context.Background()), "panicked")
+	// после паники сборщик опрашивается снова
+	require.ErrorContains(t, collectors[0].poll(context.Background()), "panicked")
+	require.NoError(t, collectors[1].poll(context.Background()))
+	require.Len(t, collectors[1].take(), 1)
+	require.Nil(t, collectors[1].take(), "metrics are taken once")
+
+	// приращения счётчиков опросов, не попавших в пакет, суммируются
+	collectors, err = newScheduledCollectors([]CollectorConfig{{Name: "test-counter"}}, time.Second, nil)
+	require.NoError(t, err)
+	require.NoError(t, collectors[0].poll(context.Background()))
+	require.NoError(t, collectors[0].poll(context.Background()))
+	metrics := collectors[0].take()
+	require.Len(t, metrics, 1)
+	require.Equal(t, int64(2), *metrics[0].Delta)
+}
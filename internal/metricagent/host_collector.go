@@ -0,0 +1,199 @@
+package metricagent
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/shirou/gopsutil/v3/disk"
+	"github.com/shirou/gopsutil/v3/load"
+	"github.com/shirou/gopsutil/v3/net"
+	"github.com/shirou/gopsutil/v3/process"
+)
+
+// Names of the host collectors.
+const (
+	// CPUCollector загрузка каждого ядра процессора в процентах, CPUutilization1..N.
+	CPUCollector = "cpu"
+	// LoadCollector средняя загрузка системы за 1, 5 и 15 минут.
+	LoadCollector = "load"
+	// DiskCollector заполненность и ввод-вывод дисков по точкам монтирования.
+	DiskCollector = "disk"
+	// NetCollector переданные байты и ошибки по сетевым интерфейсам.
+	NetCollector = "net"
+	// ProcessCollector открытые файловые дескрипторы процесса агента.
+	ProcessCollector = "process"
+)
+
+func init() {
+	RegisterCollector(CPUCollector, func() Collector { return &cpuCollector{} })
+	RegisterCollector(LoadCollector, func() Collector { return CollectorFunc(collectLoad) })
+	RegisterCollector(DiskCollector, func() Collector { return &diskCollector{counters: newCounterDeltas()} })
+	RegisterCollector(NetCollector, func() Collector { return &netCollector{counters: newCounterDeltas()} })
+	RegisterCollector(ProcessCollector, func() Collector { return CollectorFunc(collectProcess) })
+}
+
+// cpuCollector reports the utilization of every core between two polls,
+// the first poll reports the utilization since boot.
+type cpuCollector struct {
+	previous []cpu.TimesStat
+}
+
+func (c *cpuCollector) Collect(ctx context.Context) ([]*store.Metric, error) {
+	times, err := cpu.TimesWithContext(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cpu times: %w", err)
+	}
+	metrics := make([]*store.Metric, 0, len(times))
+	for i, t := range times {
+		var previous cpu.TimesStat
+		// число ядер может измениться, например при подключении ядер виртуальной машины
+		if len(c.previous) == len(times) {
+			previous = c.previous[i]
+		}
+		metrics = mustAppendGaugeMetricFloat64(metrics, "CPUutilization"+strconv.Itoa(i+1), cpuUtilization(previous, t))
+	}
+	c.previous = times
+	return metrics, nil
+}
+
+// cpuUtilization returns the percentage of time the core was busy between the two samples.
+func cpuUtilization(previous, current cpu.TimesStat) float64 {
+	idle := func(t cpu.TimesStat) float64 { return t.Idle + t.Iowait }
+	total := func(t cpu.TimesStat) float64 {
+		return t.User + t.System + t.Idle + t.Nice + t.Iowait + t.Irq + t.Softirq + t.Steal
+	}
+	totalDelta := total(current) - total(previous)
+	if totalDelta <= 0 {
+		return 0
+	}
+	busy := (totalDelta - (idle(current) - idle(previous))) / totalDelta * 100
+	return min(max(busy, 0), 100)
+}
+
+func collectLoad(ctx context.Context) ([]*store.Metric, error) {
+	avg, err := load.AvgWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get load average: %w", err)
+	}
+	metrics := make([]*store.Metric, 0, 3)
+	metrics = mustAppendGaugeMetricFloat64(metrics, "Load1", avg.Load1)
+	metrics = mustAppendGaugeMetricFloat64(metrics, "Load5", avg.Load5)
+	metrics = mustAppendGaugeMetricFloat64(metrics, "Load15", avg.Load15)
+	return metrics, nil
+}
+
+// diskCollector reports usage of every mounted disk and bytes read and written since the previous poll.
+type diskCollector struct {
+	counters *counterDeltas
+}
+
+func (c *diskCollector) Collect(ctx context.Context) ([]*store.Metric, error) {
+	partitions, err := disk.PartitionsWithContext(ctx, false)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get disk partitions: %w", err)
+	}
+	ioCounters, err := disk.IOCountersWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get disk io counters: %w", err)
+	}
+
+	var metrics []*store.Metric
+	seen := map[string]struct{}{}
+	for _, p := range partitions {
+		label := metricLabel(p.Mountpoint)
+		if _, ok := seen[label]; ok {
+			continue
+		}
+		seen[label] = struct{}{}
+
+		usage, err := disk.UsageWithContext(ctx, p.Mountpoint)
+		if err != nil {
+			// точка монтирования может быть недоступна, например сетевой диск, остальные диски всё равно учитываются
+			continue
+		}
+		metrics = mustAppendGaugeMetricUint64(metrics, "DiskTotal."+label, usage.Total)
+		metrics = mustAppendGaugeMetricUint64(metrics, "DiskFree."+label, usage.Free)
+		metrics = mustAppendGaugeMetricUint64(metrics, "DiskUsed."+label, usage.Used)
+		metrics = mustAppendGaugeMetricFloat64(metrics, "DiskUsedPercent."+label, usage.UsedPercent)
+
+		io, ok := ioCounters[filepath.Base(p.Device)]
+		if !ok {
+			continue
+		}
+		metrics = c.counters.append(metrics, "DiskReadBytes."+label, io.ReadBytes)
+		metrics = c.counters.append(metrics, "DiskWriteBytes."+label, io.WriteBytes)
+	}
+	return metrics, nil
+}
+
+// netCollector reports bytes and errors of every network interface since the previous poll.
+type netCollector struct {
+	counters *counterDeltas
+}
+
+func (c *netCollector) Collect(ctx context.Context) ([]*store.Metric, error) {
+	interfaces, err := net.IOCountersWithContext(ctx, true)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get network io counters: %w", err)
+	}
+	var metrics []*store.Metric
+	for _, i := range interfaces {
+		label := metricLabel(i.Name)
+		metrics = c.counters.append(metrics, "NetBytesSent."+label, i.BytesSent)
+		metrics = c.counters.append(metrics, "NetBytesRecv."+label, i.BytesRecv)
+		metrics = c.counters.append(metrics, "NetErrorsIn."+label, i.Errin)
+		metrics = c.counters.append(metrics, "NetErrorsOut."+label, i.Errout)
+	}
+	return metrics, nil
+}
+
+func collectProcess(ctx context.Context) ([]*store.Metric, error) {
+	p, err := process.NewProcessWithContext(ctx, int32(os.Getpid()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to get agent process: %w", err)
+	}
+	fds, err := p.NumFDsWithContext(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get open file descriptors: %w", err)
+	}
+	return mustAppendGaugeMetricFloat64(nil, "OpenFDs", float64(fds)), nil
+}
+
+// counterDeltas turns cumulative counters of the host into counter metrics with the increment
+// since the previous poll. The first value of a counter and a value after a reset only set the baseline.
+type counterDeltas struct {
+	previous map[string]uint64
+}
+
+func newCounterDeltas() *counterDeltas {
+	return &counterDeltas{previous: map[string]uint64{}}
+}
+
+func (d *counterDeltas) append(metrics []*store.Metric, id string, value uint64) []*store.Metric {
+	previous, ok := d.previous[id]
+	d.previous[id] = value
+	if !ok || value < previous {
+		return metrics
+	}
+	delta := int64(value - previous)
+	return append(metrics, &store.Metric{ID: id, MType: store.MTypeCounter, Delta: &delta})
+}
+
+// labelRegexp characters not allowed in metric IDs by the server.
+var labelRegexp = regexp.MustCompile(`[^A-Za-z0-9_.:-]+`)
+
+// metricLabel turns a mount point or an interface name into a part of a metric ID, e.g. "/var/lib" into "var_lib".
+func metricLabel(name string) string {
+	label := strings.Trim(labelRegexp.ReplaceAllString(name, "_"), "_")
+	if label == "" {
+		return "root"
+	}
+	return label
+}
@@ -0,0 +1,75 @@
+package metricagent
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/stretchr/testify/require"
+)
+
+// collectTwice polls a new collector twice, so that counters have a baseline, and returns the metrics by ID.
+func collectTwice(t *testing.T, name string) map[string]*store.Metric {
+	t.Helper()
+	factory, ok := collectorFactory(name)
+	require.True(t, ok)
+	c := factory()
+	_, err := c.Collect(context.Background())
+	require.NoError(t, err)
+	metrics, err := c.Collect(context.Background())
+	require.NoError(t, err)
+
+	byID := map[string]*store.Metric{}
+	for _, m := range metrics {
+		require.NotContains(t, byID, m.ID)
+		byID[m.ID] = m
+	}
+	return byID
+}
+
+func TestHostCollectors(t *testing.T) {
+	t.Run(CPUCollector, func(t *testing.T) {
+		metrics := collectTwice(t, CPUCollector)
+		require.Contains(t, metrics, "CPUutilization1")
+		require.NotContains(t, metrics, "PollCount")
+		for _, m := range metrics {
+			require.True(t, strings.HasPrefix(m.ID, "CPUutilization"), m.ID)
+			require.Equal(t, store.MTypeGauge, m.MType)
+			require.GreaterOrEqual(t, *m.Value, 0.0)
+			require.LessOrEqual(t, *m.Value, 100.0)
+		}
+	})
+	t.Run(LoadCollector, func(t *testing.T) {
+		metrics := collectTwice(t, LoadCollector)
+		for _, id := range []string{"Load1", "Load5", "Load15"} {
+			require.Contains(t, metrics, id)
+			require.GreaterOrEqual(t, *metrics[id].Value, 0.0)
+		}
+	})
+	t.Run(DiskCollector, func(t *testing.T) {
+		metrics := collectTwice(t, DiskCollector)
+		var mounts int
+		for id, m := range metrics {
+			if label, ok := strings.CutPrefix(id, "DiskTotal."); ok {
+				mounts++
+				require.Positive(t, *m.Value)
+				require.Contains(t, metrics, "DiskUsedPercent."+label)
+			}
+		}
+		if mounts == 0 {
+			t.Skip("no disks are mounted")
+		}
+	})
+	t.Run(NetCollector, func(t *testing.T) {
+		metrics := collectTwice(t, NetCollector)
+		require.Contains(t, metrics, "NetBytesSent.lo")
+		require.Equal(t, store.MTypeCounter, metrics["NetBytesRecv.lo"].MType)
+		require.GreaterOrEqual(t, *metrics["NetErrorsIn.lo"].Delta, int64(0))
+	})
+	t.Run(ProcessCollector, func(t *testing.T) {
+		metrics := collectTwice(t, ProcessCollector)
+		require.Contains(t, metrics, "OpenFDs")
+		require.Positive(t, *metrics["OpenFDs"].Value)
+	})
+}
@@ -0,0 +1,38 @@
+package metricagent
+
+import (
+	"testing"
+
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/shirou/gopsutil/v3/cpu"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCPUUtilization(t *testing.T) {
+	previous := cpu.TimesStat{User: 10, System: 5, Idle: 80, Iowait: 5}
+	current := cpu.TimesStat{User: 40, System: 15, Idle: 120, Iowait: 25}
+	require.InDelta(t, 40.0, cpuUtilization(previous, current), 1e-9)
+	require.InDelta(t, 15.0, cpuUtilization(cpu.TimesStat{}, previous), 1e-9)
+	require.Equal(t, 0.0, cpuUtilization(current, current))
+}
+
+func TestCounterDeltas(t *testing.T) {
+	d := newCounterDeltas()
+	require.Empty(t, d.append(nil, "NetBytesSent.eth0", 100), "the first value is the baseline")
+
+	metrics := d.append(nil, "NetBytesSent.eth0", 150)
+	require.Len(t, metrics, 1)
+	require.Equal(t, store.MTypeCounter, metrics[0].MType)
+	require.Equal(t, int64(50), *metrics[0].Delta)
+
+	require.Empty(t, d.append(nil, "NetBytesSent.eth0", 10), "the counter is reset")
+	require.Equal(t, int64(5), *d.append(nil, "NetBytesSent.eth0", 15)[0].Delta)
+}
+
+func TestMetricLabel(t *testing.T) {
+	require.Equal(t, "root", metricLabel("/"))
+	require.Equal(t, "var_lib", metricLabel("/var/lib/"))
+	require.Equal(t, "C:", metricLabel("C:"))
+	require.Equal(t, "eth0.100", metricLabel("eth0.100"))
+	require.Equal(t, "Local_Area_Connection", metricLabel("Local Area Connection*"))
+}
@@ -12,9 +12,3 @@ func TestMemory(t *testing.T) {
 	require.NotNil(t, total)
 	require.NotNil(t, free)
 }
-
-func TestCPUutilization1(t *testing.T) {
-	cpu, err := CPUUtilization()
-	require.NoError(t, err)
-	require.NotNil(t, cpu)
-}
@@ -4,49 +4,108 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/andreevym/metric-collector/internal/identity"
+	grpctransport "github.com/andreevym/metric-collector/internal/transport/grpc"
 	"github.com/andreevym/metric-collector/internal/transport/grpc/proto"
 	"io"
 	"net"
 	"net/http"
+	"net/url"
 	"time"
 
 	"github.com/andreevym/metric-collector/internal/compressor"
-	"github.com/andreevym/metric-collector/internal/crypto"
 	"github.com/andreevym/metric-collector/internal/hash"
 	"github.com/andreevym/metric-collector/internal/logger"
 	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/tenant"
 	"github.com/andreevym/metric-collector/internal/transport/http/handlers"
-	"github.com/andreevym/metric-collector/internal/utils"
 	"github.com/avast/retry-go"
 	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
 )
 
 const retryAttempts = 3
 
-// sendLastMemStats send metric to server by ticker and address
+// SpoolSizeMetricID ID of the gauge with the number of batches waiting in the spool.
+const SpoolSizeMetricID = "SpoolSize"
+
+// sendMetric sends a collected batch every ReportDuration until ctx is done or the channel is closed.
 func (a Agent) sendMetric(
 	ctx context.Context,
 	inputCh chan []*store.Metric,
 ) {
 	ticker := time.NewTicker(a.ReportDuration)
-	for range ticker.C {
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
 		select {
 		case <-ctx.Done():
 			return
 		case metrics, ok := <-inputCh:
-			if ok {
-				err := a.sendRequest(ctx, metrics)
-				if err != nil {
-					logger.Logger().Error("failed to send request", zap.Error(err))
-					break
-				}
+			if !ok {
+				return
+			}
+			if err := a.deliver(ctx, metrics); err != nil {
+				logger.Logger().Error("failed to send request", zap.Error(err))
 			}
 		default:
 		}
 	}
 }
 
+// deliver sends the batch to the server. With the spool the batch is queued if the server is unavailable,
+// and the queued batches are replayed in order together with the next batch once the server recovers.
+func (a Agent) deliver(ctx context.Context, metrics []*store.Metric) error {
+	if a.spool == nil {
+		return a.sendRequest(ctx, metrics)
+	}
+	spoolSize := float64(a.spool.Len())
+	metrics = append(metrics, &store.Metric{
+		ID:    SpoolSizeMetricID,
+		MType: store.MTypeGauge,
+		Value: &spoolSize,
+	})
+	if spoolSize == 0 {
+		err := a.sendRequest(ctx, metrics)
+		if err == nil {
+			return nil
+		}
+		if isRejected(ctx, err) {
+			// сервер не примет пакет и при повторной отправке, поэтому он не блокирует очередь
+			logger.Logger().Error("drop batch rejected by the server", zap.Int("metrics", len(metrics)), zap.Error(err))
+			return fmt.Errorf("metrics are dropped: %w", err)
+		}
+		if spoolErr := a.spool.Push(metrics); spoolErr != nil {
+			return errors.Join(err, fmt.Errorf("failed to spool metrics: %w", spoolErr))
+		}
+		return fmt.Errorf("metrics are spooled: %w", err)
+	}
+	// пакет ставится в конец очереди, чтобы значения метрик дошли до сервера в порядке сбора
+	if err := a.spool.Push(metrics); err != nil {
+		return fmt.Errorf("failed to spool metrics: %w", err)
+	}
+	if err := a.spool.Replay(func(batch []*store.Metric) error {
+		err := a.sendRequest(ctx, batch)
+		if isRejected(ctx, err) {
+			return fmt.Errorf("%w: %w", errBatchRejected, err)
+		}
+		return err
+	}); err != nil {
+		return fmt.Errorf("failed to replay spooled metrics: %w", err)
+	}
+	return nil
+}
+
 func (a Agent) sendRequest(
 	ctx context.Context,
 	metric []*store.Metric,
@@ -57,13 +116,13 @@ func (a Agent) sendRequest(
 			if a.isGrpcEnabled {
 				err = a.grpcUpdate(ctx, metric)
 			} else {
-				err = a.httpUpdate(metric)
+				err = a.httpUpdate(ctx, metric)
 			}
-			// don't need to retry this error
-			return nil
+			return err
 		},
+		retry.RetryIf(isRetriable),
 		retry.Attempts(retryAttempts),
-		retry.DelayType(utils.RetryDelayType),
+		retry.DelayType(a.retryDelay),
 		retry.OnRetry(func(n uint, err error) {
 			logger.Logger().Error("error to send request",
 				zap.Uint("currentAttempt", n),
@@ -101,11 +160,32 @@ func (a Agent) grpcUpdate(ctx context.Context, metric []*store.Metric) error {
 		}
 		updatesRequest.Metrics = append(updatesRequest.Metrics, reqMetric)
 	}
-	_, err := a.grpcClient.Updates(ctx, updatesRequest)
-	return err
+	ip, err := identifyIP()
+	if err != nil {
+		logger.Logger().Error("failed to identify IP", zap.Error(err))
+		return fmt.Errorf("failed to identify IP: %w", err)
+	}
+	if ip != nil {
+		ctx = metadata.AppendToOutgoingContext(ctx, identity.RealIPMetadataKey, ip.String())
+	}
+	if a.TenantKey != "" {
+		ctx = metadata.AppendToOutgoingContext(ctx, tenant.MetadataKey, a.TenantKey)
+	}
+	if len(a.SecretKey) != 0 {
+		ctx, err = grpctransport.SignRequest(ctx, proto.MetricCollector_Updates_FullMethodName, updatesRequest, a.SecretKey)
+		if err != nil {
+			return fmt.Errorf("failed to sign request: %w", err)
+		}
+	}
+	var header metadata.MD
+	resp, err := a.grpcClient.Updates(ctx, updatesRequest, grpc.UseCompressor(gzip.Name), grpc.Header(&header))
+	if err != nil || len(a.SecretKey) == 0 {
+		return err
+	}
+	return grpctransport.VerifyResponse(resp, header, a.SecretKey)
 }
 
-func (a Agent) httpUpdate(metric []*store.Metric) error {
+func (a Agent) httpUpdate(ctx context.Context, metric []*store.Metric) error {
 	metricBytes, err := json.Marshal(metric)
 	if err != nil {
 		logger.Logger().Error("failed to marshal request body", zap.Error(err))
@@ -118,22 +198,20 @@ func (a Agent) httpUpdate(metric []*store.Metric) error {
 		return err
 	}
 
-	var b []byte
-	if a.CryptoKey != "" {
-		encodedBytes, err := crypto.Encode(a.CryptoKey, string(compressedBytes))
+	b := compressedBytes
+	if a.Encrypter != nil {
+		b, err = a.Encrypter.Encrypt(compressedBytes)
 		if err != nil {
-			logger.Logger().Error("failed to encode request body", zap.Error(err))
-			return fmt.Errorf("failed to encode request body: %w", err)
+			logger.Logger().Error("failed to encrypt request body", zap.Error(err))
+			return fmt.Errorf("failed to encrypt request body: %w", err)
 		}
-		b = []byte(encodedBytes)
-	} else {
-		b = compressedBytes
 	}
 
 	var request *http.Request
-	request, err = http.NewRequest(
+	request, err = http.NewRequestWithContext(
+		ctx,
 		http.MethodPost,
-		fmt.Sprintf("http://%s/updates/", a.Address),
+		fmt.Sprintf("%s://%s/updates/", a.scheme, a.Address),
 		bytes.NewBuffer(b),
 	)
 	if err != nil {
@@ -154,24 +232,33 @@ func (a Agent) httpUpdate(metric []*store.Metric) error {
 	request.Header.Set("Content-Type", handlers.UpdateMetricContentType)
 	request.Header.Set("Accept-Encoding", compressor.AcceptEncoding)
 	request.Header.Set("Content-Encoding", compressor.ContentEncoding)
+	if a.TenantKey != "" {
+		request.Header.Set(tenant.Header, a.TenantKey)
+	}
 	if len(a.SecretKey) != 0 {
-		request.Header.Set("HashSHA256", hash.EncodeHash(b, a.SecretKey))
+		if err = hash.SignHTTPRequest(request, b, a.SecretKey); err != nil {
+			return fmt.Errorf("failed to sign request: %w", err)
+		}
 	}
 	var resp *http.Response
-	resp, err = http.DefaultClient.Do(request)
+	resp, err = a.httpClient.Do(request)
 	if err != nil {
 		return err
 	}
 	if resp == nil {
 		return nil
 	}
-	if isRetriableStatus(resp.StatusCode) {
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
 		logger.Logger().Error("error response status",
 			zap.String("request.URL", request.URL.String()),
-			zap.Error(err),
+			zap.String("response.status", resp.Status),
 		)
-		return fmt.Errorf("response status %s code %d",
-			resp.Status, resp.StatusCode)
+		// тело читается до конца, чтобы соединение переиспользовалось
+		_, _ = io.Copy(io.Discard, resp.Body)
+		if err = resp.Body.Close(); err != nil {
+			logger.Logger().Error("failed to close response body", zap.Error(err))
+		}
+		return &statusError{code: resp.StatusCode, status: resp.Status}
 	}
 
 	var respBodyBytes []byte
@@ -186,19 +273,78 @@ func (a Agent) httpUpdate(metric []*store.Metric) error {
 		// don't need to retry this error
 		return nil
 	}
+	err = resp.Body.Close()
+	if err != nil {
+		logger.Logger().Error("failed to close response body", zap.Error(err))
+	}
+	if resp.Header.Get("Content-Encoding") == compressor.ContentEncoding {
+		respBodyBytes, err = compressor.Decompress(respBodyBytes)
+		if err != nil {
+			return fmt.Errorf("failed to decompress response body: %w", err)
+		}
+	}
 	logger.Logger().Debug("read response body",
 		zap.String("request.URL", request.URL.String()),
 		zap.String("request.body", string(b)),
 		zap.String("response.status", resp.Status),
 		zap.String("response.decompressed_body", string(respBodyBytes)),
 	)
-	err = resp.Body.Close()
-	if err != nil {
-		logger.Logger().Error("failed to close response body", zap.Error(err))
+	if len(a.SecretKey) != 0 && !hash.Equal(respBodyBytes, a.SecretKey, resp.Header.Get(hash.Header)) {
+		logger.Logger().Error("response signature mismatch",
+			zap.String("request.URL", request.URL.String()),
+			zap.String("response.status", resp.Status),
+		)
+		return fmt.Errorf("response signature mismatch, status %s", resp.Status)
 	}
 	return nil
 }
 
+// statusError is a response of the server with a non-2xx status,
+// the batch is not accepted and must be spooled.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return fmt.Sprintf("response status %s code %d", e.status, e.code)
+}
+
+// isRetriable reports whether the request may succeed if it is sent again right away:
+// the server is unreachable, overloaded or limits the agent.
+func isRetriable(err error) bool {
+	var statusErr *statusError
+	if errors.As(err, &statusErr) {
+		return isRetriableStatus(statusErr.code)
+	}
+	var urlErr *url.Error
+	if errors.As(err, &urlErr) {
+		return true
+	}
+	if s, ok := status.FromError(err); ok {
+		switch s.Code() {
+		case codes.Unavailable, codes.ResourceExhausted, codes.DeadlineExceeded, codes.Aborted:
+			return true
+		}
+	}
+	return false
+}
+
+// isRejected reports whether the server won't accept the batch however many times it is sent,
+// e.g. a metric name is invalid. Errors of a cancelled ctx are not rejections, the batch is spooled on shutdown.
+func isRejected(ctx context.Context, err error) bool {
+	return err != nil && ctx.Err() == nil && !isRetriable(err)
+}
+
 func isRetriableStatus(statusCode int) bool {
-	return statusCode == 500
+	switch statusCode {
+	case http.StatusRequestTimeout,
+		http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
 }
@@ -0,0 +1,105 @@
+package metricagent
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/storage/mem"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/transport/http/handlers"
+	"github.com/andreevym/metric-collector/internal/transport/http/middleware"
+	"github.com/avast/retry-go"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func newSignedTestServer(t *testing.T, secretKey string) *httptest.Server {
+	t.Helper()
+	m := middleware.NewMiddleware(secretKey, nil, nil)
+	router := handlers.NewRouter(
+		handlers.NewServiceHandlers(mem.NewStorage(nil), nil),
+		m.RequestGzipMiddleware,
+		m.RequestHashMiddleware,
+		m.ResponseHashMiddleware,
+		m.ResponseGzipMiddleware,
+	)
+	ts := httptest.NewServer(router)
+	t.Cleanup(ts.Close)
+	return ts
+}
+
+func newTestAgent(ts *httptest.Server, secretKey string) *Agent {
+	agent := NewAgent(secretKey, nil, "", strings.TrimPrefix(ts.URL, "http://"),
+		time.Second, time.Second, time.Minute, 1, nil, false)
+	agent.retryDelay = retry.FixedDelay
+	return agent
+}
+
+func TestHTTPUpdate_VerifiesResponseSignature(t *testing.T) {
+	value := 1.5
+	metrics := []*store.Metric{{ID: "Alloc", MType: store.MTypeGauge, Value: &value}}
+
+	ts := newSignedTestServer(t, "secret")
+	require.NoError(t, newTestAgent(ts, "secret").httpUpdate(context.Background(), metrics))
+
+	// сервер с другим ключом отклоняет запрос, а его ответ не проходит проверку подписи
+	require.Error(t, newTestAgent(newSignedTestServer(t, "other"), "secret").httpUpdate(context.Background(), metrics))
+
+	// подменённый ответ
+	forged := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set(middleware.HashHeaderKey, "forged")
+		_, _ = w.Write([]byte("[]"))
+	}))
+	defer forged.Close()
+	require.Error(t, newTestAgent(forged, "secret").httpUpdate(context.Background(), metrics))
+	require.NoError(t, newTestAgent(forged, "").httpUpdate(context.Background(), metrics))
+}
+
+func TestSendRequest_ErrorStatus(t *testing.T) {
+	tests := []struct {
+		name     string
+		status   int
+		attempts int64
+		spooled  int
+	}{
+		{name: "rate limited", status: http.StatusTooManyRequests, attempts: retryAttempts, spooled: 1},
+		{name: "proxy", status: http.StatusBadGateway, attempts: retryAttempts, spooled: 1},
+		{name: "unavailable", status: http.StatusServiceUnavailable, attempts: retryAttempts, spooled: 1},
+		{name: "unauthorized", status: http.StatusUnauthorized, attempts: 1},
+		{name: "forbidden", status: http.StatusForbidden, attempts: 1},
+		{name: "invalid metric", status: http.StatusBadRequest, attempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var attempts atomic.Int64
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+				attempts.Add(1)
+				w.WriteHeader(tt.status)
+			}))
+			defer ts.Close()
+
+			spool, err := NewSpool(t.TempDir(), 0)
+			require.NoError(t, err)
+			agent := newTestAgent(ts, "").WithSpool(spool)
+
+			// в очередь сохраняется пакет, который сервер может принять позже, остальные отбрасываются
+			require.Error(t, agent.deliver(context.Background(), testBatch(1, 1)))
+			require.Equal(t, tt.attempts, attempts.Load())
+			require.Equal(t, tt.spooled, spool.Len())
+		})
+	}
+}
+
+func TestIsRetriable(t *testing.T) {
+	require.True(t, isRetriable(&statusError{code: http.StatusGatewayTimeout}))
+	require.False(t, isRetriable(&statusError{code: http.StatusBadRequest}))
+	require.True(t, isRetriable(status.Error(codes.Unavailable, "unavailable")))
+	require.True(t, isRetriable(status.Error(codes.ResourceExhausted, "rate limit exceeded")))
+	require.False(t, isRetriable(status.Error(codes.PermissionDenied, "trusted subnet not trusted")))
+}
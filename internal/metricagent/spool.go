@@ -0,0 +1,262 @@
+package metricagent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultSpoolMaxBatches number of batches kept in the spool if the limit is not set.
+	DefaultSpoolMaxBatches = 1000
+
+	spoolExt = ".json"
+)
+
+// Spool is a bounded on-disk queue of batches the agent failed to send.
+//
+// Every batch is stored in its own file named by the sequence number, so the queue survives restarts
+// of the agent. When the queue is full, the two oldest batches are merged into one: counters are summed
+// and gauges keep the newer value, so no counter increment is lost while the server is down.
+type Spool struct {
+	dir        string
+	maxBatches int
+
+	mu      sync.Mutex
+	seqs    []uint64
+	nextSeq uint64
+}
+
+// NewSpool opens the spool in dir creating it if needed, batches left by the previous run are kept.
+// Zero maxBatches is replaced by DefaultSpoolMaxBatches.
+func NewSpool(dir string, maxBatches int) (*Spool, error) {
+	if maxBatches <= 0 {
+		maxBatches = DefaultSpoolMaxBatches
+	}
+	if err := os.MkdirAll(dir, 0o700); err != nil {
+		return nil, fmt.Errorf("failed to create spool dir '%s': %w", dir, err)
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool dir '%s': %w", dir, err)
+	}
+	s := &Spool{dir: dir, maxBatches: maxBatches}
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), spoolExt)
+		if !ok || entry.IsDir() {
+			continue
+		}
+		seq, err := strconv.ParseUint(name, 10, 64)
+		if err != nil {
+			continue
+		}
+		s.seqs = append(s.seqs, seq)
+		s.nextSeq = max(s.nextSeq, seq+1)
+	}
+	sort.Slice(s.seqs, func(i, j int) bool { return s.seqs[i] < s.seqs[j] })
+	return s, nil
+}
+
+// Len returns the number of batches in the spool, zero for nil.
+func (s *Spool) Len() int {
+	if s == nil {
+		return 0
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.seqs)
+}
+
+// Push appends the batch to the end of the queue.
+func (s *Spool) Push(metrics []*store.Metric) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.seqs) >= s.maxBatches {
+		if err := s.compact(); err != nil {
+			return err
+		}
+	}
+	seq := s.nextSeq
+	if err := s.write(seq, metrics); err != nil {
+		return err
+	}
+	s.nextSeq++
+	s.seqs = append(s.seqs, seq)
+	return nil
+}
+
+// compact merges the two oldest batches into the second one, so that the queue has room for a new batch.
+func (s *Spool) compact() error {
+	if len(s.seqs) < 2 {
+		return nil
+	}
+	oldest, err := s.read(s.seqs[0])
+	if err != nil {
+		return err
+	}
+	next, err := s.read(s.seqs[1])
+	if err != nil {
+		return err
+	}
+	if err = s.write(s.seqs[1], mergeBatches(oldest, next)); err != nil {
+		return err
+	}
+	if err = s.remove(s.seqs[0]); err != nil {
+		return err
+	}
+	s.seqs = s.seqs[1:]
+	return nil
+}
+
+// errBatchRejected the server won't accept the batch however many times it is sent.
+var errBatchRejected = errors.New("batch is rejected by the server")
+
+// Replay merges all queued batches in order and sends them as one batch,
+// the batches are removed only if send succeeds. Batches that can't be read are dropped.
+//
+// If send returns an error wrapping errBatchRejected, the batches are sent again one by one,
+// so that only the batches the server never accepts are dropped and the rest of the queue is delivered.
+func (s *Spool) Replay(send func(metrics []*store.Metric) error) error {
+	// очередь заблокирована на время отправки, чтобы другие воркеры не отправили те же пакеты повторно
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if len(s.seqs) == 0 {
+		return nil
+	}
+	seqs := make([]uint64, 0, len(s.seqs))
+	batches := make([][]*store.Metric, 0, len(s.seqs))
+	for _, seq := range s.seqs {
+		metrics, err := s.read(seq)
+		if err != nil {
+			logger.Logger().Error("drop unreadable spool batch", zap.Uint64("seq", seq), zap.Error(err))
+			if err = s.remove(seq); err != nil {
+				logger.Logger().Error("failed to remove spool batch", zap.Uint64("seq", seq), zap.Error(err))
+			}
+			continue
+		}
+		seqs = append(seqs, seq)
+		batches = append(batches, metrics)
+	}
+	s.seqs = seqs
+
+	if merged := mergeBatches(batches...); len(merged) > 0 {
+		err := send(merged)
+		if errors.Is(err, errBatchRejected) && len(batches) > 1 {
+			return s.replayEach(batches, send)
+		}
+		if err != nil && !errors.Is(err, errBatchRejected) {
+			return err
+		}
+		if err != nil {
+			logger.Logger().Error("drop spool batch rejected by the server", zap.Uint64("seq", seqs[0]), zap.Error(err))
+		}
+	}
+	return s.removeFirst(len(s.seqs))
+}
+
+// replayEach sends the batches in order, a rejected batch is dropped,
+// sending stops at any other error and the remaining batches stay in the queue.
+func (s *Spool) replayEach(batches [][]*store.Metric, send func(metrics []*store.Metric) error) error {
+	for i, batch := range batches {
+		err := send(batch)
+		if err != nil && !errors.Is(err, errBatchRejected) {
+			return errors.Join(err, s.removeFirst(i))
+		}
+		if err != nil {
+			logger.Logger().Error("drop spool batch rejected by the server", zap.Uint64("seq", s.seqs[i]), zap.Error(err))
+		}
+	}
+	return s.removeFirst(len(batches))
+}
+
+// removeFirst removes the n oldest batches of the queue.
+func (s *Spool) removeFirst(n int) error {
+	var errs []error
+	for _, seq := range s.seqs[:n] {
+		if err := s.remove(seq); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	s.seqs = s.seqs[n:]
+	return errors.Join(errs...)
+}
+
+func (s *Spool) path(seq uint64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", seq, spoolExt))
+}
+
+func (s *Spool) read(seq uint64) ([]*store.Metric, error) {
+	data, err := os.ReadFile(s.path(seq))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read spool batch: %w", err)
+	}
+	var metrics []*store.Metric
+	if err = json.Unmarshal(data, &metrics); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal spool batch '%s': %w", s.path(seq), err)
+	}
+	return metrics, nil
+}
+
+// write stores the batch in a temporary file and renames it, so that a crash never leaves a partial batch.
+func (s *Spool) write(seq uint64, metrics []*store.Metric) error {
+	data, err := json.Marshal(metrics)
+	if err != nil {
+		return fmt.Errorf("failed to marshal spool batch: %w", err)
+	}
+	path := s.path(seq)
+	tmp := path + ".tmp"
+	if err = os.WriteFile(tmp, data, 0o600); err != nil {
+		return fmt.Errorf("failed to write spool batch: %w", err)
+	}
+	if err = os.Rename(tmp, path); err != nil {
+		return fmt.Errorf("failed to write spool batch: %w", err)
+	}
+	return nil
+}
+
+func (s *Spool) remove(seq uint64) error {
+	if err := os.Remove(s.path(seq)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("failed to remove spool batch: %w", err)
+	}
+	return nil
+}
+
+// mergeBatches merges batches in order: deltas of counters are summed, gauges keep the latest value.
+// Metrics keep the order they first appeared in.
+func mergeBatches(batches ...[]*store.Metric) []*store.Metric {
+	var merged []*store.Metric
+	index := map[string]int{}
+	for _, batch := range batches {
+		for _, m := range batch {
+			if m == nil {
+				continue
+			}
+			key := m.MType + "/" + m.ID
+			i, ok := index[key]
+			if !ok {
+				index[key] = len(merged)
+				merged = append(merged, store.CopyMetric(m))
+				continue
+			}
+			if m.MType == store.MTypeCounter && merged[i].Delta != nil && m.Delta != nil {
+				delta := *merged[i].Delta + *m.Delta
+				merged[i].Delta = &delta
+				continue
+			}
+			merged[i] = store.CopyMetric(m)
+		}
+	}
+	return merged
+}
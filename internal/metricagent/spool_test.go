@@ -0,0 +1,205 @@
+package metricagent
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/andreevym/metric-collector/internal/storage/mem"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/transport/http/handlers"
+	"github.com/andreevym/metric-collector/internal/transport/http/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+func testBatch(delta int64, value float64) []*store.Metric {
+	return []*store.Metric{
+		{ID: "PollCount", MType: store.MTypeCounter, Delta: &delta},
+		{ID: "Alloc", MType: store.MTypeGauge, Value: &value},
+	}
+}
+
+func TestSpool(t *testing.T) {
+	dir := t.TempDir()
+	spool, err := NewSpool(dir, 2)
+	require.NoError(t, err)
+	require.Equal(t, 0, spool.Len())
+
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, spool.Push(testBatch(int64(i), float64(i))))
+	}
+	// переполненная очередь объединяет старые пакеты
+	require.Equal(t, 2, spool.Len())
+
+	// очередь сохраняется после перезапуска агента
+	spool, err = NewSpool(dir, 2)
+	require.NoError(t, err)
+	require.Equal(t, 2, spool.Len())
+
+	sendErr := errors.New("server is down")
+	require.ErrorIs(t, spool.Replay(func([]*store.Metric) error { return sendErr }), sendErr)
+	require.Equal(t, 2, spool.Len())
+
+	var sent []*store.Metric
+	require.NoError(t, spool.Replay(func(metrics []*store.Metric) error {
+		sent = metrics
+		return nil
+	}))
+	require.Equal(t, 0, spool.Len())
+	require.Len(t, sent, 2)
+	require.Equal(t, int64(6), *sent[0].Delta)
+	require.Equal(t, 3.0, *sent[1].Value)
+
+	require.NoError(t, spool.Push(testBatch(1, 1)))
+	spool, err = NewSpool(dir, 2)
+	require.NoError(t, err)
+	require.Equal(t, 1, spool.Len(), "sequence continues after restart")
+}
+
+func TestSpool_ReplayDropsRejectedBatches(t *testing.T) {
+	spool, err := NewSpool(t.TempDir(), 0)
+	require.NoError(t, err)
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, spool.Push(testBatch(int64(i), float64(i))))
+	}
+
+	// сервер никогда не принимает второй пакет, остальные доставляются
+	var sent []int64
+	err = spool.Replay(func(metrics []*store.Metric) error {
+		// объединённый пакет содержит сумму 1+2+3
+		if delta := *metrics[0].Delta; delta == 2 || delta == 6 {
+			return fmt.Errorf("%w: invalid metric", errBatchRejected)
+		}
+		sent = append(sent, *metrics[0].Delta)
+		return nil
+	})
+	require.NoError(t, err)
+	require.Equal(t, []int64{1, 3}, sent)
+	require.Equal(t, 0, spool.Len())
+
+	// при недоступности сервера неотправленные пакеты остаются в очереди
+	for i := 1; i <= 3; i++ {
+		require.NoError(t, spool.Push(testBatch(int64(i), float64(i))))
+	}
+	sendErr := errors.New("server is down")
+	err = spool.Replay(func(metrics []*store.Metric) error {
+		switch *metrics[0].Delta {
+		case 6:
+			return fmt.Errorf("%w: merged", errBatchRejected)
+		case 1:
+			return nil
+		default:
+			return sendErr
+		}
+	})
+	require.ErrorIs(t, err, sendErr)
+	require.Equal(t, 2, spool.Len())
+}
+
+func TestMergeBatches(t *testing.T) {
+	merged := mergeBatches(testBatch(1, 1), nil, testBatch(2, 2), []*store.Metric{testBatch(3, 3)[0]})
+	require.Len(t, merged, 2)
+	require.Equal(t, "PollCount", merged[0].ID)
+	require.Equal(t, int64(6), *merged[0].Delta)
+	require.Equal(t, 2.0, *merged[1].Value)
+
+	// исходные пакеты не изменяются
+	batch := testBatch(1, 1)
+	mergeBatches(batch, testBatch(2, 2))
+	require.Equal(t, int64(1), *batch[0].Delta)
+}
+
+func TestAgent_SpoolsWhileServerIsDown(t *testing.T) {
+	storage := mem.NewStorage(nil)
+	m := middleware.NewMiddleware("", nil, nil)
+	router := handlers.NewRouter(handlers.NewServiceHandlers(storage, nil), m.RequestGzipMiddleware, m.ResponseGzipMiddleware)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	address := lis.Addr().String()
+	ts := &httptest.Server{Listener: lis, Config: &http.Server{Handler: router}}
+	ts.Start()
+
+	spool, err := NewSpool(t.TempDir(), 0)
+	require.NoError(t, err)
+	agent := newTestAgent(ts, "").WithSpool(spool)
+	ctx := context.Background()
+
+	require.NoError(t, agent.deliver(ctx, testBatch(1, 1)))
+
+	ts.Close()
+	require.Error(t, agent.deliver(ctx, testBatch(2, 2)))
+	require.Error(t, agent.deliver(ctx, testBatch(3, 3)))
+	require.Equal(t, 2, spool.Len())
+
+	// сервер перезапускается на том же адресе
+	lis, err = net.Listen("tcp", address)
+	require.NoError(t, err)
+	ts = &httptest.Server{Listener: lis, Config: &http.Server{Handler: router}}
+	ts.Start()
+	defer ts.Close()
+
+	require.NoError(t, agent.deliver(ctx, testBatch(4, 4)))
+	require.Equal(t, 0, spool.Len())
+
+	pollCount, err := storage.Read(ctx, "PollCount", store.MTypeCounter)
+	require.NoError(t, err)
+	require.Equal(t, int64(10), *pollCount.Delta)
+	alloc, err := storage.Read(ctx, "Alloc", store.MTypeGauge)
+	require.NoError(t, err)
+	require.Equal(t, 4.0, *alloc.Value)
+	spoolSize, err := storage.Read(ctx, SpoolSizeMetricID, store.MTypeGauge)
+	require.NoError(t, err)
+	require.Equal(t, 2.0, *spoolSize.Value)
+}
+
+func TestAgent_RejectedBatchDoesNotBlockSpool(t *testing.T) {
+	storage := mem.NewStorage(nil)
+	m := middleware.NewMiddleware("", nil, nil)
+	router := handlers.NewRouter(handlers.NewServiceHandlers(storage, nil), m.RequestGzipMiddleware, m.ResponseGzipMiddleware)
+	// сервер отвечает кодом status на следующие failures запросов
+	var status, failures atomic.Int64
+	fail := func(code int, n int64) {
+		status.Store(int64(code))
+		failures.Store(n)
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failures.Add(-1) >= 0 {
+			w.WriteHeader(int(status.Load()))
+			return
+		}
+		router.ServeHTTP(w, r)
+	}))
+	defer ts.Close()
+
+	spool, err := NewSpool(t.TempDir(), 0)
+	require.NoError(t, err)
+	agent := newTestAgent(ts, "").WithSpool(spool)
+	ctx := context.Background()
+
+	fail(http.StatusServiceUnavailable, retryAttempts)
+	require.Error(t, agent.deliver(ctx, testBatch(1, 1)))
+	require.Equal(t, 1, spool.Len())
+
+	// сервер один раз отклоняет объединённый пакет, пакеты очереди отправляются по одному
+	fail(http.StatusBadRequest, 1)
+	require.NoError(t, agent.deliver(ctx, testBatch(2, 2)))
+	require.Equal(t, 0, spool.Len())
+	pollCount, err := storage.Read(ctx, "PollCount", store.MTypeCounter)
+	require.NoError(t, err)
+	require.Equal(t, int64(3), *pollCount.Delta)
+
+	// отклонённый пакет без очереди отбрасывается, следующие пакеты доставляются
+	fail(http.StatusBadRequest, 1)
+	require.Error(t, agent.deliver(ctx, testBatch(4, 4)))
+	require.Equal(t, 0, spool.Len())
+	require.NoError(t, agent.deliver(ctx, testBatch(5, 5)))
+	pollCount, err = storage.Read(ctx, "PollCount", store.MTypeCounter)
+	require.NoError(t, err)
+	require.Equal(t, int64(8), *pollCount.Delta)
+}
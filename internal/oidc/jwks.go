@@ -0,0 +1,243 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdh"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/logger"
+	"go.uber.org/zap"
+)
+
+const (
+	// DefaultCacheTTL time the keys are cached for before the JWKS is read again.
+	DefaultCacheTTL = 5 * time.Minute
+	// minRefreshInterval limits how often tokens with an unknown key id may trigger reading the JWKS,
+	// so that forged tokens can't turn the server into a proxy flooding the provider.
+	minRefreshInterval = 10 * time.Second
+	fetchTimeout       = 10 * time.Second
+	maxJWKSSize        = 1 << 20
+)
+
+// ErrUnknownKey the token is signed with a key missing in the JWKS.
+var ErrUnknownKey = errors.New("unknown signing key")
+
+// jwk is a single key of the JWKS, RFC 7517.
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// KeySet caches the public keys of the JWKS read from a file or URL.
+type KeySet struct {
+	source string
+	ttl    time.Duration
+	client *http.Client
+	now    func() time.Time
+
+	mu          sync.Mutex
+	keys        map[string]crypto.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+}
+
+// NewKeySet creates a KeySet reading the JWKS from source, which is an http(s) URL or a path to a file.
+// The keys are read lazily on the first token and cached for ttl, DefaultCacheTTL if ttl is zero.
+func NewKeySet(source string, ttl time.Duration) *KeySet {
+	if ttl <= 0 {
+		ttl = DefaultCacheTTL
+	}
+	return &KeySet{
+		source: source,
+		ttl:    ttl,
+		client: &http.Client{Timeout: fetchTimeout},
+		now:    time.Now,
+	}
+}
+
+// Key returns the key with kid, an empty kid matches the only key of the set.
+// Expired keys and an unknown kid trigger reading the JWKS at most once per minRefreshInterval,
+// so that rotated keys are picked up without waiting for the cache to expire.
+func (s *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	key, ok := s.lookup(kid)
+	expired := now.Sub(s.fetchedAt) >= s.ttl
+	if ok && !expired {
+		return key, nil
+	}
+	// обновление ограничено и для истёкшего кэша, чтобы недоступный провайдер не задерживал каждый запрос
+	if now.Sub(s.attemptedAt) >= minRefreshInterval {
+		s.attemptedAt = now
+		keys, err := s.fetch(ctx)
+		if err != nil {
+			if s.keys == nil {
+				return nil, err
+			}
+			// провайдер недоступен, продолжаем работать с ключами, прочитанными ранее
+			logger.Logger().Warn("failed to refresh jwks", zap.String("source", s.source), zap.Error(err))
+		} else {
+			s.keys = keys
+			s.fetchedAt = now
+		}
+		key, ok = s.lookup(kid)
+	}
+	if !ok {
+		return nil, fmt.Errorf("%w %q", ErrUnknownKey, kid)
+	}
+	return key, nil
+}
+
+func (s *KeySet) lookup(kid string) (crypto.PublicKey, bool) {
+	if kid == "" && len(s.keys) == 1 {
+		for _, key := range s.keys {
+			return key, true
+		}
+	}
+	key, ok := s.keys[kid]
+	return key, ok
+}
+
+func (s *KeySet) fetch(ctx context.Context) (map[string]crypto.PublicKey, error) {
+	data, err := s.read(ctx)
+	if err != nil {
+		return nil, err
+	}
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err = json.Unmarshal(data, &set); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal jwks: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			// ключи неподдерживаемых типов не мешают проверке токенов остальными ключами
+			logger.Logger().Warn("skip jwk", zap.String("kid", k.Kid), zap.Error(err))
+			continue
+		}
+		keys[k.Kid] = key
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("jwks has no signing keys")
+	}
+	return keys, nil
+}
+
+func (s *KeySet) read(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(s.source, "http://") && !strings.HasPrefix(s.source, "https://") {
+		data, err := os.ReadFile(s.source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file by path '%s': %w", s.source, err)
+		}
+		return data, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, s.source, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create jwks request: %w", err)
+	}
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get jwks: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to get jwks: unexpected status code %d", resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxJWKSSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to read jwks: %w", err)
+	}
+	return data, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeBigInt(k.N)
+		if err != nil {
+			return nil, fmt.Errorf("invalid modulus: %w", err)
+		}
+		e, err := decodeBigInt(k.E)
+		if err != nil {
+			return nil, fmt.Errorf("invalid exponent: %w", err)
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 || e.Int64() < 3 {
+			return nil, errors.New("invalid exponent")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+	case "EC":
+		var curve elliptic.Curve
+		var ecdhCurve ecdh.Curve
+		switch k.Crv {
+		case "P-256":
+			curve, ecdhCurve = elliptic.P256(), ecdh.P256()
+		case "P-384":
+			curve, ecdhCurve = elliptic.P384(), ecdh.P384()
+		case "P-521":
+			curve, ecdhCurve = elliptic.P521(), ecdh.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decodeBigInt(k.X)
+		if err != nil {
+			return nil, fmt.Errorf("invalid x coordinate: %w", err)
+		}
+		y, err := decodeBigInt(k.Y)
+		if err != nil {
+			return nil, fmt.Errorf("invalid y coordinate: %w", err)
+		}
+		size := (curve.Params().BitSize + 7) / 8
+		if len(x.Bytes()) > size || len(y.Bytes()) > size {
+			return nil, errors.New("invalid point size")
+		}
+		// ecdh проверяет, что точка лежит на кривой
+		point := append([]byte{4}, x.FillBytes(make([]byte, size))...)
+		point = append(point, y.FillBytes(make([]byte, size))...)
+		if _, err = ecdhCurve.NewPublicKey(point); err != nil {
+			return nil, fmt.Errorf("invalid point: %w", err)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+	}
+}
+
+func decodeBigInt(s string) (*big.Int, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty value")
+	}
+	return new(big.Int).SetBytes(data), nil
+}
@@ -0,0 +1,301 @@
+// Package oidc authenticates users of the query API by bearer JWTs issued by an OIDC provider.
+//
+// Tokens are verified by the public keys of the provider JWKS, read from a file or URL and cached.
+// Claims of a valid token are mapped to the user, the tenant and the roles of the client:
+// the tenant and the roles are read from configurable claims, nested claims are addressed by a dotted path,
+// e.g. "realm_access.roles". Tokens without the roles claim grant the read role only.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	_ "crypto/sha256"
+	_ "crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+const (
+	// Header HTTP header with the bearer token.
+	Header = "Authorization"
+	// MetadataKey gRPC metadata key with the bearer token.
+	MetadataKey = "authorization"
+
+	// DefaultTenantClaim claim with the tenant name.
+	DefaultTenantClaim = "tenant"
+	// DefaultRolesClaim claim with the roles, either a list or a space separated string.
+	DefaultRolesClaim = "roles"
+	// DefaultRole role of tokens without the roles claim.
+	DefaultRole = "read"
+
+	bearerPrefix = "Bearer "
+	// leeway допустимое расхождение часов сервера и провайдера при проверке exp и nbf
+	leeway = time.Minute
+)
+
+var (
+	// ErrInvalidToken the token is malformed or its signature doesn't match.
+	ErrInvalidToken = errors.New("invalid token")
+	// ErrExpiredToken the token is expired or not valid yet.
+	ErrExpiredToken = errors.New("token is expired")
+	// ErrInvalidClaims the token is issued by another issuer, for another audience or misses the subject.
+	ErrInvalidClaims = errors.New("invalid token claims")
+)
+
+// Options of the Verifier.
+type Options struct {
+	// JWKS path to the file or URL of the provider JWKS
+	JWKS string
+	// Issuer expected iss claim, empty disables the check
+	Issuer string
+	// Audience expected value of the aud claim, empty disables the check
+	Audience string
+	// TenantClaim claim with the tenant name, DefaultTenantClaim if empty
+	TenantClaim string
+	// RolesClaim claim with the roles, DefaultRolesClaim if empty
+	RolesClaim string
+	// CacheTTL time the JWKS is cached for, DefaultCacheTTL if zero
+	CacheTTL time.Duration
+}
+
+// Claims is the client described by a verified token.
+type Claims struct {
+	// Subject the sub claim
+	Subject string
+	// Tenant name of the tenant, empty if the token has no tenant claim
+	Tenant string
+	// Roles granted by the token
+	Roles []string
+	// ExpiresAt the exp claim
+	ExpiresAt time.Time
+}
+
+// Verifier verifies bearer tokens.
+type Verifier struct {
+	keys        *KeySet
+	issuer      string
+	audience    string
+	tenantClaim string
+	rolesClaim  string
+	now         func() time.Time
+}
+
+// NewVerifier creates a Verifier, it returns nil if the JWKS is not set, that is bearer tokens are disabled.
+func NewVerifier(opts Options) *Verifier {
+	if opts.JWKS == "" {
+		return nil
+	}
+	v := &Verifier{
+		keys:        NewKeySet(opts.JWKS, opts.CacheTTL),
+		issuer:      opts.Issuer,
+		audience:    opts.Audience,
+		tenantClaim: opts.TenantClaim,
+		rolesClaim:  opts.RolesClaim,
+		now:         time.Now,
+	}
+	if v.tenantClaim == "" {
+		v.tenantClaim = DefaultTenantClaim
+	}
+	if v.rolesClaim == "" {
+		v.rolesClaim = DefaultRolesClaim
+	}
+	return v
+}
+
+// Enabled reports whether bearer tokens are accepted.
+func (v *Verifier) Enabled() bool {
+	return v != nil
+}
+
+// BearerToken returns the token of the Authorization header value.
+func BearerToken(authorization string) (string, bool) {
+	if len(authorization) < len(bearerPrefix) || !strings.EqualFold(authorization[:len(bearerPrefix)], bearerPrefix) {
+		return "", false
+	}
+	token := strings.TrimSpace(authorization[len(bearerPrefix):])
+	return token, token != ""
+}
+
+// Verify checks the signature and the registered claims of the token and returns its claims.
+func (v *Verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	if v == nil {
+		return Claims{}, fmt.Errorf("%w: bearer tokens are disabled", ErrInvalidToken)
+	}
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return Claims{}, fmt.Errorf("%w: want 3 parts", ErrInvalidToken)
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return Claims{}, fmt.Errorf("%w: header: %w", ErrInvalidToken, err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: signature: %w", ErrInvalidToken, err)
+	}
+	key, err := v.keys.Key(ctx, header.Kid)
+	if err != nil {
+		return Claims{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+	if err = verifySignature(header.Alg, key, []byte(parts[0]+"."+parts[1]), signature); err != nil {
+		return Claims{}, fmt.Errorf("%w: %w", ErrInvalidToken, err)
+	}
+
+	var raw map[string]any
+	if err = decodeSegment(parts[1], &raw); err != nil {
+		return Claims{}, fmt.Errorf("%w: claims: %w", ErrInvalidToken, err)
+	}
+	return v.claims(raw)
+}
+
+func (v *Verifier) claims(raw map[string]any) (Claims, error) {
+	now := v.now()
+	exp, ok := raw["exp"].(float64)
+	if !ok {
+		return Claims{}, fmt.Errorf("%w: missing exp", ErrInvalidClaims)
+	}
+	c := Claims{ExpiresAt: time.Unix(int64(exp), 0)}
+	if now.After(c.ExpiresAt.Add(leeway)) {
+		return Claims{}, ErrExpiredToken
+	}
+	if nbf, ok := raw["nbf"].(float64); ok && now.Add(leeway).Before(time.Unix(int64(nbf), 0)) {
+		return Claims{}, ErrExpiredToken
+	}
+
+	if v.issuer != "" {
+		if iss, _ := raw["iss"].(string); iss != v.issuer {
+			return Claims{}, fmt.Errorf("%w: unexpected issuer %q", ErrInvalidClaims, iss)
+		}
+	}
+	if v.audience != "" && !slices.Contains(stringList(raw["aud"]), v.audience) {
+		return Claims{}, fmt.Errorf("%w: token is not issued for %q", ErrInvalidClaims, v.audience)
+	}
+	c.Subject, _ = raw["sub"].(string)
+	if c.Subject == "" {
+		return Claims{}, fmt.Errorf("%w: missing sub", ErrInvalidClaims)
+	}
+
+	c.Tenant, _ = claim(raw, v.tenantClaim).(string)
+	if roles := claim(raw, v.rolesClaim); roles != nil {
+		c.Roles = stringList(roles)
+	} else {
+		c.Roles = []string{DefaultRole}
+	}
+	return c, nil
+}
+
+// claim returns the value of the claim by its dotted path.
+func claim(raw map[string]any, path string) any {
+	var value any = raw
+	for _, name := range strings.Split(path, ".") {
+		object, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = object[name]
+	}
+	return value
+}
+
+// stringList returns the strings of a list claim, a string claim is split by spaces like the scope claim.
+func stringList(value any) []string {
+	switch v := value.(type) {
+	case string:
+		return strings.Fields(v)
+	case []any:
+		list := make([]string, 0, len(v))
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				list = append(list, s)
+			}
+		}
+		return list
+	default:
+		return nil
+	}
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// verifySignature checks the JWS signature, RFC 7518. Only asymmetric algorithms are supported,
+// so that a token can't be signed by the public key used as an HMAC secret.
+func verifySignature(alg string, key crypto.PublicKey, signingInput, signature []byte) error {
+	var h crypto.Hash
+	switch alg[min(2, len(alg)):] {
+	case "256":
+		h = crypto.SHA256
+	case "384":
+		h = crypto.SHA384
+	case "512":
+		h = crypto.SHA512
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+	digest := h.New()
+	digest.Write(signingInput)
+	hashed := digest.Sum(nil)
+
+	switch {
+	case strings.HasPrefix(alg, "RS"), strings.HasPrefix(alg, "PS"):
+		public, ok := key.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s doesn't match the key type %T", alg, key)
+		}
+		if strings.HasPrefix(alg, "PS") {
+			return rsa.VerifyPSS(public, h, hashed, signature, &rsa.PSSOptions{SaltLength: rsa.PSSSaltLengthEqualsHash})
+		}
+		return rsa.VerifyPKCS1v15(public, h, hashed, signature)
+	case strings.HasPrefix(alg, "ES"):
+		public, ok := key.(*ecdsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("algorithm %s doesn't match the key type %T", alg, key)
+		}
+		bits := public.Curve.Params().BitSize
+		if (bits == 521) != (h == crypto.SHA512) || (bits != 521 && bits != h.Size()*8) {
+			return fmt.Errorf("algorithm %s doesn't match the curve %s", alg, public.Curve.Params().Name)
+		}
+		size := (bits + 7) / 8
+		if len(signature) != 2*size {
+			return errors.New("invalid signature size")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(public, hashed, r, s) {
+			return errors.New("signature mismatch")
+		}
+		return nil
+	default:
+		return fmt.Errorf("unsupported algorithm %q", alg)
+	}
+}
+
+type claimsKey struct{}
+
+// WithClaims returns a copy of ctx carrying the claims of the verified token.
+func WithClaims(ctx context.Context, c Claims) context.Context {
+	return context.WithValue(ctx, claimsKey{}, c)
+}
+
+// FromContext returns the claims of the token the request is authenticated by.
+func FromContext(ctx context.Context) (Claims, bool) {
+	c, ok := ctx.Value(claimsKey{}).(Claims)
+	return c, ok
+}
@@ -0,0 +1,240 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+type testKey struct {
+	kid     string
+	private crypto.Signer
+}
+
+func newRSAKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	return testKey{kid: kid, private: private}
+}
+
+func newECKey(t *testing.T, kid string) testKey {
+	t.Helper()
+	private, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	return testKey{kid: kid, private: private}
+}
+
+func (k testKey) jwk() map[string]string {
+	encode := func(i *big.Int) string { return base64.RawURLEncoding.EncodeToString(i.Bytes()) }
+	switch private := k.private.(type) {
+	case *rsa.PrivateKey:
+		return map[string]string{"kty": "RSA", "kid": k.kid, "use": "sig",
+			"n": encode(private.N), "e": encode(big.NewInt(int64(private.E)))}
+	case *ecdsa.PrivateKey:
+		return map[string]string{"kty": "EC", "kid": k.kid, "crv": "P-256",
+			"x": encode(private.X), "y": encode(private.Y)}
+	}
+	return nil
+}
+
+func (k testKey) sign(t *testing.T, claims map[string]any) string {
+	t.Helper()
+	alg := "RS256"
+	if _, ok := k.private.(*ecdsa.PrivateKey); ok {
+		alg = "ES256"
+	}
+	segment := func(v any) string {
+		data, err := json.Marshal(v)
+		require.NoError(t, err)
+		return base64.RawURLEncoding.EncodeToString(data)
+	}
+	signingInput := segment(map[string]string{"alg": alg, "kid": k.kid, "typ": "JWT"}) + "." + segment(claims)
+	hashed := sha256.Sum256([]byte(signingInput))
+
+	var signature []byte
+	var err error
+	switch private := k.private.(type) {
+	case *rsa.PrivateKey:
+		signature, err = rsa.SignPKCS1v15(rand.Reader, private, crypto.SHA256, hashed[:])
+	case *ecdsa.PrivateKey:
+		var r, s *big.Int
+		r, s, err = ecdsa.Sign(rand.Reader, private, hashed[:])
+		signature = append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	}
+	require.NoError(t, err)
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func writeJWKS(t *testing.T, path string, keys ...testKey) {
+	t.Helper()
+	set := map[string][]map[string]string{"keys": {}}
+	for _, k := range keys {
+		set["keys"] = append(set["keys"], k.jwk())
+	}
+	data, err := json.Marshal(set)
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
+
+func TestVerifier_Verify(t *testing.T) {
+	now := time.Unix(1700000000, 0)
+	rsaKey, ecKey := newRSAKey(t, "rsa"), newECKey(t, "ec")
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	writeJWKS(t, path, rsaKey, ecKey)
+
+	v := NewVerifier(Options{
+		JWKS:       path,
+		Issuer:     "https://idp.example.com",
+		Audience:   "metric-collector",
+		RolesClaim: "realm_access.roles",
+	})
+	v.now = func() time.Time { return now }
+	claims := func(overrides map[string]any) map[string]any {
+		c := map[string]any{
+			"iss":          "https://idp.example.com",
+			"aud":          []string{"metric-collector", "grafana"},
+			"sub":          "alice",
+			"exp":          now.Add(time.Hour).Unix(),
+			"tenant":       "team-a",
+			"realm_access": map[string]any{"roles": []string{"read", "ingest"}},
+		}
+		for k, value := range overrides {
+			c[k] = value
+		}
+		return c
+	}
+
+	for _, key := range []testKey{rsaKey, ecKey} {
+		c, err := v.Verify(context.Background(), key.sign(t, claims(nil)))
+		require.NoError(t, err, key.kid)
+		require.Equal(t, "alice", c.Subject)
+		require.Equal(t, "team-a", c.Tenant)
+		require.Equal(t, []string{"read", "ingest"}, c.Roles)
+	}
+
+	c, err := v.Verify(context.Background(), rsaKey.sign(t, claims(map[string]any{"realm_access": nil})))
+	require.NoError(t, err)
+	require.Equal(t, []string{DefaultRole}, c.Roles)
+
+	tests := []struct {
+		name    string
+		token   string
+		wantErr error
+	}{
+		{name: "expired", token: rsaKey.sign(t, claims(map[string]any{"exp": now.Add(-2 * time.Minute).Unix()})),
+			wantErr: ErrExpiredToken},
+		{name: "not valid yet", token: rsaKey.sign(t, claims(map[string]any{"nbf": now.Add(time.Hour).Unix()})),
+			wantErr: ErrExpiredToken},
+		{name: "other issuer", token: rsaKey.sign(t, claims(map[string]any{"iss": "https://evil.example.com"})),
+			wantErr: ErrInvalidClaims},
+		{name: "other audience", token: rsaKey.sign(t, claims(map[string]any{"aud": "grafana"})),
+			wantErr: ErrInvalidClaims},
+		{name: "without subject", token: rsaKey.sign(t, claims(map[string]any{"sub": ""})),
+			wantErr: ErrInvalidClaims},
+		{name: "unknown key", token: newRSAKey(t, "other").sign(t, claims(nil)), wantErr: ErrInvalidToken},
+		{name: "malformed", token: "not-a-token", wantErr: ErrInvalidToken},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := v.Verify(context.Background(), tt.token)
+			require.ErrorIs(t, err, tt.wantErr)
+		})
+	}
+
+	t.Run("tampered claims", func(t *testing.T) {
+		token := rsaKey.sign(t, claims(nil))
+		forged := ecKey.sign(t, claims(map[string]any{"sub": "admin"}))
+		_, err := v.Verify(context.Background(), token[:len(token)-10]+forged[len(forged)-10:])
+		require.ErrorIs(t, err, ErrInvalidToken)
+	})
+	t.Run("symmetric algorithm", func(t *testing.T) {
+		// подпись открытым ключом как секретом HMAC не принимается
+		header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"HS256","kid":"rsa"}`))
+		body := base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"alice"}`))
+		_, err := v.Verify(context.Background(), header+"."+body+".c2lnbmF0dXJl")
+		require.ErrorIs(t, err, ErrInvalidToken)
+	})
+}
+
+func TestKeySet_Key(t *testing.T) {
+	first, second := newRSAKey(t, "first"), newRSAKey(t, "second")
+	var jwks atomic.Value
+	jwks.Store([]testKey{first})
+	var requests atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		requests.Add(1)
+		set := map[string][]map[string]string{"keys": {}}
+		for _, k := range jwks.Load().([]testKey) {
+			set["keys"] = append(set["keys"], k.jwk())
+		}
+		_ = json.NewEncoder(w).Encode(set)
+	}))
+	defer srv.Close()
+
+	now := time.Unix(1700000000, 0)
+	s := NewKeySet(srv.URL, time.Minute)
+	s.now = func() time.Time { return now }
+	ctx := context.Background()
+
+	_, err := s.Key(ctx, "first")
+	require.NoError(t, err)
+	_, err = s.Key(ctx, "")
+	require.NoError(t, err)
+	require.EqualValues(t, 1, requests.Load(), "keys are cached")
+
+	// ключ после ротации подхватывается без ожидания истечения кэша, но не чаще minRefreshInterval
+	jwks.Store([]testKey{first, second})
+	_, err = s.Key(ctx, "second")
+	require.ErrorIs(t, err, ErrUnknownKey)
+	require.EqualValues(t, 1, requests.Load())
+
+	now = now.Add(minRefreshInterval)
+	_, err = s.Key(ctx, "second")
+	require.NoError(t, err)
+	require.EqualValues(t, 2, requests.Load())
+	_, err = s.Key(ctx, "unknown")
+	require.ErrorIs(t, err, ErrUnknownKey)
+	require.EqualValues(t, 2, requests.Load())
+
+	// недоступный провайдер не мешает работе с ключами, прочитанными ранее
+	srv.Close()
+	now = now.Add(2 * time.Minute)
+	_, err = s.Key(ctx, "first")
+	require.NoError(t, err)
+}
+
+func TestBearerToken(t *testing.T) {
+	token, ok := BearerToken("Bearer abc.def.ghi")
+	require.True(t, ok)
+	require.Equal(t, "abc.def.ghi", token)
+	_, ok = BearerToken("bearer abc")
+	require.True(t, ok)
+	for _, invalid := range []string{"", "Bearer ", "Basic dXNlcjpwYXNz", "abc.def.ghi"} {
+		_, ok = BearerToken(invalid)
+		require.False(t, ok, invalid)
+	}
+}
+
+func TestNewVerifier_Disabled(t *testing.T) {
+	v := NewVerifier(Options{})
+	require.False(t, v.Enabled())
+	_, err := v.Verify(context.Background(), "token")
+	require.ErrorIs(t, err, ErrInvalidToken)
+}
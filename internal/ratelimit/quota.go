@@ -0,0 +1,109 @@
+package ratelimit
+
+import (
+	"sync"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/storage/store"
+)
+
+// maxIdleClients number of clients after which clients without series within the window are dropped.
+const maxIdleClients = 10000
+
+// SeriesQuota limits the number of distinct series (metric ID and type) a client reports within a window.
+// A series that hasn't been reported for the window no longer counts against the quota.
+type SeriesQuota struct {
+	limit  int
+	window time.Duration
+	now    func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]map[string]time.Time
+}
+
+// NewSeriesQuota creates a SeriesQuota, a non-positive limit disables the quota.
+func NewSeriesQuota(limit int, window time.Duration) *SeriesQuota {
+	return &SeriesQuota{
+		limit:   limit,
+		window:  window,
+		now:     time.Now,
+		clients: map[string]map[string]time.Time{},
+	}
+}
+
+// Admit accounts metrics to the client. If new series don't fit into the quota,
+// nothing is accounted and *Error wrapping ErrQuotaExceeded is returned.
+func (q *SeriesQuota) Admit(client string, metrics []*store.Metric) error {
+	if q == nil || q.limit <= 0 {
+		return nil
+	}
+
+	now := q.now()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	series, ok := q.clients[client]
+	if !ok {
+		if len(q.clients) >= maxIdleClients {
+			q.dropExpired(now)
+		}
+		series = map[string]time.Time{}
+	}
+
+	newSeries := map[string]struct{}{}
+	for _, m := range metrics {
+		if _, ok := series[m.ID+m.MType]; !ok {
+			newSeries[m.ID+m.MType] = struct{}{}
+		}
+	}
+	if len(series)+len(newSeries) > q.limit {
+		q.expire(series, now)
+	}
+	if len(series)+len(newSeries) > q.limit {
+		return &Error{Err: ErrQuotaExceeded, Client: client, RetryAfter: q.retryAfter(series, now)}
+	}
+
+	for _, m := range metrics {
+		series[m.ID+m.MType] = now
+	}
+	if len(series) > 0 {
+		q.clients[client] = series
+	}
+	return nil
+}
+
+// dropExpired forgets clients whose series have all left the window, they are indistinguishable from new clients.
+func (q *SeriesQuota) dropExpired(now time.Time) {
+	for client, series := range q.clients {
+		q.expire(series, now)
+		if len(series) == 0 {
+			delete(q.clients, client)
+		}
+	}
+}
+
+// expire forgets series not reported within the window.
+func (q *SeriesQuota) expire(series map[string]time.Time, now time.Time) {
+	if q.window <= 0 {
+		return
+	}
+	for key, seen := range series {
+		if now.Sub(seen) >= q.window {
+			delete(series, key)
+		}
+	}
+}
+
+// retryAfter returns the time until the least recently reported series leaves the window.
+func (q *SeriesQuota) retryAfter(series map[string]time.Time, now time.Time) time.Duration {
+	if q.window <= 0 {
+		return 0
+	}
+	oldest := now
+	for _, seen := range series {
+		if seen.Before(oldest) {
+			oldest = seen
+		}
+	}
+	return oldest.Add(q.window).Sub(now)
+}
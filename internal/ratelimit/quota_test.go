@@ -0,0 +1,68 @@
+package ratelimit
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSeriesQuota_Admit(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	quota := NewSeriesQuota(2, time.Minute)
+	quota.now = func() time.Time { return now }
+
+	gauge := func(id string) *store.Metric { return &store.Metric{ID: id, MType: store.MTypeGauge} }
+
+	require.NoError(t, quota.Admit("tenant:a", []*store.Metric{gauge("Alloc")}))
+	now = now.Add(30 * time.Second)
+	require.NoError(t, quota.Admit("tenant:a", []*store.Metric{gauge("HeapAlloc")}))
+
+	// уже учтённые метрики принимаются, новые — нет, и пачка не учитывается частично
+	require.NoError(t, quota.Admit("tenant:a", []*store.Metric{gauge("HeapAlloc")}))
+	err := quota.Admit("tenant:a", []*store.Metric{gauge("HeapAlloc"), gauge("Frees")})
+	var limitErr *Error
+	require.True(t, errors.As(err, &limitErr))
+	require.ErrorIs(t, err, ErrQuotaExceeded)
+	require.Equal(t, 30*time.Second, limitErr.RetryAfter)
+	require.NoError(t, quota.Admit("tenant:b", []*store.Metric{gauge("Frees")}))
+
+	// метрика, не присылаемая дольше окна, освобождает место
+	now = now.Add(40 * time.Second)
+	require.NoError(t, quota.Admit("tenant:a", []*store.Metric{gauge("Frees")}))
+	require.ErrorIs(t, quota.Admit("tenant:a", []*store.Metric{gauge("Alloc")}), ErrQuotaExceeded)
+}
+
+func TestSeriesQuota_Disabled(t *testing.T) {
+	var nilQuota *SeriesQuota
+	require.NoError(t, nilQuota.Admit("tenant:a", []*store.Metric{{ID: "Alloc", MType: store.MTypeGauge}}))
+	require.NoError(t, NewSeriesQuota(0, time.Minute).Admit("tenant:a", []*store.Metric{{ID: "Alloc", MType: store.MTypeGauge}}))
+}
+
+func TestSeriesQuota_DropsExpiredClients(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	quota := NewSeriesQuota(2, time.Minute)
+	quota.now = func() time.Time { return now }
+	metrics := []*store.Metric{{ID: "Alloc", MType: store.MTypeGauge}}
+
+	for i := 0; i < maxIdleClients; i++ {
+		require.NoError(t, quota.Admit("ip:"+strconv.Itoa(i), metrics))
+	}
+	require.Len(t, quota.clients, maxIdleClients)
+
+	// клиенты, все метрики которых вышли из окна, забываются
+	now = now.Add(time.Minute)
+	require.NoError(t, quota.Admit("ip:0", metrics))
+	require.NoError(t, quota.Admit("ip:new", metrics))
+	require.Len(t, quota.clients, 2)
+
+	// отклонённая пачка нового клиента не оставляет записи
+	require.ErrorIs(t, quota.Admit("ip:rejected", append(metrics,
+		&store.Metric{ID: "HeapAlloc", MType: store.MTypeGauge},
+		&store.Metric{ID: "Frees", MType: store.MTypeGauge},
+	)), ErrQuotaExceeded)
+	require.Len(t, quota.clients, 2)
+}
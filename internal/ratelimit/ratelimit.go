@@ -0,0 +1,114 @@
+// Package ratelimit protects ingestion from misbehaving clients
+// with a token bucket per client and a quota on distinct metric series per client.
+package ratelimit
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrRateLimited indicates that the client sends requests faster than allowed.
+	ErrRateLimited = errors.New("rate limit exceeded")
+	// ErrQuotaExceeded indicates that the client reports more distinct series than allowed.
+	ErrQuotaExceeded = errors.New("series quota exceeded")
+)
+
+// Error is a rejection by a limit, it tells the client when to retry.
+type Error struct {
+	// Err is ErrRateLimited or ErrQuotaExceeded.
+	Err error
+	// Client key of the rejected client.
+	Client string
+	// RetryAfter time after which the request may succeed.
+	RetryAfter time.Duration
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("%s for client %s, retry after %s", e.Err, e.Client, e.RetryAfter)
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfterSeconds returns RetryAfter rounded up to whole seconds, as used by the Retry-After header.
+func (e *Error) RetryAfterSeconds() int {
+	return int(math.Ceil(e.RetryAfter.Seconds()))
+}
+
+// maxIdleBuckets number of buckets after which full buckets of idle clients are dropped.
+const maxIdleBuckets = 10000
+
+type bucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// Limiter is a token bucket per client: a client may send burst requests at once
+// and then rate requests per second.
+type Limiter struct {
+	rate  float64
+	burst float64
+	now   func() time.Time
+
+	mu      sync.Mutex
+	buckets map[string]*bucket
+}
+
+// NewLimiter creates a Limiter, a non-positive rate disables limiting.
+func NewLimiter(rate float64, burst int) *Limiter {
+	if burst < 1 {
+		burst = 1
+	}
+	return &Limiter{
+		rate:    rate,
+		burst:   float64(burst),
+		now:     time.Now,
+		buckets: map[string]*bucket{},
+	}
+}
+
+// Allow takes a token from the bucket of the client, it returns *Error wrapping ErrRateLimited if the bucket is empty.
+func (l *Limiter) Allow(client string) error {
+	if l == nil || l.rate <= 0 {
+		return nil
+	}
+
+	now := l.now()
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.buckets[client]
+	if !ok {
+		if len(l.buckets) >= maxIdleBuckets {
+			l.dropFull(now)
+		}
+		b = &bucket{tokens: l.burst, last: now}
+		l.buckets[client] = b
+	}
+	b.tokens = math.Min(l.burst, b.tokens+now.Sub(b.last).Seconds()*l.rate)
+	b.last = now
+
+	if b.tokens < 1 {
+		return &Error{
+			Err:        ErrRateLimited,
+			Client:     client,
+			RetryAfter: time.Duration((1 - b.tokens) / l.rate * float64(time.Second)),
+		}
+	}
+	b.tokens--
+	return nil
+}
+
+// dropFull forgets clients whose buckets have refilled, they are indistinguishable from new clients.
+func (l *Limiter) dropFull(now time.Time) {
+	for client, b := range l.buckets {
+		if b.tokens+now.Sub(b.last).Seconds()*l.rate >= l.burst {
+			delete(l.buckets, client)
+		}
+	}
+}
@@ -0,0 +1,49 @@
+package ratelimit
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestLimiter_Allow(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	limiter := NewLimiter(2, 3)
+	limiter.now = func() time.Time { return now }
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, limiter.Allow("ip:10.0.0.1"))
+	}
+	err := limiter.Allow("ip:10.0.0.1")
+	var limitErr *Error
+	require.True(t, errors.As(err, &limitErr))
+	require.ErrorIs(t, err, ErrRateLimited)
+	require.Equal(t, 500*time.Millisecond, limitErr.RetryAfter)
+	require.Equal(t, 1, limitErr.RetryAfterSeconds())
+
+	// другие клиенты не затронуты
+	require.NoError(t, limiter.Allow("ip:10.0.0.2"))
+
+	now = now.Add(500 * time.Millisecond)
+	require.NoError(t, limiter.Allow("ip:10.0.0.1"))
+	require.ErrorIs(t, limiter.Allow("ip:10.0.0.1"), ErrRateLimited)
+
+	// корзина не наполняется сверх burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		require.NoError(t, limiter.Allow("ip:10.0.0.1"))
+	}
+	require.ErrorIs(t, limiter.Allow("ip:10.0.0.1"), ErrRateLimited)
+}
+
+func TestLimiter_Disabled(t *testing.T) {
+	var nilLimiter *Limiter
+	require.NoError(t, nilLimiter.Allow("ip:10.0.0.1"))
+
+	limiter := NewLimiter(0, 1)
+	for i := 0; i < 100; i++ {
+		require.NoError(t, limiter.Allow("ip:10.0.0.1"))
+	}
+}
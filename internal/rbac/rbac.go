@@ -0,0 +1,144 @@
+// Package rbac grants roles to clients by their credentials and checks the role required by an operation.
+//
+// Roles are bound to credentials resolved into identity.Identity: the tenant of the API key,
+// the subject of the client certificate and the user of the bearer token.
+// Bindings are configured as a comma separated list:
+//
+//	tenant:team-a=ingest+read,cert:agent-1=ingest,cert:ops=admin,user:alice=admin,*=read
+//
+// where "*" grants roles to every client. The admin role grants every operation.
+// Bearer tokens also grant the roles of their claims, the roles of tokens are checked
+// even without bindings, so that a token never grants more than its claims.
+package rbac
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/andreevym/metric-collector/internal/identity"
+)
+
+// Role is a set of operations a client is allowed to perform.
+type Role string
+
+const (
+	// RoleIngest запись метрик.
+	RoleIngest Role = "ingest"
+	// RoleRead чтение метрик.
+	RoleRead Role = "read"
+	// RoleAdmin административные операции, отладка и документация, включает все остальные роли.
+	RoleAdmin Role = "admin"
+)
+
+// Prefixes of the credentials roles are bound to.
+const (
+	TenantPrefix  = "tenant:"
+	SubjectPrefix = "cert:"
+	UserPrefix    = "user:"
+	// Everyone binds roles to every client, including anonymous ones.
+	Everyone = "*"
+)
+
+// ErrForbidden the client has no role required by the operation.
+var ErrForbidden = errors.New("forbidden")
+
+// Policy maps credentials to roles.
+type Policy struct {
+	bindings map[string][]Role
+}
+
+// ParseBindings parses bindings like "tenant:team-a=ingest+read,cert:ops=admin,*=read".
+// Returns nil if s is empty, that is access control is disabled.
+func ParseBindings(s string) (*Policy, error) {
+	if strings.TrimSpace(s) == "" {
+		return nil, nil
+	}
+	p := &Policy{bindings: map[string][]Role{}}
+	for _, binding := range strings.Split(s, ",") {
+		binding = strings.TrimSpace(binding)
+		if binding == "" {
+			continue
+		}
+		credential, roles, ok := strings.Cut(binding, "=")
+		credential = strings.TrimSpace(credential)
+		if !ok || roles == "" {
+			return nil, fmt.Errorf("invalid role binding %q, want credential=role+role", binding)
+		}
+		if credential != Everyone && !strings.HasPrefix(credential, TenantPrefix) &&
+			!strings.HasPrefix(credential, SubjectPrefix) && !strings.HasPrefix(credential, UserPrefix) {
+			return nil, fmt.Errorf("invalid credential %q, want %s<name>, %s<subject>, %s<user> or %s",
+				credential, TenantPrefix, SubjectPrefix, UserPrefix, Everyone)
+		}
+		for _, role := range strings.Split(roles, "+") {
+			r := Role(strings.TrimSpace(role))
+			switch r {
+			case RoleIngest, RoleRead, RoleAdmin:
+				p.bindings[credential] = append(p.bindings[credential], r)
+			default:
+				return nil, fmt.Errorf("unknown role %q in binding %q", role, binding)
+			}
+		}
+	}
+	return p, nil
+}
+
+// Enabled reports whether access control is configured.
+func (p *Policy) Enabled() bool {
+	return p != nil
+}
+
+// Roles returns the roles granted to the client by the bindings and its bearer token.
+func (p *Policy) Roles(id identity.Identity) []Role {
+	roles := tokenRoles(id)
+	if p == nil {
+		return roles
+	}
+	roles = append(roles, p.bindings[Everyone]...)
+	if id.Tenant != "" {
+		roles = append(roles, p.bindings[TenantPrefix+id.Tenant]...)
+	}
+	if id.Subject != "" {
+		roles = append(roles, p.bindings[SubjectPrefix+id.Subject]...)
+	}
+	if id.User != "" {
+		roles = append(roles, p.bindings[UserPrefix+id.User]...)
+	}
+	return roles
+}
+
+// tokenRoles returns the known roles of the bearer token, unknown roles of the provider are ignored.
+func tokenRoles(id identity.Identity) []Role {
+	var roles []Role
+	for _, role := range id.Roles {
+		switch r := Role(role); r {
+		case RoleIngest, RoleRead, RoleAdmin:
+			roles = append(roles, r)
+		}
+	}
+	return roles
+}
+
+// Allow reports whether the client has the role.
+// A nil policy allows everything to clients without a bearer token.
+func (p *Policy) Allow(id identity.Identity, required Role) bool {
+	if p == nil && id.User == "" {
+		return true
+	}
+	for _, role := range p.Roles(id) {
+		if role == required || role == RoleAdmin {
+			return true
+		}
+	}
+	return false
+}
+
+// Authorize checks that the client of ctx has the role, it returns ErrForbidden otherwise.
+func (p *Policy) Authorize(ctx context.Context, required Role) error {
+	id := identity.FromContext(ctx)
+	if !p.Allow(id, required) {
+		return fmt.Errorf("%w: client %s has no role %s", ErrForbidden, id.Key(), required)
+	}
+	return nil
+}
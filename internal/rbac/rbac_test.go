@@ -0,0 +1,79 @@
+package rbac
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andreevym/metric-collector/internal/identity"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseBindings(t *testing.T) {
+	p, err := ParseBindings("")
+	require.NoError(t, err)
+	require.False(t, p.Enabled())
+	require.True(t, p.Allow(identity.Identity{}, RoleAdmin))
+
+	p, err = ParseBindings("tenant:team-a=ingest+read, cert:ops=admin,*=read")
+	require.NoError(t, err)
+	require.True(t, p.Enabled())
+	require.ElementsMatch(t, []Role{RoleRead, RoleIngest, RoleRead}, p.Roles(identity.Identity{Tenant: "team-a"}))
+
+	for _, invalid := range []string{
+		"tenant:team-a",
+		"tenant:team-a=",
+		"tenant:team-a=owner",
+		"team-a=read",
+	} {
+		_, err = ParseBindings(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestPolicy_Allow(t *testing.T) {
+	p, err := ParseBindings("tenant:team-a=ingest,cert:agent-1=ingest,cert:ops=admin,*=read")
+	require.NoError(t, err)
+
+	tests := []struct {
+		name     string
+		id       identity.Identity
+		role     Role
+		expected bool
+	}{
+		{name: "tenant ingest", id: identity.Identity{Tenant: "team-a"}, role: RoleIngest, expected: true},
+		{name: "everyone read", id: identity.Identity{Tenant: "team-a"}, role: RoleRead, expected: true},
+		{name: "tenant admin", id: identity.Identity{Tenant: "team-a"}, role: RoleAdmin, expected: false},
+		{name: "subject ingest", id: identity.Identity{Subject: "agent-1"}, role: RoleIngest, expected: true},
+		{name: "roles of tenant and subject are joined",
+			id: identity.Identity{Tenant: "team-b", Subject: "agent-1"}, role: RoleIngest, expected: true},
+		{name: "admin ingest", id: identity.Identity{Subject: "ops"}, role: RoleIngest, expected: true},
+		{name: "admin", id: identity.Identity{Subject: "ops"}, role: RoleAdmin, expected: true},
+		{name: "anonymous read", id: identity.Identity{IP: "10.0.0.1"}, role: RoleRead, expected: true},
+		{name: "anonymous ingest", id: identity.Identity{IP: "10.0.0.1"}, role: RoleIngest, expected: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			require.Equal(t, tt.expected, p.Allow(tt.id, tt.role))
+		})
+	}
+
+	ctx := identity.WithIdentity(context.Background(), identity.Identity{IP: "10.0.0.1"})
+	require.ErrorIs(t, p.Authorize(ctx, RoleIngest), ErrForbidden)
+	require.NoError(t, p.Authorize(ctx, RoleRead))
+}
+
+func TestPolicy_AllowTokenRoles(t *testing.T) {
+	dashboard := identity.Identity{User: "alice", Roles: []string{"read", "viewer"}}
+
+	// без привязок токен даёт только роли из своих утверждений
+	var p *Policy
+	require.True(t, p.Allow(dashboard, RoleRead))
+	require.False(t, p.Allow(dashboard, RoleIngest))
+	require.True(t, p.Allow(identity.Identity{}, RoleIngest))
+
+	p, err := ParseBindings("user:alice=ingest,*=read")
+	require.NoError(t, err)
+	require.True(t, p.Allow(dashboard, RoleIngest))
+	require.False(t, p.Allow(dashboard, RoleAdmin))
+	require.True(t, p.Allow(identity.Identity{User: "bob", Roles: []string{"admin"}}, RoleAdmin))
+}
@@ -0,0 +1,143 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/audit"
+	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"go.uber.org/zap"
+)
+
+// Expired is a metric that has outlived its retention.
+type Expired struct {
+	ID        string    `json:"id"`
+	MType     string    `json:"type"`
+	UpdatedAt time.Time `json:"updated_at"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// Janitor periodically deletes metrics expired according to the policy.
+type Janitor struct {
+	storage  store.Storage
+	policy   Policy
+	interval time.Duration
+	now      func() time.Time
+	// audit журнал аудита удалений, nil — удаления не записываются
+	audit *audit.Log
+}
+
+// NewJanitor creates a Janitor checking storage every interval.
+func NewJanitor(storage store.Storage, policy Policy, interval time.Duration) *Janitor {
+	return &Janitor{
+		storage:  storage,
+		policy:   policy,
+		interval: interval,
+		now:      time.Now,
+	}
+}
+
+// WithAudit makes the janitor record every deletion of an expired metric to log.
+func (j *Janitor) WithAudit(log *audit.Log) *Janitor {
+	j.audit = log
+	return j
+}
+
+// Preview returns the metrics that would be deleted by the next sweep, ordered by the expiration time.
+func (j *Janitor) Preview(ctx context.Context) ([]Expired, error) {
+	if !j.policy.Enabled() {
+		return []Expired{}, nil
+	}
+
+	metrics, err := j.storage.List(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list metrics: %w", err)
+	}
+
+	now := j.now()
+	expired := []Expired{}
+	for _, m := range metrics {
+		if !j.policy.Expired(m, now) {
+			continue
+		}
+		expiresAt, _ := j.policy.ExpiresAt(m)
+		expired = append(expired, Expired{
+			ID:        m.ID,
+			MType:     m.MType,
+			UpdatedAt: m.UpdatedAt,
+			ExpiresAt: expiresAt,
+		})
+	}
+	sort.Slice(expired, func(a, b int) bool {
+		return expired[a].ExpiresAt.Before(expired[b].ExpiresAt)
+	})
+	return expired, nil
+}
+
+// Sweep deletes expired metrics and returns them.
+// Every candidate is re-read before deletion, so a metric updated after the listing is kept.
+func (j *Janitor) Sweep(ctx context.Context) ([]Expired, error) {
+	ctx = store.WithConsistentRead(ctx)
+	candidates, err := j.Preview(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted := make([]Expired, 0, len(candidates))
+	for _, e := range candidates {
+		m, err := j.storage.Read(ctx, e.ID, e.MType)
+		if errors.Is(err, store.ErrValueNotFound) {
+			continue
+		}
+		if err != nil {
+			return deleted, fmt.Errorf("failed to read metric %s: %w", e.ID, err)
+		}
+		if !j.policy.Expired(m, j.now()) {
+			continue
+		}
+
+		err = j.storage.Delete(ctx, e.ID, e.MType)
+		j.audit.Record(ctx, audit.ActionExpire, audit.TargetRetention,
+			[]audit.Change{{ID: e.ID, MType: e.MType, Old: audit.ValueOf(m)}}, err)
+		if err != nil {
+			return deleted, fmt.Errorf("failed to delete metric %s: %w", e.ID, err)
+		}
+		logger.Logger().Info("expired metric deleted",
+			zap.String("id", e.ID),
+			zap.String("mType", e.MType),
+			zap.Time("updatedAt", e.UpdatedAt),
+			zap.Time("expiresAt", e.ExpiresAt),
+		)
+		deleted = append(deleted, e)
+	}
+	return deleted, nil
+}
+
+// Run sweeps expired metrics every interval until ctx is done.
+// A non-positive interval or a policy without retention disables the janitor.
+func (j *Janitor) Run(ctx context.Context) {
+	if j.interval <= 0 || !j.policy.Enabled() {
+		return
+	}
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := j.Sweep(ctx)
+			if err != nil {
+				logger.Logger().Error("failed to delete expired metrics", zap.Error(err))
+			}
+			if len(deleted) > 0 {
+				logger.Logger().Info("expired metrics deleted", zap.Int("count", len(deleted)))
+			}
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package retention
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/audit"
+	"github.com/andreevym/metric-collector/internal/storage/mem"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestJanitor_PreviewAndSweep(t *testing.T) {
+	ctx := context.Background()
+	storage := mem.NewStorage(nil)
+	for _, id := range []string{"cpu_1", "cpu_2", "Alloc"} {
+		value := 1.0
+		require.NoError(t, storage.Create(ctx, &store.Metric{ID: id, MType: store.MTypeGauge, Value: &value}))
+	}
+	delta := int64(1)
+	require.NoError(t, storage.Create(ctx, &store.Metric{ID: "PollCount", MType: store.MTypeCounter, Delta: &delta}))
+
+	sink, err := audit.NewFileSink(filepath.Join(t.TempDir(), "audit.log"), 0, 0)
+	require.NoError(t, err)
+	defer sink.Close()
+	janitor := NewJanitor(storage, Policy{
+		Default: 24 * time.Hour,
+		Rules:   []Rule{{Pattern: "cpu_*", TTL: time.Hour}},
+	}, time.Minute).WithAudit(audit.NewLog(sink))
+	janitor.now = func() time.Time { return time.Now().Add(2 * time.Hour) }
+
+	preview, err := janitor.Preview(ctx)
+	require.NoError(t, err)
+	require.Len(t, preview, 2)
+	ids := []string{preview[0].ID, preview[1].ID}
+	require.ElementsMatch(t, []string{"cpu_1", "cpu_2"}, ids)
+
+	// предпросмотр ничего не удаляет
+	metrics, err := storage.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, metrics, 4)
+
+	deleted, err := janitor.Sweep(ctx)
+	require.NoError(t, err)
+	require.Len(t, deleted, 2)
+
+	for _, id := range []string{"cpu_1", "cpu_2"} {
+		_, err = storage.Read(ctx, id, store.MTypeGauge)
+		require.ErrorIs(t, err, store.ErrValueNotFound)
+	}
+	metrics, err = storage.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+
+	// каждое удаление записывается в журнал аудита со значением удалённой метрики
+	events, err := sink.Query(ctx, audit.Filter{Action: audit.ActionExpire})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	for _, e := range events {
+		require.Equal(t, audit.TargetRetention, e.Target)
+		require.Empty(t, e.Error)
+		require.Len(t, e.Changes, 1)
+		require.Contains(t, []string{"cpu_1", "cpu_2"}, e.Changes[0].ID)
+		require.Equal(t, 1.0, *e.Changes[0].Old.Value)
+		require.Nil(t, e.Changes[0].New)
+	}
+}
+
+// staleListStorage returns a listing made before the latest updates.
+type staleListStorage struct {
+	store.Storage
+	listed []*store.Metric
+}
+
+func (s staleListStorage) List(_ context.Context) ([]*store.Metric, error) {
+	return s.listed, nil
+}
+
+func TestJanitor_SweepKeepsUpdatedMetric(t *testing.T) {
+	ctx := context.Background()
+	storage := mem.NewStorage(nil)
+	value := 1.0
+	require.NoError(t, storage.Create(ctx, &store.Metric{ID: "cpu_1", MType: store.MTypeGauge, Value: &value}))
+
+	janitor := NewJanitor(staleListStorage{
+		Storage: storage,
+		listed: []*store.Metric{
+			{ID: "cpu_1", MType: store.MTypeGauge, Value: &value, UpdatedAt: time.Now().Add(-2 * time.Hour)},
+		},
+	}, Policy{Rules: []Rule{{Pattern: "cpu_*", TTL: time.Hour}}}, time.Minute)
+
+	preview, err := janitor.Preview(ctx)
+	require.NoError(t, err)
+	require.Len(t, preview, 1)
+
+	deleted, err := janitor.Sweep(ctx)
+	require.NoError(t, err)
+	require.Empty(t, deleted)
+
+	_, err = storage.Read(ctx, "cpu_1", store.MTypeGauge)
+	require.NoError(t, err)
+}
+
+func TestJanitor_Disabled(t *testing.T) {
+	ctx := context.Background()
+	storage := mem.NewStorage(nil)
+	value := 1.0
+	require.NoError(t, storage.Create(ctx, &store.Metric{ID: "Alloc", MType: store.MTypeGauge, Value: &value}))
+
+	janitor := NewJanitor(storage, Policy{}, time.Minute)
+	janitor.now = func() time.Time { return time.Now().Add(1000 * time.Hour) }
+
+	preview, err := janitor.Preview(ctx)
+	require.NoError(t, err)
+	require.Empty(t, preview)
+
+	deleted, err := janitor.Sweep(ctx)
+	require.NoError(t, err)
+	require.Empty(t, deleted)
+
+	// Run сразу завершается, если политика не удаляет метрики
+	janitor.Run(ctx)
+}
@@ -0,0 +1,109 @@
+// Package retention expires metrics that haven't been updated for longer than the configured retention,
+// e.g. metrics of hosts whose agents were shut down.
+package retention
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/storage/store"
+)
+
+// Rule overrides the default retention for metrics whose ID matches Pattern.
+type Rule struct {
+	// Pattern shell pattern of the metric ID in the path.Match syntax, e.g. "cpu_*".
+	// Metrics of tenants are matched by the name without the tenant namespace,
+	// a pattern with the namespace, e.g. "team-a/*", matches metrics of a single tenant.
+	Pattern string
+	// TTL retention of the matching metrics, zero keeps them forever.
+	TTL time.Duration
+}
+
+// Policy defines how long metrics are kept after their last update.
+type Policy struct {
+	// Default retention of metrics not matched by any rule, zero keeps them forever.
+	Default time.Duration
+	// Rules are checked in order, the first matching rule wins.
+	Rules []Rule
+}
+
+// ParseRules parses a comma separated list of "pattern=duration" rules,
+// e.g. "cpu_*=1h,Custom*=720h". Durations use the time.ParseDuration syntax.
+func ParseRules(s string) ([]Rule, error) {
+	var rules []Rule
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		pattern, ttl, ok := strings.Cut(item, "=")
+		pattern = strings.TrimSpace(pattern)
+		if !ok || pattern == "" {
+			return nil, fmt.Errorf("retention rule '%s' must look like pattern=duration", item)
+		}
+		if _, err := path.Match(pattern, ""); err != nil {
+			return nil, fmt.Errorf("invalid pattern of retention rule '%s': %w", item, err)
+		}
+		d, err := time.ParseDuration(strings.TrimSpace(ttl))
+		if err != nil {
+			return nil, fmt.Errorf("invalid duration of retention rule '%s': %w", item, err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("retention rule '%s' has negative duration", item)
+		}
+
+		rules = append(rules, Rule{Pattern: pattern, TTL: d})
+	}
+	return rules, nil
+}
+
+// Enabled reports whether the policy can expire any metric.
+func (p Policy) Enabled() bool {
+	if p.Default > 0 {
+		return true
+	}
+	for _, r := range p.Rules {
+		if r.TTL > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// TTL returns the retention of the metric with the storage id, zero means the metric never expires.
+func (p Policy) TTL(id string) time.Duration {
+	// ключ хранения может содержать пространство имён арендатора, правила проверяются и по имени метрики
+	name := id
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	for _, r := range p.Rules {
+		// шаблоны проверены в ParseRules, поэтому ошибка означает лишь отсутствие совпадения
+		if ok, _ := path.Match(r.Pattern, name); ok {
+			return r.TTL
+		}
+		if ok, _ := path.Match(r.Pattern, id); ok && name != id {
+			return r.TTL
+		}
+	}
+	return p.Default
+}
+
+// ExpiresAt returns the time when m expires, ok is false if m never expires.
+// Metrics without the update time never expire, because their age is unknown.
+func (p Policy) ExpiresAt(m *store.Metric) (expiresAt time.Time, ok bool) {
+	ttl := p.TTL(m.ID)
+	if ttl <= 0 || m.UpdatedAt.IsZero() {
+		return time.Time{}, false
+	}
+	return m.UpdatedAt.Add(ttl), true
+}
+
+// Expired reports whether m is expired at now.
+func (p Policy) Expired(m *store.Metric, now time.Time) bool {
+	expiresAt, ok := p.ExpiresAt(m)
+	return ok && !now.Before(expiresAt)
+}
@@ -0,0 +1,83 @@
+package retention
+
+import (
+	"testing"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		rules   string
+		want    []Rule
+		wantErr bool
+	}{
+		{name: "empty", rules: "", want: nil},
+		{
+			name:  "several rules",
+			rules: "cpu_* = 1h, Custom*=720h,PollCount=0s",
+			want: []Rule{
+				{Pattern: "cpu_*", TTL: time.Hour},
+				{Pattern: "Custom*", TTL: 720 * time.Hour},
+				{Pattern: "PollCount", TTL: 0},
+			},
+		},
+		{name: "missing duration", rules: "cpu_*", wantErr: true},
+		{name: "missing pattern", rules: "=1h", wantErr: true},
+		{name: "invalid duration", rules: "cpu_*=1day", wantErr: true},
+		{name: "negative duration", rules: "cpu_*=-1h", wantErr: true},
+		{name: "invalid pattern", rules: "cpu_[=1h", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseRules(tt.rules)
+			if tt.wantErr {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPolicy_Expired(t *testing.T) {
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	policy := Policy{
+		Default: 24 * time.Hour,
+		Rules: []Rule{
+			{Pattern: "cpu_*", TTL: time.Hour},
+			{Pattern: "PollCount", TTL: 0},
+		},
+	}
+	metric := func(id string, age time.Duration) *store.Metric {
+		return &store.Metric{ID: id, MType: store.MTypeGauge, UpdatedAt: now.Add(-age)}
+	}
+
+	require.True(t, policy.Enabled())
+	require.True(t, policy.Expired(metric("cpu_1", 2*time.Hour), now))
+	require.False(t, policy.Expired(metric("cpu_1", 30*time.Minute), now))
+	require.True(t, policy.Expired(metric("Alloc", 25*time.Hour), now))
+	require.False(t, policy.Expired(metric("Alloc", 2*time.Hour), now))
+	require.False(t, policy.Expired(metric("PollCount", 1000*time.Hour), now), "rule with zero TTL keeps metric")
+	require.False(t, policy.Expired(&store.Metric{ID: "Alloc", MType: store.MTypeGauge}, now),
+		"metric without update time never expires")
+
+	// метрики арендаторов хранятся с пространством имён арендатора
+	require.True(t, policy.Expired(metric("team-a/cpu_1", 2*time.Hour), now))
+	require.False(t, policy.Expired(metric("team-a/cpu_1", 30*time.Minute), now))
+	require.False(t, policy.Expired(metric("team-a/PollCount", 1000*time.Hour), now))
+	require.True(t, policy.Expired(metric("team-a/Alloc", 25*time.Hour), now))
+
+	tenantPolicy := Policy{Rules: []Rule{{Pattern: "team-a/*", TTL: time.Hour}}}
+	require.True(t, tenantPolicy.Expired(metric("team-a/Alloc", 2*time.Hour), now))
+	require.False(t, tenantPolicy.Expired(metric("team-b/Alloc", 2*time.Hour), now))
+	require.False(t, tenantPolicy.Expired(metric("Alloc", 2*time.Hour), now))
+
+	require.False(t, Policy{}.Enabled())
+	require.False(t, Policy{Rules: []Rule{{Pattern: "*", TTL: 0}}}.Enabled())
+	require.False(t, Policy{}.Expired(metric("Alloc", 1000*time.Hour), now))
+}
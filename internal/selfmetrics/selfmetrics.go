@@ -0,0 +1,92 @@
+// Package selfmetrics periodically publishes the server's own metrics
+// (connection pool, caches, rejected requests and so on) into the metric storage.
+package selfmetrics
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"go.uber.org/zap"
+)
+
+// Source returns the current values of a group of self-metrics.
+type Source func() []*store.Metric
+
+// Reporter collects self-metrics from registered sources and saves them into the storage.
+type Reporter struct {
+	storage  store.Storage
+	interval time.Duration
+	sources  []Source
+	mu       sync.Mutex
+}
+
+// NewReporter creates a Reporter saving self-metrics into storage every interval.
+func NewReporter(storage store.Storage, interval time.Duration) *Reporter {
+	return &Reporter{
+		storage:  storage,
+		interval: interval,
+	}
+}
+
+// Register adds a source of self-metrics.
+func (r *Reporter) Register(source Source) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.sources = append(r.sources, source)
+}
+
+// Report collects metrics from all sources and saves them into the storage.
+func (r *Reporter) Report(ctx context.Context) error {
+	r.mu.Lock()
+	sources := r.sources
+	r.mu.Unlock()
+
+	metrics := map[string]store.MetricR{}
+	for _, source := range sources {
+		for _, m := range source() {
+			metrics[m.ID+m.MType] = store.MetricR{Metric: m}
+		}
+	}
+	if len(metrics) == 0 {
+		return nil
+	}
+
+	if err := r.storage.CreateAll(ctx, metrics); err != nil {
+		return fmt.Errorf("failed to save self metrics: %w", err)
+	}
+	return nil
+}
+
+// Run reports self-metrics every interval until ctx is done.
+// A non-positive interval disables reporting.
+func (r *Reporter) Run(ctx context.Context) {
+	if r.interval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(r.interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.Report(ctx); err != nil {
+				logger.Logger().Error("failed to report self metrics", zap.Error(err))
+			}
+		}
+	}
+}
+
+// Gauge builds a gauge self-metric.
+func Gauge(id string, value float64) *store.Metric {
+	return &store.Metric{
+		ID:    id,
+		MType: store.MTypeGauge,
+		Value: &value,
+	}
+}
@@ -0,0 +1,33 @@
+package selfmetrics
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andreevym/metric-collector/internal/storage/mem"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReporter_Report(t *testing.T) {
+	memStorage := mem.NewStorage(nil)
+	reporter := NewReporter(memStorage, 0)
+
+	err := reporter.Report(context.TODO())
+	require.NoError(t, err)
+
+	value := 1.0
+	reporter.Register(func() []*store.Metric {
+		value++
+		return []*store.Metric{Gauge("SelfMetric", value)}
+	})
+
+	for i := 0; i < 2; i++ {
+		err = reporter.Report(context.TODO())
+		require.NoError(t, err)
+	}
+
+	m, err := memStorage.Read(context.TODO(), "SelfMetric", store.MTypeGauge)
+	require.NoError(t, err)
+	require.Equal(t, 3.0, *m.Value)
+}
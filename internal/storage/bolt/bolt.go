@@ -0,0 +1,184 @@
+// Package bolt provides a metric storage backed by the embedded key-value store bbolt,
+// it is intended for single-node collectors running without Postgres.
+package bolt
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"go.etcd.io/bbolt"
+)
+
+const openTimeout = time.Second
+
+var metricBucket = []byte("metric")
+
+type Storage struct {
+	db *bbolt.DB
+}
+
+// NewStorage opens (or creates) the bbolt database file by path.
+func NewStorage(path string) (*Storage, error) {
+	db, err := bbolt.Open(path, 0o600, &bbolt.Options{Timeout: openTimeout})
+	if err != nil {
+		return nil, fmt.Errorf("failed to open bolt database '%s': %w", path, err)
+	}
+
+	err = db.Update(func(tx *bbolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(metricBucket)
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to create bucket: %w", err)
+	}
+
+	return &Storage{db: db}, nil
+}
+
+// Close releases the database file.
+func (s *Storage) Close() error {
+	return s.db.Close()
+}
+
+func (s *Storage) Create(_ context.Context, m *store.Metric) error {
+	if err := validateType(m); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return put(tx, m)
+	})
+}
+
+func (s *Storage) CreateAll(_ context.Context, metrics map[string]store.MetricR) error {
+	for _, m := range metrics {
+		if err := validateType(m.Metric); err != nil {
+			return err
+		}
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		for _, m := range metrics {
+			if err := put(tx, m.Metric); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (s *Storage) Read(_ context.Context, id string, mType string) (*store.Metric, error) {
+	var m *store.Metric
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		var err error
+		m, err = get(tx, id, mType)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+func (s *Storage) Update(_ context.Context, m *store.Metric) error {
+	if err := validateType(m); err != nil {
+		return err
+	}
+
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		if tx.Bucket(metricBucket).Get(key(m.ID, m.MType)) == nil {
+			return fmt.Errorf(
+				"%w: can't update value by id, because value doesn't exists: id %s",
+				store.ErrValueNotFound,
+				m.ID,
+			)
+		}
+		return put(tx, m)
+	})
+}
+
+func (s *Storage) List(_ context.Context) ([]*store.Metric, error) {
+	var metrics []*store.Metric
+	err := s.db.View(func(tx *bbolt.Tx) error {
+		return tx.Bucket(metricBucket).ForEach(func(k, v []byte) error {
+			m, err := decode(v)
+			if err != nil {
+				return fmt.Errorf("failed to unmarshal metric %s: %w", k, err)
+			}
+			metrics = append(metrics, m)
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	return metrics, nil
+}
+
+func (s *Storage) Delete(_ context.Context, id string, mType string) error {
+	return s.db.Update(func(tx *bbolt.Tx) error {
+		return tx.Bucket(metricBucket).Delete(key(id, mType))
+	})
+}
+
+// Backup does nothing: every write is durable once its transaction is committed.
+func (s *Storage) Backup() error {
+	return nil
+}
+
+// BackupPeriodically does nothing: every write is durable once its transaction is committed.
+func (s *Storage) BackupPeriodically() error {
+	return nil
+}
+
+func validateType(m *store.Metric) error {
+	if m.MType != store.MTypeGauge && m.MType != store.MTypeCounter {
+		return fmt.Errorf("metric type %s is not valid for ID %s", m.MType, m.ID)
+	}
+	return nil
+}
+
+// record is the stored representation of a metric, it keeps the update time hidden from the API representation.
+type record struct {
+	*store.Metric
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func put(tx *bbolt.Tx, m *store.Metric) error {
+	m.UpdatedAt = time.Now()
+	bytes, err := json.Marshal(record{Metric: m, UpdatedAt: m.UpdatedAt})
+	if err != nil {
+		return fmt.Errorf("failed to marshal metric %s: %w", m.ID, err)
+	}
+	return tx.Bucket(metricBucket).Put(key(m.ID, m.MType), bytes)
+}
+
+func get(tx *bbolt.Tx, id string, mType string) (*store.Metric, error) {
+	bytes := tx.Bucket(metricBucket).Get(key(id, mType))
+	if bytes == nil {
+		return nil, fmt.Errorf("%w: not found value by id %s", store.ErrValueNotFound, id)
+	}
+
+	m, err := decode(bytes)
+	if err != nil {
+		return nil, fmt.Errorf("failed to unmarshal metric %s: %w", id, err)
+	}
+	return m, nil
+}
+
+func decode(bytes []byte) (*store.Metric, error) {
+	r := record{Metric: &store.Metric{}}
+	if err := json.Unmarshal(bytes, &r); err != nil {
+		return nil, err
+	}
+	r.Metric.UpdatedAt = r.UpdatedAt
+	return r.Metric, nil
+}
+
+// key builds the bucket key, the type goes first because it can't contain the separator.
+func key(id string, mType string) []byte {
+	return []byte(mType + "/" + id)
+}
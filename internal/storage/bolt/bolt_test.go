@@ -0,0 +1,165 @@
+package bolt
+
+import (
+	"context"
+	"path/filepath"
+	"testing"
+
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/storage/storetest"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestStorage(t *testing.T) (*Storage, string) {
+	path := filepath.Join(t.TempDir(), "metrics.db")
+	s, err := NewStorage(path)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = s.Close()
+	})
+	return s, path
+}
+
+func TestStorage_Create(t *testing.T) {
+	i := int64(1)
+	tests := []struct {
+		name    string
+		m       *store.Metric
+		wantErr bool
+	}{
+		{
+			name: "create",
+			m: &store.Metric{
+				ID:    "k",
+				MType: store.MTypeCounter,
+				Delta: &i,
+			},
+			wantErr: false,
+		},
+		{
+			name: "create unknown type",
+			m: &store.Metric{
+				ID:    "k",
+				MType: "unknown",
+				Delta: &i,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestStorage(t)
+			if err := s.Create(context.TODO(), tt.m); (err != nil) != tt.wantErr {
+				t.Errorf("Create() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStorage_Update(t *testing.T) {
+	i := int64(1)
+	tests := []struct {
+		name    string
+		storage []*store.Metric
+		m       *store.Metric
+		wantErr bool
+	}{
+		{
+			name: "update exists",
+			storage: []*store.Metric{
+				{
+					ID:    "k",
+					MType: store.MTypeCounter,
+					Delta: &i,
+				},
+			},
+			m: &store.Metric{
+				ID:    "k",
+				MType: store.MTypeCounter,
+				Delta: &i,
+			},
+			wantErr: false,
+		},
+		{
+			name:    "update not exists",
+			storage: []*store.Metric{},
+			m: &store.Metric{
+				ID:    "k",
+				MType: store.MTypeCounter,
+				Delta: &i,
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestStorage(t)
+			for _, m := range tt.storage {
+				require.NoError(t, s.Create(context.TODO(), m))
+			}
+			if err := s.Update(context.TODO(), tt.m); (err != nil) != tt.wantErr {
+				t.Errorf("Update() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestStorageEndToEnd(t *testing.T) {
+	ctx := context.TODO()
+	s, path := newTestStorage(t)
+
+	delta := int64(1)
+	value := 1.5
+	counter := &store.Metric{ID: "m", MType: store.MTypeCounter, Delta: &delta}
+	gauge := &store.Metric{ID: "m", MType: store.MTypeGauge, Value: &value}
+
+	err := s.CreateAll(ctx, map[string]store.MetricR{
+		counter.ID + counter.MType: {Metric: counter},
+		gauge.ID + gauge.MType:     {Metric: gauge},
+	})
+	require.NoError(t, err)
+
+	err = store.SaveAllMetric(ctx, s, []*store.Metric{
+		{ID: "m", MType: store.MTypeCounter, Delta: &delta},
+	})
+	require.NoError(t, err)
+
+	found, err := s.Read(ctx, "m", store.MTypeCounter)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), *found.Delta)
+
+	err = s.Delete(ctx, "m", store.MTypeCounter)
+	require.NoError(t, err)
+
+	found, err = s.Read(ctx, "m", store.MTypeCounter)
+	require.ErrorIs(t, err, store.ErrValueNotFound)
+	require.Nil(t, found)
+
+	// the data must survive reopening the database file
+	require.NoError(t, s.Close())
+	s, err = NewStorage(path)
+	require.NoError(t, err)
+	defer s.Close()
+
+	found, err = s.Read(ctx, "m", store.MTypeGauge)
+	require.NoError(t, err)
+	require.Equal(t, value, *found.Value)
+}
+
+func TestStorageConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Backend {
+		s, path := newTestStorage(t)
+		return storetest.Backend{
+			Storage: s,
+			Reopen: func(t *testing.T) store.Storage {
+				require.NoError(t, s.Close())
+				reopened, err := NewStorage(path)
+				require.NoError(t, err)
+				t.Cleanup(func() {
+					_ = reopened.Close()
+				})
+				return reopened
+			},
+		}
+	})
+}
@@ -0,0 +1,211 @@
+// Package cache provides a store.Storage decorator that keeps recently used metrics
+// in a bounded LRU cache in front of a slower storage such as PgStorage.
+//
+// Writes go through to the wrapped storage first and then refresh the cached entry,
+// so the cache stays consistent as long as the server is the only writer of the wrapped storage.
+// TTL bounds staleness when that is not the case.
+//
+// Besides writes, the cache is filled only by reads marked with store.WithConsistentRead, which the
+// wrapped storage serves from the primary. Other reads may be served by a lagging read replica,
+// so their results are returned without being cached. Thus every cached value is up to date
+// and consistent reads of read-modify-write paths are served by the cache too.
+package cache
+
+import (
+	"container/list"
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/selfmetrics"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+)
+
+type Storage struct {
+	next     store.Storage
+	capacity int
+	ttl      time.Duration
+	now      func() time.Time
+
+	mu    sync.Mutex
+	items map[string]*list.Element
+	lru   *list.List
+
+	hits   atomic.Int64
+	misses atomic.Int64
+}
+
+type entry struct {
+	key       string
+	metric    store.Metric
+	expiresAt time.Time
+}
+
+// NewStorage wraps next with a cache of at most capacity metrics,
+// entries expire after ttl, a non-positive ttl keeps entries until they are evicted.
+func NewStorage(next store.Storage, capacity int, ttl time.Duration) *Storage {
+	return &Storage{
+		next:     next,
+		capacity: capacity,
+		ttl:      ttl,
+		now:      time.Now,
+		items:    map[string]*list.Element{},
+		lru:      list.New(),
+	}
+}
+
+func (s *Storage) Create(ctx context.Context, m *store.Metric) error {
+	if err := s.next.Create(ctx, m); err != nil {
+		s.invalidate(key(m.ID, m.MType))
+		return err
+	}
+	s.put(m)
+	return nil
+}
+
+func (s *Storage) CreateAll(ctx context.Context, metrics map[string]store.MetricR) error {
+	if err := s.next.CreateAll(ctx, metrics); err != nil {
+		for _, m := range metrics {
+			s.invalidate(key(m.Metric.ID, m.Metric.MType))
+		}
+		return err
+	}
+	for _, m := range metrics {
+		s.put(m.Metric)
+	}
+	return nil
+}
+
+// Read serves the metric from the cache, a miss is forwarded to the wrapped storage with the same ctx.
+// Only results of consistent reads are cached, see the package documentation.
+func (s *Storage) Read(ctx context.Context, id string, mType string) (*store.Metric, error) {
+	if m, ok := s.get(key(id, mType)); ok {
+		s.hits.Add(1)
+		return m, nil
+	}
+	s.misses.Add(1)
+
+	m, err := s.next.Read(ctx, id, mType)
+	if err != nil {
+		return nil, err
+	}
+	if store.IsConsistentRead(ctx) {
+		s.put(m)
+	}
+	return m, nil
+}
+
+func (s *Storage) Update(ctx context.Context, m *store.Metric) error {
+	if err := s.next.Update(ctx, m); err != nil {
+		s.invalidate(key(m.ID, m.MType))
+		return err
+	}
+	s.put(m)
+	return nil
+}
+
+// List always goes to the wrapped storage, the cache holds only recently used metrics.
+func (s *Storage) List(ctx context.Context) ([]*store.Metric, error) {
+	return s.next.List(ctx)
+}
+
+func (s *Storage) Delete(ctx context.Context, id string, mType string) error {
+	err := s.next.Delete(ctx, id, mType)
+	s.invalidate(key(id, mType))
+	return err
+}
+
+func (s *Storage) Backup() error {
+	return s.next.Backup()
+}
+
+func (s *Storage) BackupPeriodically() error {
+	return s.next.BackupPeriodically()
+}
+
+// Hits returns the number of reads served from the cache.
+func (s *Storage) Hits() int64 {
+	return s.hits.Load()
+}
+
+// Misses returns the number of reads forwarded to the wrapped storage.
+func (s *Storage) Misses() int64 {
+	return s.misses.Load()
+}
+
+// Metrics returns cache statistics as gauge metrics, it is meant to be registered as a self-metrics source.
+func (s *Storage) Metrics() []*store.Metric {
+	s.mu.Lock()
+	size := s.lru.Len()
+	s.mu.Unlock()
+
+	return []*store.Metric{
+		selfmetrics.Gauge("CacheHits", float64(s.Hits())),
+		selfmetrics.Gauge("CacheMisses", float64(s.Misses())),
+		selfmetrics.Gauge("CacheSize", float64(size)),
+	}
+}
+
+func (s *Storage) get(k string) (*store.Metric, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[k]
+	if !ok {
+		return nil, false
+	}
+	e := el.Value.(*entry)
+	if !e.expiresAt.IsZero() && !s.now().Before(e.expiresAt) {
+		s.remove(el)
+		return nil, false
+	}
+	s.lru.MoveToFront(el)
+	// callers are free to modify returned metrics, so the cached value is never shared
+	return store.CopyMetric(&e.metric), true
+}
+
+func (s *Storage) put(m *store.Metric) {
+	if s.capacity <= 0 || m == nil {
+		return
+	}
+
+	var expiresAt time.Time
+	if s.ttl > 0 {
+		expiresAt = s.now().Add(s.ttl)
+	}
+	k := key(m.ID, m.MType)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if el, ok := s.items[k]; ok {
+		e := el.Value.(*entry)
+		e.metric = *store.CopyMetric(m)
+		e.expiresAt = expiresAt
+		s.lru.MoveToFront(el)
+		return
+	}
+
+	s.items[k] = s.lru.PushFront(&entry{key: k, metric: *store.CopyMetric(m), expiresAt: expiresAt})
+	for s.lru.Len() > s.capacity {
+		s.remove(s.lru.Back())
+	}
+}
+
+func (s *Storage) invalidate(k string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[k]; ok {
+		s.remove(el)
+	}
+}
+
+func (s *Storage) remove(el *list.Element) {
+	s.lru.Remove(el)
+	delete(s.items, el.Value.(*entry).key)
+}
+
+func key(id string, mType string) string {
+	return mType + "/" + id
+}
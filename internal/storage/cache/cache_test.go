@@ -0,0 +1,259 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/storage/mem"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/storage/storetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Backend {
+		return storetest.Backend{Storage: NewStorage(mem.NewStorage(nil), 100, time.Minute)}
+	})
+}
+
+func TestStorage_HitMiss(t *testing.T) {
+	ctx := context.TODO()
+	memStorage := mem.NewStorage(nil)
+	s := NewStorage(memStorage, 10, time.Minute)
+
+	value := 1.5
+	require.NoError(t, memStorage.Create(ctx, &store.Metric{ID: "Alloc", MType: store.MTypeGauge, Value: &value}))
+
+	// an ordinary read may be served by a replica, so its result isn't cached
+	m, err := s.Read(ctx, "Alloc", store.MTypeGauge)
+	require.NoError(t, err)
+	require.Equal(t, value, *m.Value)
+	require.Equal(t, int64(1), s.Misses())
+
+	// a consistent read fills the cache for the following reads
+	_, err = s.Read(store.WithConsistentRead(ctx), "Alloc", store.MTypeGauge)
+	require.NoError(t, err)
+	for i := 0; i < 2; i++ {
+		m, err = s.Read(ctx, "Alloc", store.MTypeGauge)
+		require.NoError(t, err)
+		require.Equal(t, value, *m.Value)
+	}
+	require.Equal(t, int64(2), s.Hits())
+	require.Equal(t, int64(2), s.Misses())
+
+	_, err = s.Read(ctx, "missing", store.MTypeGauge)
+	require.ErrorIs(t, err, store.ErrValueNotFound)
+	require.Equal(t, int64(3), s.Misses())
+}
+
+func TestStorage_WriteThrough(t *testing.T) {
+	ctx := context.TODO()
+	memStorage := mem.NewStorage(nil)
+	s := NewStorage(memStorage, 10, time.Minute)
+
+	delta := int64(1)
+	require.NoError(t, s.Create(ctx, &store.Metric{ID: "PollCount", MType: store.MTypeCounter, Delta: &delta}))
+	err := store.SaveAllMetric(ctx, s, []*store.Metric{{ID: "PollCount", MType: store.MTypeCounter, Delta: &delta}})
+	require.NoError(t, err)
+
+	m, err := s.Read(ctx, "PollCount", store.MTypeCounter)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), *m.Delta)
+	// the consistent read of SaveAllMetric is served by the write-through entry
+	require.Equal(t, int64(0), s.Misses())
+	require.Equal(t, int64(2), s.Hits())
+
+	// a returned metric must not change the cached value
+	*m.Delta = 100
+	m, err = s.Read(ctx, "PollCount", store.MTypeCounter)
+	require.NoError(t, err)
+	require.Equal(t, int64(2), *m.Delta)
+
+	require.NoError(t, s.Delete(ctx, "PollCount", store.MTypeCounter))
+	_, err = s.Read(ctx, "PollCount", store.MTypeCounter)
+	require.ErrorIs(t, err, store.ErrValueNotFound)
+}
+
+func TestStorage_Eviction(t *testing.T) {
+	ctx := context.TODO()
+	s := NewStorage(mem.NewStorage(nil), 2, 0)
+
+	for i := 0; i < 3; i++ {
+		value := float64(i)
+		require.NoError(t, s.Create(ctx, &store.Metric{ID: fmt.Sprint(i), MType: store.MTypeGauge, Value: &value}))
+	}
+	require.Len(t, s.items, 2)
+
+	// "0" is the least recently used and must be read from the wrapped storage
+	_, err := s.Read(ctx, "0", store.MTypeGauge)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), s.Misses())
+	_, err = s.Read(ctx, "2", store.MTypeGauge)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), s.Hits())
+}
+
+func TestStorage_TTL(t *testing.T) {
+	ctx := context.TODO()
+	now := time.Now()
+	s := NewStorage(mem.NewStorage(nil), 10, time.Minute)
+	s.now = func() time.Time { return now }
+
+	value := 1.0
+	require.NoError(t, s.Create(ctx, &store.Metric{ID: "Alloc", MType: store.MTypeGauge, Value: &value}))
+	_, err := s.Read(ctx, "Alloc", store.MTypeGauge)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), s.Hits())
+
+	now = now.Add(time.Minute)
+	_, err = s.Read(ctx, "Alloc", store.MTypeGauge)
+	require.NoError(t, err)
+	require.Equal(t, int64(1), s.Misses())
+}
+
+// laggingReplicaStorage serves reads from a replica that lags behind the primary
+// unless ctx is marked with store.WithConsistentRead, like PgStorage with a replica.
+type laggingReplicaStorage struct {
+	store.Storage
+	replica store.Storage
+}
+
+func (s laggingReplicaStorage) Read(ctx context.Context, id string, mType string) (*store.Metric, error) {
+	if store.IsConsistentRead(ctx) {
+		return s.Storage.Read(ctx, id, mType)
+	}
+	return s.replica.Read(ctx, id, mType)
+}
+
+func TestStorage_LaggingReplica(t *testing.T) {
+	ctx := context.TODO()
+	primary, replica := mem.NewStorage(nil), mem.NewStorage(nil)
+	s := NewStorage(laggingReplicaStorage{Storage: primary, replica: replica}, 10, time.Minute)
+
+	stale, fresh := int64(1), int64(5)
+	require.NoError(t, replica.Create(ctx, &store.Metric{ID: "PollCount", MType: store.MTypeCounter, Delta: &stale}))
+	require.NoError(t, primary.Create(ctx, &store.Metric{ID: "PollCount", MType: store.MTypeCounter, Delta: &fresh}))
+
+	// an ordinary miss is served by the replica and the stale value is not cached
+	m, err := s.Read(ctx, "PollCount", store.MTypeCounter)
+	require.NoError(t, err)
+	require.Equal(t, stale, *m.Delta)
+
+	// the consistent read of SaveAllMetric goes to the primary and fills the cache
+	delta := int64(1)
+	require.NoError(t, store.SaveAllMetric(ctx, s, []*store.Metric{{ID: "PollCount", MType: store.MTypeCounter, Delta: &delta}}))
+	m, err = primary.Read(ctx, "PollCount", store.MTypeCounter)
+	require.NoError(t, err)
+	require.Equal(t, int64(6), *m.Delta)
+
+	// the write-through entry serves further consistent and ordinary reads
+	require.NoError(t, store.SaveAllMetric(ctx, s, []*store.Metric{{ID: "PollCount", MType: store.MTypeCounter, Delta: &delta}}))
+	m, err = primary.Read(ctx, "PollCount", store.MTypeCounter)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), *m.Delta)
+	m, err = s.Read(ctx, "PollCount", store.MTypeCounter)
+	require.NoError(t, err)
+	require.Equal(t, int64(7), *m.Delta)
+	require.Equal(t, int64(2), s.Hits())
+	require.Equal(t, int64(2), s.Misses())
+}
+
+// slowStorage emulates the network round-trip of a remote database.
+type slowStorage struct {
+	store.Storage
+	latency time.Duration
+}
+
+func (s slowStorage) Read(ctx context.Context, id string, mType string) (*store.Metric, error) {
+	time.Sleep(s.latency)
+	return s.Storage.Read(ctx, id, mType)
+}
+
+func (s slowStorage) CreateAll(ctx context.Context, metrics map[string]store.MetricR) error {
+	time.Sleep(s.latency)
+	return s.Storage.CreateAll(ctx, metrics)
+}
+
+// BenchmarkSaveAllMetric compares SaveAllMetric for an agent-sized batch
+// against a storage with 100µs round-trips, with and without the cache.
+func BenchmarkSaveAllMetric(b *testing.B) {
+	const batchSize = 30
+
+	benchmarks := []struct {
+		name    string
+		storage func() store.Storage
+	}{
+		{
+			name: "uncached",
+			storage: func() store.Storage {
+				return slowStorage{Storage: mem.NewStorage(nil), latency: 100 * time.Microsecond}
+			},
+		},
+		{
+			name: "cached",
+			storage: func() store.Storage {
+				return NewStorage(slowStorage{Storage: mem.NewStorage(nil), latency: 100 * time.Microsecond}, 1000, time.Minute)
+			},
+		},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			s := bm.storage()
+			ctx := context.Background()
+			for i := 0; i < b.N; i++ {
+				metrics := make([]*store.Metric, 0, batchSize)
+				for j := 0; j < batchSize; j++ {
+					delta := int64(1)
+					metrics = append(metrics, &store.Metric{ID: fmt.Sprint(j), MType: store.MTypeCounter, Delta: &delta})
+				}
+				require.NoError(b, store.SaveAllMetric(ctx, s, metrics))
+			}
+		})
+	}
+}
+
+// BenchmarkRead compares reads of metrics reported by agents, as served by the /value handler,
+// against a storage with 100µs round-trips, with and without the cache.
+func BenchmarkRead(b *testing.B) {
+	const metricsCount = 30
+
+	benchmarks := []struct {
+		name    string
+		storage func() store.Storage
+	}{
+		{
+			name: "uncached",
+			storage: func() store.Storage {
+				return slowStorage{Storage: mem.NewStorage(nil), latency: 100 * time.Microsecond}
+			},
+		},
+		{
+			name: "cached",
+			storage: func() store.Storage {
+				return NewStorage(slowStorage{Storage: mem.NewStorage(nil), latency: 100 * time.Microsecond}, 1000, time.Minute)
+			},
+		},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			s := bm.storage()
+			ctx := context.Background()
+			metrics := make([]*store.Metric, 0, metricsCount)
+			for j := 0; j < metricsCount; j++ {
+				value := float64(j)
+				metrics = append(metrics, &store.Metric{ID: fmt.Sprint(j), MType: store.MTypeGauge, Value: &value})
+			}
+			require.NoError(b, store.SaveAllMetric(ctx, s, metrics))
+
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				for _, m := range metrics {
+					_, err := s.Read(ctx, m.ID, m.MType)
+					require.NoError(b, err)
+				}
+			}
+		})
+	}
+}
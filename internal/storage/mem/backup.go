@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"os"
+	"time"
 
 	"github.com/andreevym/metric-collector/internal/logger"
 	"github.com/andreevym/metric-collector/internal/storage/store"
@@ -82,7 +83,13 @@ func Save(filename string, data map[string]*store.Metric) error {
 }
 
 type metricStore struct {
-	Metrics map[string]*store.Metric `json:"storage"`
+	Metrics map[string]*backupMetric `json:"storage"`
+}
+
+// backupMetric keeps the update time of the metric in the backup, it is hidden from the API representation.
+type backupMetric struct {
+	*store.Metric
+	UpdatedAt time.Time `json:"updated_at"`
 }
 
 func marshal(data []byte) (map[string]*store.Metric, error) {
@@ -92,9 +99,21 @@ func marshal(data []byte) (map[string]*store.Metric, error) {
 		logger.Logger().Error(err.Error())
 		return nil, err
 	}
-	return v.Metrics, nil
+	metrics := make(map[string]*store.Metric, len(v.Metrics))
+	for k, m := range v.Metrics {
+		if m == nil || m.Metric == nil {
+			continue
+		}
+		m.Metric.UpdatedAt = m.UpdatedAt
+		metrics[k] = m.Metric
+	}
+	return metrics, nil
 }
 
 func unmarshal(m map[string]*store.Metric) ([]byte, error) {
-	return json.Marshal(metricStore{m})
+	v := metricStore{Metrics: make(map[string]*backupMetric, len(m))}
+	for k, metric := range m {
+		v.Metrics[k] = &backupMetric{Metric: metric, UpdatedAt: metric.UpdatedAt}
+	}
+	return json.Marshal(v)
 }
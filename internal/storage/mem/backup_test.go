@@ -4,6 +4,7 @@ import (
 	"os"
 	"strconv"
 	"testing"
+	"time"
 
 	"github.com/andreevym/metric-collector/internal/storage/store"
 	"github.com/stretchr/testify/require"
@@ -37,3 +38,20 @@ func TestEndToEndBackup(t *testing.T) {
 	require.Equal(t, len(loadedData), len(data))
 
 }
+
+func TestBackupKeepsUpdatedAt(t *testing.T) {
+	path := t.TempDir() + "/backup.json"
+	updatedAt := time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC)
+	value := 1.5
+	data := map[string]*store.Metric{
+		"agauge": {ID: "a", MType: store.MTypeGauge, Value: &value, UpdatedAt: updatedAt},
+	}
+
+	require.NoError(t, Save(path, data))
+
+	loadedData, err := Load(path)
+	require.NoError(t, err)
+	require.Contains(t, loadedData, "agauge")
+	require.True(t, updatedAt.Equal(loadedData["agauge"].UpdatedAt))
+	require.Equal(t, value, *loadedData["agauge"].Value)
+}
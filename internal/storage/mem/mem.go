@@ -31,10 +31,11 @@ func NewStorage(opt *BackupOptional) *Storage {
 }
 
 func (s *Storage) Create(_ context.Context, m *store.Metric) error {
-	s.Lock()
 	if m.MType != store.MTypeGauge && m.MType != store.MTypeCounter {
 		return fmt.Errorf("metric type %s is not valid for ID %s", m.MType, m.ID)
 	}
+	m.UpdatedAt = time.Now()
+	s.Lock()
 	s.data[m.ID+m.MType] = m
 	s.Unlock()
 	err := s.Backup()
@@ -45,11 +46,15 @@ func (s *Storage) Create(_ context.Context, m *store.Metric) error {
 }
 
 func (s *Storage) CreateAll(_ context.Context, metrics map[string]store.MetricR) error {
-	s.Lock()
 	for _, m := range metrics {
 		if m.Metric.MType != store.MTypeGauge && m.Metric.MType != store.MTypeCounter {
 			return fmt.Errorf("metric type %s is not valid for ID %s", m.Metric.MType, m.Metric.ID)
 		}
+	}
+	now := time.Now()
+	s.Lock()
+	for _, m := range metrics {
+		m.Metric.UpdatedAt = now
 		s.data[m.Metric.ID+m.Metric.MType] = m.Metric
 	}
 	s.Unlock()
@@ -61,7 +66,9 @@ func (s *Storage) CreateAll(_ context.Context, metrics map[string]store.MetricR)
 }
 
 func (s *Storage) Read(_ context.Context, id string, mType string) (*store.Metric, error) {
+	s.RLock()
 	v, ok := s.data[id+mType]
+	s.RUnlock()
 	if !ok {
 		return nil, fmt.Errorf("%w: not found value by id %s", store.ErrValueNotFound, id)
 	}
@@ -69,17 +76,20 @@ func (s *Storage) Read(_ context.Context, id string, mType string) (*store.Metri
 }
 
 func (s *Storage) Update(_ context.Context, m *store.Metric) error {
-	s.Lock()
 	if m.MType != store.MTypeGauge && m.MType != store.MTypeCounter {
 		return fmt.Errorf("metric type %s is not valid for ID %s", m.MType, m.ID)
 	}
+	s.Lock()
 	_, ok := s.data[m.ID+m.MType]
 	if !ok {
+		s.Unlock()
 		return fmt.Errorf(
-			"can't update value by id, because value doesn't exists: id %s",
+			"%w: can't update value by id, because value doesn't exists: id %s",
+			store.ErrValueNotFound,
 			m.ID,
 		)
 	}
+	m.UpdatedAt = time.Now()
 	s.data[m.ID+m.MType] = m
 	s.Unlock()
 	err := s.Backup()
@@ -89,9 +99,32 @@ func (s *Storage) Update(_ context.Context, m *store.Metric) error {
 	return nil
 }
 
+func (s *Storage) List(_ context.Context) ([]*store.Metric, error) {
+	s.RLock()
+	defer s.RUnlock()
+	metrics := make([]*store.Metric, 0, len(s.data))
+	for _, m := range s.data {
+		metrics = append(metrics, m)
+	}
+	return metrics, nil
+}
+
 func (s *Storage) Delete(_ context.Context, id string, mType string) error {
+	s.Lock()
 	delete(s.data, id+mType)
-	return nil
+	s.Unlock()
+	return s.Backup()
+}
+
+// snapshot returns a copy of the stored metrics, so that a backup doesn't hold the lock while writing the file.
+func (s *Storage) snapshot() map[string]*store.Metric {
+	s.RLock()
+	defer s.RUnlock()
+	data := make(map[string]*store.Metric, len(s.data))
+	for k, v := range s.data {
+		data[k] = v
+	}
+	return data
 }
 
 func (s *Storage) Restore() error {
@@ -102,7 +135,16 @@ func (s *Storage) Restore() error {
 	if err != nil {
 		return err
 	}
+	// бэкапы старого формата не содержат время обновления, отсчитываем срок хранения от момента восстановления
+	now := time.Now()
+	for _, m := range data {
+		if m.UpdatedAt.IsZero() {
+			m.UpdatedAt = now
+		}
+	}
+	s.Lock()
 	s.data = data
+	s.Unlock()
 
 	return nil
 }
@@ -112,7 +154,7 @@ func (s *Storage) Backup() error {
 		return nil
 	}
 
-	err := Save(s.opt.BackupPath, s.data)
+	err := Save(s.opt.BackupPath, s.snapshot())
 	if err != nil {
 		logger.Logger().Error("problem to save backup ", zap.Error(err))
 		return fmt.Errorf("save backup: %s", err)
@@ -126,7 +168,7 @@ func (s *Storage) BackupPeriodically() error {
 		return nil
 	}
 
-	err := Save(s.opt.BackupPath, s.data)
+	err := Save(s.opt.BackupPath, s.snapshot())
 	if err != nil {
 		logger.Logger().Error("problem to save backup ", zap.Error(err))
 		return fmt.Errorf("save backup: %s", err)
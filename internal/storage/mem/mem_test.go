@@ -2,9 +2,12 @@ package mem
 
 import (
 	"context"
+	"path/filepath"
 	"testing"
 
 	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/storage/storetest"
+	"github.com/stretchr/testify/require"
 )
 
 func TestStorage_Create(t *testing.T) {
@@ -85,3 +88,17 @@ func TestStorage_Update(t *testing.T) {
 		})
 	}
 }
+
+func TestStorageConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Backend {
+		opt := &BackupOptional{BackupPath: filepath.Join(t.TempDir(), "metrics-db.json")}
+		return storetest.Backend{
+			Storage: NewStorage(opt),
+			Reopen: func(t *testing.T) store.Storage {
+				s := NewStorage(opt)
+				require.NoError(t, s.Restore())
+				return s
+			},
+		}
+	})
+}
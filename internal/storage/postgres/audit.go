@@ -0,0 +1,120 @@
+package postgres
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/audit"
+)
+
+const (
+	insertAuditSQL = "INSERT INTO audit (time, action, client, tenant, subject, \"user\", ip, target, changes, error) " +
+		"VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)"
+	selectAuditSQL = "SELECT time, action, client, tenant, subject, \"user\", ip, target, changes, error FROM audit"
+	// auditQueryTimeout время на выборку событий аудита, выборка по большому журналу может быть долгой
+	auditQueryTimeout = 10 * time.Second
+)
+
+// AuditSink stores audit events in the audit table.
+type AuditSink struct {
+	client *PgClient
+}
+
+// NewAuditSink creates an audit.Sink writing to the audit table of the database of client.
+func NewAuditSink(client *PgClient) *AuditSink {
+	return &AuditSink{client: client}
+}
+
+// Write inserts the event.
+func (s *AuditSink) Write(ctx context.Context, e audit.Event) error {
+	rCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	changes, err := json.Marshal(e.Changes)
+	if err != nil {
+		return fmt.Errorf("failed to marshal audit changes: %w", err)
+	}
+	if e.Changes == nil {
+		changes = []byte("[]")
+	}
+	_, err = s.client.db.ExecContext(rCtx, insertAuditSQL,
+		e.Time, e.Action, e.Client, e.Tenant, e.Subject, e.User, e.IP, e.Target, string(changes), e.Error)
+	if err != nil {
+		return fmt.Errorf("failed insert audit event: %w", err)
+	}
+	return nil
+}
+
+// Query selects the latest events matching the filter, newest first.
+func (s *AuditSink) Query(ctx context.Context, f audit.Filter) ([]audit.Event, error) {
+	rCtx, cancel := context.WithTimeout(ctx, auditQueryTimeout)
+	defer cancel()
+
+	var conditions []string
+	var args []any
+	where := func(condition string, arg any) {
+		args = append(args, arg)
+		conditions = append(conditions, strings.ReplaceAll(condition, "?", "$"+strconv.Itoa(len(args))))
+	}
+	if !f.Since.IsZero() {
+		where("time >= ?", f.Since)
+	}
+	if !f.Until.IsZero() {
+		where("time < ?", f.Until)
+	}
+	if f.Action != "" {
+		where("action = ?", f.Action)
+	}
+	if f.Client != "" {
+		where("client = ?", f.Client)
+	}
+	if f.Tenant != "" {
+		where("tenant = ?", f.Tenant)
+	}
+	if f.MetricID != "" {
+		metric, err := json.Marshal([]map[string]string{{"id": f.MetricID}})
+		if err != nil {
+			return nil, fmt.Errorf("failed to marshal metric filter: %w", err)
+		}
+		where("changes @> ?::jsonb", string(metric))
+	}
+
+	query := selectAuditSQL
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	args = append(args, f.EffectiveLimit())
+	query += " ORDER BY time DESC, id DESC LIMIT $" + strconv.Itoa(len(args))
+
+	rows, err := s.client.db.QueryContext(rCtx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed select audit events: %w", err)
+	}
+	defer rows.Close()
+
+	events := []audit.Event{}
+	for rows.Next() {
+		var e audit.Event
+		var changes []byte
+		err = rows.Scan(&e.Time, &e.Action, &e.Client, &e.Tenant, &e.Subject, &e.User, &e.IP, &e.Target, &changes, &e.Error)
+		if err != nil {
+			return nil, fmt.Errorf("failed scan audit event: %w", err)
+		}
+		if err = json.Unmarshal(changes, &e.Changes); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal audit changes: %w", err)
+		}
+		if len(e.Changes) == 0 {
+			e.Changes = nil
+		}
+		e.Time = e.Time.UTC()
+		events = append(events, e)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed select audit events: %w", err)
+	}
+	return events, nil
+}
@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
+)
+
+const (
+	// copyThreshold минимальный размер пачки метрик, начиная с которого SaveAll использует COPY.
+	copyThreshold = 1000
+	// saveAllTimeout время на сохранение одной пачки метрик.
+	saveAllTimeout = 5 * time.Second
+)
+
+const (
+	createStagingTableSQL = "CREATE TEMPORARY TABLE metric_staging " +
+		"(id TEXT, type TEXT, delta bigint, value double precision) ON COMMIT DROP"
+	// mergeStagingSQL переносит метрики из staging-таблицы одним запросом,
+	// DISTINCT ON защищает ON CONFLICT от повторного изменения одной и той же строки.
+	mergeStagingSQL = "INSERT INTO metric (id, type, delta, value) " +
+		"SELECT DISTINCT ON (id, type) id, type::metric_type, delta, value FROM metric_staging " +
+		"ON CONFLICT (id, type) DO UPDATE SET delta = EXCLUDED.delta, value = EXCLUDED.value, updated_at = now()"
+)
+
+var stagingColumns = []string{"id", "type", "delta", "value"}
+
+// saveAllCopy streams metrics into a temporary staging table with COPY
+// and merges them into the metric table with a single statement.
+func (c *PgClient) saveAllCopy(ctx context.Context, metrics []*store.Metric) error {
+	return c.withPgxConn(ctx, func(conn *pgx.Conn) error {
+		return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			if _, err := tx.Exec(ctx, createStagingTableSQL); err != nil {
+				return fmt.Errorf("failed create staging table: %w", err)
+			}
+
+			_, err := tx.CopyFrom(
+				ctx,
+				pgx.Identifier{"metric_staging"},
+				stagingColumns,
+				pgx.CopyFromSlice(len(metrics), func(i int) ([]any, error) {
+					m := metrics[i]
+					return []any{m.ID, m.MType, m.Delta, m.Value}, nil
+				}),
+			)
+			if err != nil {
+				return fmt.Errorf("failed copy to staging table: %w", err)
+			}
+
+			if _, err = tx.Exec(ctx, mergeStagingSQL); err != nil {
+				return fmt.Errorf("failed merge staging table: %w", err)
+			}
+			return nil
+		})
+	})
+}
+
+// saveAllBatch pipelines an upsert per metric in a single round-trip with pgx.Batch.
+func (c *PgClient) saveAllBatch(ctx context.Context, metrics []*store.Metric) error {
+	return c.withPgxConn(ctx, func(conn *pgx.Conn) error {
+		return pgx.BeginFunc(ctx, conn, func(tx pgx.Tx) error {
+			batch := &pgx.Batch{}
+			for _, m := range metrics {
+				batch.Queue(upsertMetricSQL, m.ID, m.MType, m.Delta, m.Value)
+			}
+
+			if err := tx.SendBatch(ctx, batch).Close(); err != nil {
+				return fmt.Errorf("failed upsert batch: %w", err)
+			}
+			return nil
+		})
+	})
+}
+
+// withPgxConn borrows a connection from the database/sql pool
+// and exposes the underlying pgx connection for COPY and batch operations.
+func (c *PgClient) withPgxConn(ctx context.Context, fn func(conn *pgx.Conn) error) error {
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return fmt.Errorf("failed get connection: %w", err)
+	}
+	defer conn.Close()
+
+	return conn.Raw(func(driverConn any) error {
+		stdlibConn, ok := driverConn.(*stdlib.Conn)
+		if !ok {
+			return fmt.Errorf("unexpected driver connection type %T", driverConn)
+		}
+		return fn(stdlibConn.Conn())
+	})
+}
@@ -0,0 +1,48 @@
+//go:build integration_test
+
+package postgres_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/andreevym/metric-collector/internal/storage/postgres"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/storage/storetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPgStorageConformance(t *testing.T) {
+	ctx := context.Background()
+	dbName := strings.ToLower(t.Name())
+	err := CreateTestDB(ctx, dbName, testDBUserName)
+	require.NoError(t, err)
+
+	dsn := getDSN(hostPort, dbName, testDBUserName, testDBUserPassword)
+	pgClient, err := postgres.NewPgClient(dsn, nil)
+	require.NoError(t, err)
+
+	migrate(t, pgClient)
+
+	storetest.Run(t, func(t *testing.T) storetest.Backend {
+		err := pgClient.ApplyMigration(ctx, "TRUNCATE metric")
+		require.NoError(t, err)
+		return storetest.Backend{
+			Storage: postgres.NewPgStorage(pgClient),
+			Reopen: func(t *testing.T) store.Storage {
+				reopened, err := postgres.NewPgClient(dsn, nil)
+				require.NoError(t, err)
+				t.Cleanup(func() {
+					_ = reopened.Close()
+				})
+				return postgres.NewPgStorage(reopened)
+			},
+		}
+	})
+
+	err = pgClient.Close()
+	require.NoError(t, err)
+	err = DropTestDB(ctx, dbName)
+	require.NoError(t, err)
+}
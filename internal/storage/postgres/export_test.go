@@ -0,0 +1,19 @@
+//go:build integration_test
+
+package postgres
+
+import (
+	"context"
+
+	"github.com/andreevym/metric-collector/internal/storage/store"
+)
+
+// SaveAllCopy exposes the COPY path of SaveAll for benchmarks.
+func (c *PgClient) SaveAllCopy(ctx context.Context, metrics []*store.Metric) error {
+	return c.saveAllCopy(ctx, metrics)
+}
+
+// SaveAllBatch exposes the pgx.Batch path of SaveAll for benchmarks.
+func (c *PgClient) SaveAllBatch(ctx context.Context, metrics []*store.Metric) error {
+	return c.saveAllBatch(ctx, metrics)
+}
@@ -105,6 +105,21 @@ func (mr *MockStorageMockRecorder) Delete(ctx, id, mType interface{}) *gomock.Ca
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "Delete", reflect.TypeOf((*MockStorage)(nil).Delete), ctx, id, mType)
 }
 
+// List mocks base method.
+func (m *MockStorage) List(ctx context.Context) ([]*store.Metric, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "List", ctx)
+	ret0, _ := ret[0].([]*store.Metric)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// List indicates an expected call of List.
+func (mr *MockStorageMockRecorder) List(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "List", reflect.TypeOf((*MockStorage)(nil).List), ctx)
+}
+
 // Read mocks base method.
 func (m *MockStorage) Read(ctx context.Context, id, mType string) (*store.Metric, error) {
 	m.ctrl.T.Helper()
@@ -241,6 +256,21 @@ func (mr *MockClientMockRecorder) SaveAll(ctx, metrics interface{}) *gomock.Call
 	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SaveAll", reflect.TypeOf((*MockClient)(nil).SaveAll), ctx, metrics)
 }
 
+// SelectAll mocks base method.
+func (m *MockClient) SelectAll(ctx context.Context) ([]*store.Metric, error) {
+	m.ctrl.T.Helper()
+	ret := m.ctrl.Call(m, "SelectAll", ctx)
+	ret0, _ := ret[0].([]*store.Metric)
+	ret1, _ := ret[1].(error)
+	return ret0, ret1
+}
+
+// SelectAll indicates an expected call of SelectAll.
+func (mr *MockClientMockRecorder) SelectAll(ctx interface{}) *gomock.Call {
+	mr.mock.ctrl.T.Helper()
+	return mr.mock.ctrl.RecordCallWithMethodType(mr.mock, "SelectAll", reflect.TypeOf((*MockClient)(nil).SelectAll), ctx)
+}
+
 // SelectByIDAndType mocks base method.
 func (m *MockClient) SelectByIDAndType(ctx context.Context, id, mType string) (*store.Metric, error) {
 	m.ctrl.T.Helper()
@@ -4,26 +4,83 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"strconv"
+	"sync/atomic"
 	"time"
 
 	"github.com/andreevym/metric-collector/internal/storage/store"
-	_ "github.com/jackc/pgx/v5/stdlib"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/stdlib"
 	"github.com/jmoiron/sqlx"
 )
 
+// upsertMetricSQL inserts a metric or overwrites the stored delta and value
+// of the metric with the same composite key (id, type).
+const upsertMetricSQL = "INSERT INTO metric (id, type, delta, value) VALUES ($1, $2::text::metric_type, $3, $4) " +
+	"ON CONFLICT (id, type) DO UPDATE SET delta = EXCLUDED.delta, value = EXCLUDED.value, updated_at = now()"
+
+// selectMetricSQL selects metrics with the column aliases matching the store.Metric fields.
+const selectMetricSQL = "SELECT id as \"id\", type::text as \"mtype\", delta as \"delta\", value as \"value\", " +
+	"updated_at as \"updatedat\" FROM metric "
+
 type PgClient struct {
 	db *sqlx.DB
+	// lastWaitCount количество ожиданий свободного соединения на момент прошлого снятия статистики пула
+	lastWaitCount atomic.Int64
 }
 
-func NewPgClient(databaseDsn string) (*PgClient, error) {
-	db, err := sqlx.Open("pgx", databaseDsn)
+// PoolOptional configures the connection pool of PgClient, zero values keep database/sql defaults.
+type PoolOptional struct {
+	MaxOpenConns     int
+	MaxIdleConns     int
+	ConnMaxLifetime  time.Duration
+	ConnMaxIdleTime  time.Duration
+	StatementTimeout time.Duration
+}
+
+func NewPgClient(databaseDsn string, opt *PoolOptional) (*PgClient, error) {
+	connConfig, err := pgx.ParseConfig(databaseDsn)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to parse database dsn: %w", err)
+	}
+	if opt != nil && opt.StatementTimeout > 0 {
+		connConfig.RuntimeParams["statement_timeout"] = strconv.FormatInt(opt.StatementTimeout.Milliseconds(), 10)
 	}
 
+	db := sqlx.NewDb(stdlib.OpenDB(*connConfig), "pgx")
+	opt.apply(db.DB)
+
 	return &PgClient{db: db}, nil
 }
 
+// poolConfigurer is the part of *sql.DB that configures the connection pool.
+type poolConfigurer interface {
+	SetMaxOpenConns(n int)
+	SetMaxIdleConns(n int)
+	SetConnMaxLifetime(d time.Duration)
+	SetConnMaxIdleTime(d time.Duration)
+}
+
+// apply configures the pool of db, only positive values override the database/sql defaults,
+// e.g. zero MaxIdleConns keeps two idle connections instead of disabling them.
+func (opt *PoolOptional) apply(db poolConfigurer) {
+	if opt == nil {
+		return
+	}
+	if opt.MaxOpenConns > 0 {
+		db.SetMaxOpenConns(opt.MaxOpenConns)
+	}
+	if opt.MaxIdleConns > 0 {
+		db.SetMaxIdleConns(opt.MaxIdleConns)
+	}
+	if opt.ConnMaxLifetime > 0 {
+		db.SetConnMaxLifetime(opt.ConnMaxLifetime)
+	}
+	if opt.ConnMaxIdleTime > 0 {
+		db.SetConnMaxIdleTime(opt.ConnMaxIdleTime)
+	}
+}
+
 func (c *PgClient) Close() error {
 	return c.db.Close()
 }
@@ -44,12 +101,15 @@ func (c *PgClient) SelectByIDAndType(ctx context.Context, id string, mType strin
 	rCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
 
+	// неизвестный тип не может храниться в колонке metric_type, поэтому такой метрики нет
+	if !isMetricType(mType) {
+		return nil, store.ErrValueNotFound
+	}
 	var metrics []store.Metric
 	err := c.db.SelectContext(
 		rCtx,
 		&metrics,
-		"SELECT id as \"id\", type as \"mtype\", delta as \"delta\", value as \"value\" "+
-			"FROM metric WHERE id = $1 and type = $2;",
+		selectMetricSQL+"WHERE id = $1 and type = $2::text::metric_type;",
 		id,
 		mType,
 	)
@@ -66,20 +126,29 @@ func (c *PgClient) SelectByIDAndType(ctx context.Context, id string, mType strin
 	return &metrics[0], nil
 }
 
-func (c *PgClient) Insert(ctx context.Context, m *store.Metric) error {
-	rCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+func (c *PgClient) SelectAll(ctx context.Context) ([]*store.Metric, error) {
+	rCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
 	defer cancel()
 
-	if m.MType != store.MTypeGauge && m.MType != store.MTypeCounter {
-		return fmt.Errorf("metric type %s is not valid for ID %s", m.MType, m.ID)
+	var metrics []*store.Metric
+	err := c.db.SelectContext(rCtx, &metrics, selectMetricSQL+"ORDER BY type, id;")
+	if err != nil {
+		return nil, fmt.Errorf("failed execute select: %w", err)
 	}
 
-	if m.Delta == nil && m.Value == nil {
-		return errors.New("metric can't have nil delta and nil value")
+	return metrics, nil
+}
+
+func (c *PgClient) Insert(ctx context.Context, m *store.Metric) error {
+	rCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	defer cancel()
+
+	if err := validateMetric(m); err != nil {
+		return err
 	}
 	r, err := c.db.ExecContext(
 		rCtx,
-		"INSERT INTO metric (id, type, delta, value) VALUES ($1, $2, $3, $4)",
+		"INSERT INTO metric (id, type, delta, value) VALUES ($1, $2::text::metric_type, $3, $4)",
 		m.ID,
 		m.MType,
 		m.Delta,
@@ -96,73 +165,29 @@ func (c *PgClient) Insert(ctx context.Context, m *store.Metric) error {
 	return nil
 }
 
+// SaveAll inserts or updates all metrics in a single transaction.
+// Existing rows are matched by the composite key (id, type), so IsExists is only a hint.
+// Batches of at least copyThreshold metrics are streamed with COPY into a staging table
+// and merged with a single statement, smaller ones are pipelined with pgx.Batch.
 func (c *PgClient) SaveAll(ctx context.Context, metrics map[string]store.MetricR) error {
-	rCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
+	rCtx, cancel := context.WithTimeout(ctx, saveAllTimeout)
 	defer cancel()
 
-	tx, err := c.db.Begin()
-	if err != nil {
-		return fmt.Errorf("failed begin tx: %w", err)
-	}
-
-	insStmt, err := tx.PrepareContext(
-		rCtx,
-		"INSERT INTO metric (id, type, delta, value) VALUES ($1, $2, $3, $4)",
-	)
-	if err != nil {
-		return fmt.Errorf("failed prepare context: %w", err)
-	}
-	defer insStmt.Close()
-
-	updStmt, err := tx.PrepareContext(
-		rCtx,
-		"UPDATE metric SET delta = $2, value = $3 WHERE id = $1 and type = $4",
-	)
-	if err != nil {
-		return fmt.Errorf("failed prepare context: %w", err)
-	}
-	defer updStmt.Close()
-
+	list := make([]*store.Metric, 0, len(metrics))
 	for _, m := range metrics {
-		if m.Metric.MType != store.MTypeGauge && m.Metric.MType != store.MTypeCounter {
-			return fmt.Errorf("metric type %s is not valid for ID %s", m.Metric.MType, m.Metric.ID)
-		}
-
-		if m.Metric.Delta == nil && m.Metric.Value == nil {
-			return errors.New("metric can't have nil delta and nil value")
-		}
-
-		if m.IsExists {
-			_, err = updStmt.ExecContext(
-				rCtx,
-				m.Metric.ID,
-				m.Metric.Delta,
-				m.Metric.Value,
-				m.Metric.MType,
-			)
-			if err != nil {
-				return fmt.Errorf("failed update: %w", err)
-			}
-		} else {
-			_, err = insStmt.ExecContext(
-				rCtx,
-				m.Metric.ID,
-				m.Metric.MType,
-				m.Metric.Delta,
-				m.Metric.Value,
-			)
-			if err != nil {
-				return fmt.Errorf("failed insert: %w", err)
-			}
+		if err := validateMetric(m.Metric); err != nil {
+			return err
 		}
+		list = append(list, m.Metric)
 	}
-
-	err = tx.Commit()
-	if err != nil {
-		return fmt.Errorf("failed commit: %w", err)
+	if len(list) == 0 {
+		return nil
 	}
 
-	return nil
+	if len(list) >= copyThreshold {
+		return c.saveAllCopy(rCtx, list)
+	}
+	return c.saveAllBatch(rCtx, list)
 }
 
 func (c *PgClient) Update(
@@ -172,16 +197,12 @@ func (c *PgClient) Update(
 	rCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
 
-	if m.MType != store.MTypeGauge && m.MType != store.MTypeCounter {
-		return fmt.Errorf("metric type %s is not valid for ID %s", m.MType, m.ID)
-	}
-
-	if m.Delta == nil && m.Value == nil {
-		return errors.New("metric can't have nil delta and nil value")
+	if err := validateMetric(m); err != nil {
+		return err
 	}
-	_, err := c.db.ExecContext(
+	r, err := c.db.ExecContext(
 		rCtx,
-		"UPDATE metric SET delta = $2, value = $3 WHERE id = $1 and type = $4",
+		"UPDATE metric SET delta = $2, value = $3, updated_at = now() WHERE id = $1 and type = $4::text::metric_type",
 		m.ID,
 		m.Delta,
 		m.Value,
@@ -190,6 +211,14 @@ func (c *PgClient) Update(
 	if err != nil {
 		return fmt.Errorf("failed update %w", err)
 	}
+	affected, err := r.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("failed update %w", err)
+	}
+	if affected == 0 {
+		return fmt.Errorf("%w: can't update value by id, because value doesn't exists: id %s",
+			store.ErrValueNotFound, m.ID)
+	}
 
 	return nil
 }
@@ -198,7 +227,10 @@ func (c *PgClient) Delete(ctx context.Context, id string, mType string) error {
 	rCtx, cancel := context.WithTimeout(ctx, 1*time.Second)
 	defer cancel()
 
-	_, err := c.db.ExecContext(rCtx, "DELETE FROM metric WHERE id = $1 and type = $2", id, mType)
+	if !isMetricType(mType) {
+		return nil
+	}
+	_, err := c.db.ExecContext(rCtx, "DELETE FROM metric WHERE id = $1 and type = $2::text::metric_type", id, mType)
 	if err != nil {
 		return fmt.Errorf("failed delete: %w", err)
 	}
@@ -217,3 +249,20 @@ func (c *PgClient) ApplyMigration(ctx context.Context, sql string) error {
 
 	return nil
 }
+
+// isMetricType reports whether mType is one of the values of the metric_type enum.
+func isMetricType(mType string) bool {
+	return mType == store.MTypeGauge || mType == store.MTypeCounter
+}
+
+func validateMetric(m *store.Metric) error {
+	if !isMetricType(m.MType) {
+		return fmt.Errorf("metric type %s is not valid for ID %s", m.MType, m.ID)
+	}
+
+	if m.Delta == nil && m.Value == nil {
+		return errors.New("metric can't have nil delta and nil value")
+	}
+
+	return nil
+}
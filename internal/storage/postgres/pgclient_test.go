@@ -59,7 +59,7 @@ func TestPgStorageEndToEnd(t *testing.T) {
 	require.NoError(t, err)
 
 	dsn := getDSN(hostPort, dbName, testDBUserName, testDBUserPassword)
-	pgClient, err := postgres.NewPgClient(dsn)
+	pgClient, err := postgres.NewPgClient(dsn, nil)
 	require.NoError(t, err)
 
 	err = pgClient.Ping()
@@ -156,7 +156,7 @@ func TestPgClientEndToEnd(t *testing.T) {
 	require.NoError(t, err)
 
 	dsn := getDSN(hostPort, dbName, testDBUserName, testDBUserPassword)
-	pgClient, err := postgres.NewPgClient(dsn)
+	pgClient, err := postgres.NewPgClient(dsn, nil)
 	require.NoError(t, err)
 
 	err = pgClient.Ping()
@@ -193,7 +193,191 @@ func TestPgClientEndToEnd(t *testing.T) {
 	require.NoError(t, err)
 }
 
-func migrate(t *testing.T, pgClient *postgres.PgClient) {
+func TestPgClientCompositeKey(t *testing.T) {
+	ctx := context.Background()
+	dbName := strings.ToLower(t.Name())
+	err := CreateTestDB(ctx, dbName, testDBUserName)
+	require.NoError(t, err)
+
+	dsn := getDSN(hostPort, dbName, testDBUserName, testDBUserPassword)
+	pgClient, err := postgres.NewPgClient(dsn, nil)
+	require.NoError(t, err)
+
+	migrate(t, pgClient)
+	// migrations are applied on every server start, so they must be idempotent
+	migrate(t, pgClient)
+
+	id := strings.Repeat("LongMetricName", 10)
+	value := 1.5
+	gauge := &store.Metric{ID: id, MType: store.MTypeGauge, Value: &value}
+	counter := &store.Metric{ID: id, MType: store.MTypeCounter, Delta: &delta1}
+
+	err = pgClient.Insert(ctx, gauge)
+	require.NoError(t, err)
+	err = pgClient.Insert(ctx, counter)
+	require.NoError(t, err)
+
+	foundMetric, err := pgClient.SelectByIDAndType(ctx, id, store.MTypeGauge)
+	require.NoError(t, err)
+	require.Equal(t, gauge.Value, foundMetric.Value)
+
+	foundMetric, err = pgClient.SelectByIDAndType(ctx, id, store.MTypeCounter)
+	require.NoError(t, err)
+	require.Equal(t, counter.Delta, foundMetric.Delta)
+
+	err = pgClient.SaveAll(ctx, map[string]store.MetricR{
+		id + store.MTypeCounter: {Metric: updatedMetric1, IsExists: false},
+	})
+	require.NoError(t, err)
+	err = pgClient.SaveAll(ctx, map[string]store.MetricR{
+		id + store.MTypeCounter: {Metric: updatedMetric1, IsExists: false},
+	})
+	require.NoError(t, err)
+
+	err = pgClient.Close()
+	require.NoError(t, err)
+	err = DropTestDB(ctx, dbName)
+	require.NoError(t, err)
+}
+
+func TestPgClientUnknownType(t *testing.T) {
+	ctx := context.Background()
+	dbName := strings.ToLower(t.Name())
+	err := CreateTestDB(ctx, dbName, testDBUserName)
+	require.NoError(t, err)
+
+	dsn := getDSN(hostPort, dbName, testDBUserName, testDBUserPassword)
+	pgClient, err := postgres.NewPgClient(dsn, nil)
+	require.NoError(t, err)
+
+	migrate(t, pgClient)
+
+	err = pgClient.Insert(ctx, insertedMetric1)
+	require.NoError(t, err)
+
+	// тип вне enum metric_type не должен превращаться в ошибку базы
+	foundMetric, err := pgClient.SelectByIDAndType(ctx, id1, "unknown")
+	require.ErrorIs(t, err, store.ErrValueNotFound)
+	require.Nil(t, foundMetric)
+
+	foundMetric, err = postgres.NewPgStorage(pgClient).Read(ctx, id1, "unknown")
+	require.ErrorIs(t, err, store.ErrValueNotFound)
+	require.Nil(t, foundMetric)
+
+	err = pgClient.Delete(ctx, id1, "unknown")
+	require.NoError(t, err)
+	err = pgClient.Insert(ctx, &store.Metric{ID: id1, MType: "unknown", Delta: &delta1})
+	require.Error(t, err)
+
+	foundMetric, err = pgClient.SelectByIDAndType(ctx, id1, mType)
+	require.NoError(t, err)
+	require.Equal(t, insertedMetric1.Delta, foundMetric.Delta)
+
+	err = pgClient.Close()
+	require.NoError(t, err)
+	err = DropTestDB(ctx, dbName)
+	require.NoError(t, err)
+}
+
+func TestPgClientSaveAllBulk(t *testing.T) {
+	ctx := context.Background()
+	dbName := strings.ToLower(t.Name())
+	err := CreateTestDB(ctx, dbName, testDBUserName)
+	require.NoError(t, err)
+
+	dsn := getDSN(hostPort, dbName, testDBUserName, testDBUserPassword)
+	pgClient, err := postgres.NewPgClient(dsn, nil)
+	require.NoError(t, err)
+
+	migrate(t, pgClient)
+
+	for _, size := range []int{10, 10000} {
+		metrics := buildMetrics(size)
+		err = pgClient.SaveAll(ctx, metrics)
+		require.NoError(t, err)
+		// the second call must update the existing rows instead of failing on the primary key
+		err = pgClient.SaveAll(ctx, metrics)
+		require.NoError(t, err)
+
+		for _, m := range metrics {
+			foundMetric, err := pgClient.SelectByIDAndType(ctx, m.Metric.ID, m.Metric.MType)
+			require.NoError(t, err)
+			require.Equal(t, m.Metric.Delta, foundMetric.Delta)
+			require.Equal(t, m.Metric.Value, foundMetric.Value)
+		}
+	}
+
+	err = pgClient.Close()
+	require.NoError(t, err)
+	err = DropTestDB(ctx, dbName)
+	require.NoError(t, err)
+}
+
+// BenchmarkPgClientSaveAll measures throughput of a 10k-metric batch for every SaveAll path:
+//
+//	go test -tags integration_test -bench=BenchmarkPgClientSaveAll ./internal/storage/postgres/
+func BenchmarkPgClientSaveAll(b *testing.B) {
+	const batchSize = 10000
+
+	ctx := context.Background()
+	dbName := strings.ToLower(b.Name())
+	err := CreateTestDB(ctx, dbName, testDBUserName)
+	require.NoError(b, err)
+
+	dsn := getDSN(hostPort, dbName, testDBUserName, testDBUserPassword)
+	pgClient, err := postgres.NewPgClient(dsn, nil)
+	require.NoError(b, err)
+
+	migrate(b, pgClient)
+
+	metricsR := buildMetrics(batchSize)
+	metrics := make([]*store.Metric, 0, len(metricsR))
+	for _, m := range metricsR {
+		metrics = append(metrics, m.Metric)
+	}
+
+	benchmarks := []struct {
+		name string
+		save func() error
+	}{
+		{name: "copy", save: func() error { return pgClient.SaveAllCopy(ctx, metrics) }},
+		{name: "batch", save: func() error { return pgClient.SaveAllBatch(ctx, metrics) }},
+		{name: "save_all", save: func() error { return pgClient.SaveAll(ctx, metricsR) }},
+	}
+	for _, bm := range benchmarks {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				require.NoError(b, bm.save())
+			}
+			b.ReportMetric(float64(batchSize*b.N)/b.Elapsed().Seconds(), "metrics/s")
+		})
+	}
+
+	err = pgClient.Close()
+	require.NoError(b, err)
+	err = DropTestDB(ctx, dbName)
+	require.NoError(b, err)
+}
+
+func buildMetrics(size int) map[string]store.MetricR {
+	metrics := make(map[string]store.MetricR, size)
+	for i := 0; i < size; i++ {
+		m := &store.Metric{ID: fmt.Sprintf("metric%d", i)}
+		if i%2 == 0 {
+			delta := int64(i)
+			m.MType = store.MTypeCounter
+			m.Delta = &delta
+		} else {
+			value := float64(i)
+			m.MType = store.MTypeGauge
+			m.Value = &value
+		}
+		metrics[m.ID+m.MType] = store.MetricR{Metric: m}
+	}
+	return metrics
+}
+
+func migrate(t testing.TB, pgClient *postgres.PgClient) {
 	err := filepath.Walk("../../../migrations", func(path string, info fs.FileInfo, err error) error {
 		if !info.IsDir() {
 			bytes, err := os.ReadFile(path)
@@ -0,0 +1,36 @@
+package postgres
+
+import (
+	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/selfmetrics"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"go.uber.org/zap"
+)
+
+// PoolMetrics returns connection pool statistics as gauge metrics,
+// it is meant to be registered as a self-metrics source of the server.
+// A warning is logged when requests had to wait for a free connection since the previous call.
+func (c *PgClient) PoolMetrics() []*store.Metric {
+	stats := c.db.Stats()
+
+	lastWaitCount := c.lastWaitCount.Swap(stats.WaitCount)
+	if stats.WaitCount > lastWaitCount {
+		logger.Logger().Warn("database connection pool is saturated",
+			zap.Int("maxOpenConnections", stats.MaxOpenConnections),
+			zap.Int("inUse", stats.InUse),
+			zap.Int64("waited", stats.WaitCount-lastWaitCount),
+		)
+	}
+
+	return []*store.Metric{
+		selfmetrics.Gauge("DBPoolMaxOpenConnections", float64(stats.MaxOpenConnections)),
+		selfmetrics.Gauge("DBPoolOpenConnections", float64(stats.OpenConnections)),
+		selfmetrics.Gauge("DBPoolInUse", float64(stats.InUse)),
+		selfmetrics.Gauge("DBPoolIdle", float64(stats.Idle)),
+		selfmetrics.Gauge("DBPoolWaitCount", float64(stats.WaitCount)),
+		selfmetrics.Gauge("DBPoolWaitDuration", stats.WaitDuration.Seconds()),
+		selfmetrics.Gauge("DBPoolMaxIdleClosed", float64(stats.MaxIdleClosed)),
+		selfmetrics.Gauge("DBPoolMaxIdleTimeClosed", float64(stats.MaxIdleTimeClosed)),
+		selfmetrics.Gauge("DBPoolMaxLifetimeClosed", float64(stats.MaxLifetimeClosed)),
+	}
+}
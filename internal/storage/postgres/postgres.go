@@ -19,11 +19,23 @@ const (
 
 type PgStorage struct {
 	client store.Client
+	// replica клиент к реплике только для чтения, nil если реплика не настроена
+	replica store.Client
 }
 
 func NewPgStorage(dbClient store.Client) *PgStorage {
 	return &PgStorage{
-		dbClient,
+		client: dbClient,
+	}
+}
+
+// NewPgStorageWithReplica creates a PgStorage that writes to the primary
+// and serves reads from the read-only replica, falling back to the primary on replica errors.
+// Reads marked with store.WithConsistentRead always go to the primary.
+func NewPgStorageWithReplica(dbClient store.Client, replicaClient store.Client) *PgStorage {
+	return &PgStorage{
+		client:  dbClient,
+		replica: replicaClient,
 	}
 }
 
@@ -76,11 +88,32 @@ func (s *PgStorage) CreateAll(ctx context.Context, metrics map[string]store.Metr
 }
 
 func (s *PgStorage) Read(ctx context.Context, id string, mType string) (*store.Metric, error) {
+	if s.replica == nil || store.IsConsistentRead(ctx) {
+		return read(ctx, s.client, id, mType)
+	}
+
+	m, err := read(ctx, s.replica, id, mType)
+	if err == nil {
+		return m, nil
+	}
+	// метрика могла ещё не доехать до реплики, поэтому отсутствие значения тоже проверяем на primary
+	if errors.Is(err, store.ErrValueNotFound) {
+		return read(ctx, s.client, id, mType)
+	}
+	logger.Logger().Warn("failed to read from replica, fallback to primary",
+		zap.String("id", id),
+		zap.String("mType", mType),
+		zap.Error(err),
+	)
+	return read(ctx, s.client, id, mType)
+}
+
+func read(ctx context.Context, client store.Client, id string, mType string) (*store.Metric, error) {
 	var m *store.Metric
 	var err error
 	_ = retry.Do(
 		func() error {
-			m, err = s.client.SelectByIDAndType(ctx, id, mType)
+			m, err = client.SelectByIDAndType(ctx, id, mType)
 			if isRetriableError(err) {
 				logger.Logger().Error("Retriable error detected. Retrying...", zap.Error(err))
 				return err
@@ -100,6 +133,45 @@ func (s *PgStorage) Read(ctx context.Context, id string, mType string) (*store.M
 	return m, err
 }
 
+// List returns all metrics, it is served by the replica unless ctx is marked with store.WithConsistentRead.
+func (s *PgStorage) List(ctx context.Context) ([]*store.Metric, error) {
+	if s.replica == nil || store.IsConsistentRead(ctx) {
+		return list(ctx, s.client)
+	}
+
+	metrics, err := list(ctx, s.replica)
+	if err == nil {
+		return metrics, nil
+	}
+	logger.Logger().Warn("failed to list from replica, fallback to primary", zap.Error(err))
+	return list(ctx, s.client)
+}
+
+func list(ctx context.Context, client store.Client) ([]*store.Metric, error) {
+	var metrics []*store.Metric
+	var err error
+	_ = retry.Do(
+		func() error {
+			metrics, err = client.SelectAll(ctx)
+			if isRetriableError(err) {
+				logger.Logger().Error("Retriable error detected. Retrying...", zap.Error(err))
+				return err
+			}
+			return nil
+		},
+		retry.Attempts(retryAttempts),
+		retry.DelayType(utils.RetryDelayType),
+		retry.OnRetry(func(n uint, err error) {
+			logger.Logger().Error("error send request to postgres",
+				zap.Uint("currentAttempt", n),
+				zap.Int("retryAttempts", retryAttempts),
+				zap.Error(err),
+			)
+		}),
+	)
+	return metrics, err
+}
+
 func (s *PgStorage) Update(ctx context.Context, m *store.Metric) error {
 	var err error
 	_ = retry.Do(
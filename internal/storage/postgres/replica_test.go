@@ -0,0 +1,118 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/golang/mock/gomock"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPgStorage_ReadReplica(t *testing.T) {
+	delta := int64(1)
+	metric := &store.Metric{ID: "PollCount", MType: store.MTypeCounter, Delta: &delta}
+
+	tests := []struct {
+		name    string
+		ctx     context.Context
+		prepare func(primary *MockClient, replica *MockClient)
+		want    *store.Metric
+		wantErr error
+	}{
+		{
+			name: "read from replica",
+			ctx:  context.Background(),
+			prepare: func(primary *MockClient, replica *MockClient) {
+				replica.EXPECT().SelectByIDAndType(gomock.Any(), metric.ID, metric.MType).Return(metric, nil)
+			},
+			want: metric,
+		},
+		{
+			name: "fallback to primary on replica error",
+			ctx:  context.Background(),
+			prepare: func(primary *MockClient, replica *MockClient) {
+				replica.EXPECT().SelectByIDAndType(gomock.Any(), metric.ID, metric.MType).
+					Return(nil, errors.New("replica is down"))
+				primary.EXPECT().SelectByIDAndType(gomock.Any(), metric.ID, metric.MType).Return(metric, nil)
+			},
+			want: metric,
+		},
+		{
+			name: "fallback to primary when replica lags",
+			ctx:  context.Background(),
+			prepare: func(primary *MockClient, replica *MockClient) {
+				replica.EXPECT().SelectByIDAndType(gomock.Any(), metric.ID, metric.MType).
+					Return(nil, store.ErrValueNotFound)
+				primary.EXPECT().SelectByIDAndType(gomock.Any(), metric.ID, metric.MType).
+					Return(nil, store.ErrValueNotFound)
+			},
+			wantErr: store.ErrValueNotFound,
+		},
+		{
+			name: "consistent read goes to primary",
+			ctx:  store.WithConsistentRead(context.Background()),
+			prepare: func(primary *MockClient, replica *MockClient) {
+				primary.EXPECT().SelectByIDAndType(gomock.Any(), metric.ID, metric.MType).Return(metric, nil)
+			},
+			want: metric,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctrl := gomock.NewController(t)
+			primary := NewMockClient(ctrl)
+			replica := NewMockClient(ctrl)
+			tt.prepare(primary, replica)
+
+			s := NewPgStorageWithReplica(primary, replica)
+			got, err := s.Read(tt.ctx, metric.ID, metric.MType)
+			require.ErrorIs(t, err, tt.wantErr)
+			require.Equal(t, tt.want, got)
+		})
+	}
+}
+
+func TestPgStorage_WritesGoToPrimary(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	primary := NewMockClient(ctrl)
+	replica := NewMockClient(ctrl)
+
+	value := 1.5
+	metric := &store.Metric{ID: "Alloc", MType: store.MTypeGauge, Value: &value}
+	metrics := map[string]store.MetricR{metric.ID + metric.MType: {Metric: metric}}
+	primary.EXPECT().Insert(gomock.Any(), metric).Return(nil)
+	primary.EXPECT().Update(gomock.Any(), metric).Return(nil)
+	primary.EXPECT().SaveAll(gomock.Any(), metrics).Return(nil)
+	primary.EXPECT().Delete(gomock.Any(), metric.ID, metric.MType).Return(nil)
+
+	s := NewPgStorageWithReplica(primary, replica)
+	require.NoError(t, s.Create(context.TODO(), metric))
+	require.NoError(t, s.Update(context.TODO(), metric))
+	require.NoError(t, s.CreateAll(context.TODO(), metrics))
+	require.NoError(t, s.Delete(context.TODO(), metric.ID, metric.MType))
+}
+
+func TestSaveAllMetric_ReadsFromPrimary(t *testing.T) {
+	ctrl := gomock.NewController(t)
+	primary := NewMockClient(ctrl)
+	replica := NewMockClient(ctrl)
+
+	stored := int64(2)
+	delta := int64(1)
+	primary.EXPECT().SelectByIDAndType(gomock.Any(), "PollCount", store.MTypeCounter).
+		Return(&store.Metric{ID: "PollCount", MType: store.MTypeCounter, Delta: &stored}, nil)
+	primary.EXPECT().SaveAll(gomock.Any(), gomock.Any()).DoAndReturn(
+		func(_ context.Context, metrics map[string]store.MetricR) error {
+			require.Equal(t, int64(3), *metrics["PollCount"+store.MTypeCounter].Metric.Delta)
+			return nil
+		},
+	)
+
+	s := NewPgStorageWithReplica(primary, replica)
+	err := store.SaveAllMetric(context.TODO(), s, []*store.Metric{
+		{ID: "PollCount", MType: store.MTypeCounter, Delta: &delta},
+	})
+	require.NoError(t, err)
+}
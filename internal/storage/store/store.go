@@ -5,11 +5,27 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"time"
 )
 
 // ErrValueNotFound indicates that the requested metric value was not found.
 var ErrValueNotFound = errors.New("not found value")
 
+type consistentReadKey struct{}
+
+// WithConsistentRead marks ctx so that storage reads observe the latest committed writes,
+// e.g. are served by the primary database instead of a lagging read replica.
+// Read-modify-write paths such as counter accumulation must use it.
+func WithConsistentRead(ctx context.Context) context.Context {
+	return context.WithValue(ctx, consistentReadKey{}, true)
+}
+
+// IsConsistentRead reports whether ctx was marked with WithConsistentRead.
+func IsConsistentRead(ctx context.Context) bool {
+	v, _ := ctx.Value(consistentReadKey{}).(bool)
+	return v
+}
+
 // Storage defines the interface for metric storage operations.
 //
 //go:generate mockgen -destination=../mocks/mock_store.go -source=store.go -package=mocks Storage
@@ -19,6 +35,8 @@ type Storage interface {
 	Read(ctx context.Context, id string, mType string) (*Metric, error)
 	Update(ctx context.Context, m *Metric) error
 	Delete(ctx context.Context, id string, mType string) error
+	// List returns all stored metrics with their last update time.
+	List(ctx context.Context) ([]*Metric, error)
 	Backup() error
 	BackupPeriodically() error
 }
@@ -28,6 +46,7 @@ type Client interface {
 	Close() error
 	Ping() error
 	SelectByIDAndType(ctx context.Context, id string, mType string) (*Metric, error)
+	SelectAll(ctx context.Context) ([]*Metric, error)
 	Insert(ctx context.Context, m *Metric) error
 	SaveAll(ctx context.Context, metrics map[string]MetricR) error
 	Update(context.Context, *Metric) error
@@ -47,6 +66,22 @@ type Metric struct {
 	MType string   `json:"type"`            // Metric type: gauge or counter
 	Delta *int64   `json:"delta,omitempty"` // Delta value (applicable for counter type)
 	Value *float64 `json:"value,omitempty"` // Value (applicable for gauge type)
+	// UpdatedAt time of the last write, set by the storage and not exposed in the API
+	UpdatedAt time.Time `json:"-"`
+}
+
+// CopyMetric returns a deep copy of m, so that the copy doesn't share Delta and Value with m.
+func CopyMetric(m *Metric) *Metric {
+	c := &Metric{ID: m.ID, MType: m.MType, UpdatedAt: m.UpdatedAt}
+	if m.Delta != nil {
+		delta := *m.Delta
+		c.Delta = &delta
+	}
+	if m.Value != nil {
+		value := *m.Value
+		c.Value = &value
+	}
+	return c
 }
 
 // MType constants represent different metric types.
@@ -79,8 +114,9 @@ func SaveAllMetric(ctx context.Context, s Storage, metrics []*Metric) error {
 	}
 
 	metricsR := map[string]MetricR{}
+	readCtx := WithConsistentRead(ctx)
 	for _, metric := range metrics {
-		found, err := s.Read(ctx, metric.ID, metric.MType)
+		found, err := s.Read(readCtx, metric.ID, metric.MType)
 		if err != nil && !errors.Is(err, ErrValueNotFound) {
 			return fmt.Errorf("failed update metric: %w", err)
 		}
@@ -0,0 +1,268 @@
+// Package storetest provides a conformance test suite that every store.Storage implementation must pass.
+//
+// Usage from the test file of a backend:
+//
+//	func TestStorageConformance(t *testing.T) {
+//		storetest.Run(t, func(t *testing.T) storetest.Backend {
+//			return storetest.Backend{Storage: NewStorage(nil)}
+//		})
+//	}
+package storetest
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/stretchr/testify/require"
+)
+
+// Backend is a storage under test.
+type Backend struct {
+	// Storage is an empty storage.
+	Storage store.Storage
+	// Reopen returns a new storage instance over the state persisted by Storage,
+	// it is called after Storage.Backup(). Nil for backends without persistence.
+	Reopen func(t *testing.T) store.Storage
+}
+
+// Run runs the conformance suite, newBackend is called for every test case and must return an empty storage.
+func Run(t *testing.T, newBackend func(t *testing.T) Backend) {
+	t.Run("CRUD", func(t *testing.T) { testCRUD(t, newBackend(t).Storage) })
+	t.Run("InvalidType", func(t *testing.T) { testInvalidType(t, newBackend(t).Storage) })
+	t.Run("NotFound", func(t *testing.T) { testNotFound(t, newBackend(t).Storage) })
+	t.Run("SameIDDifferentType", func(t *testing.T) { testSameIDDifferentType(t, newBackend(t).Storage) })
+	t.Run("SaveAllMetric", func(t *testing.T) { testSaveAllMetric(t, newBackend(t).Storage) })
+	t.Run("List", func(t *testing.T) { testList(t, newBackend(t).Storage) })
+	t.Run("Concurrency", func(t *testing.T) { testConcurrency(t, newBackend(t).Storage) })
+	t.Run("BackupRestore", func(t *testing.T) {
+		backend := newBackend(t)
+		if backend.Reopen == nil {
+			t.Skip("storage has no persistence")
+		}
+		testBackupRestore(t, backend)
+	})
+}
+
+func testCRUD(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+
+	err := s.Create(ctx, counter("PollCount", 1))
+	require.NoError(t, err)
+	requireDelta(t, s, "PollCount", 1)
+
+	err = s.Update(ctx, counter("PollCount", 5))
+	require.NoError(t, err)
+	requireDelta(t, s, "PollCount", 5)
+
+	err = s.CreateAll(ctx, map[string]store.MetricR{
+		"PollCount" + store.MTypeCounter: {Metric: counter("PollCount", 7), IsExists: true},
+		"Alloc" + store.MTypeGauge:       {Metric: gauge("Alloc", 1.5), IsExists: false},
+	})
+	require.NoError(t, err)
+	requireDelta(t, s, "PollCount", 7)
+	requireValue(t, s, "Alloc", 1.5)
+
+	err = s.Delete(ctx, "PollCount", store.MTypeCounter)
+	require.NoError(t, err)
+	found, err := s.Read(ctx, "PollCount", store.MTypeCounter)
+	require.ErrorIs(t, err, store.ErrValueNotFound)
+	require.Nil(t, found)
+	requireValue(t, s, "Alloc", 1.5)
+}
+
+func testInvalidType(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	value := 1.0
+	m := &store.Metric{ID: "Alloc", MType: "unknown", Value: &value}
+
+	require.Error(t, s.Create(ctx, m))
+	require.Error(t, s.Update(ctx, m))
+	require.Error(t, s.CreateAll(ctx, map[string]store.MetricR{m.ID + m.MType: {Metric: m}}))
+}
+
+func testNotFound(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+
+	found, err := s.Read(ctx, "missing", store.MTypeGauge)
+	require.ErrorIs(t, err, store.ErrValueNotFound)
+	require.Nil(t, found)
+
+	err = s.Update(ctx, gauge("missing", 1))
+	require.ErrorIs(t, err, store.ErrValueNotFound)
+	_, err = s.Read(ctx, "missing", store.MTypeGauge)
+	require.ErrorIs(t, err, store.ErrValueNotFound)
+
+	err = s.Delete(ctx, "missing", store.MTypeGauge)
+	require.NoError(t, err)
+}
+
+func testSameIDDifferentType(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+
+	require.NoError(t, s.Create(ctx, counter("Metric", 3)))
+	require.NoError(t, s.Create(ctx, gauge("Metric", 2.5)))
+	requireDelta(t, s, "Metric", 3)
+	requireValue(t, s, "Metric", 2.5)
+
+	require.NoError(t, s.Delete(ctx, "Metric", store.MTypeGauge))
+	requireDelta(t, s, "Metric", 3)
+}
+
+func testSaveAllMetric(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+
+	err := store.SaveAllMetric(ctx, s, []*store.Metric{
+		counter("PollCount", 1),
+		counter("PollCount", 2),
+		gauge("Alloc", 1),
+		gauge("Alloc", 2),
+	})
+	require.NoError(t, err)
+	requireDelta(t, s, "PollCount", 3)
+	requireValue(t, s, "Alloc", 2)
+
+	err = store.SaveAllMetric(ctx, s, []*store.Metric{
+		counter("PollCount", 4),
+		gauge("Alloc", 3),
+	})
+	require.NoError(t, err)
+	requireDelta(t, s, "PollCount", 7)
+	requireValue(t, s, "Alloc", 3)
+
+	require.NoError(t, store.SaveAllMetric(ctx, s, nil))
+	requireDelta(t, s, "PollCount", 7)
+}
+
+func testList(t *testing.T, s store.Storage) {
+	ctx := context.Background()
+	// время обновления выставляет хранилище, допускаем расхождение часов с сервером БД
+	const clockSkew = time.Minute
+	before := time.Now().Add(-clockSkew)
+
+	err := store.SaveAllMetric(ctx, s, []*store.Metric{
+		counter("PollCount", 1),
+		gauge("Alloc", 1.5),
+		gauge("Stale", 2.5),
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.Delete(ctx, "Stale", store.MTypeGauge))
+
+	metrics, err := s.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, metrics, 2)
+
+	after := time.Now().Add(clockSkew)
+	found := map[string]*store.Metric{}
+	for _, m := range metrics {
+		require.False(t, m.UpdatedAt.IsZero(), "metric %s has no update time", m.ID)
+		require.True(t, m.UpdatedAt.After(before) && m.UpdatedAt.Before(after),
+			"metric %s has unexpected update time %s", m.ID, m.UpdatedAt)
+		found[m.ID+m.MType] = m
+	}
+	require.Contains(t, found, "PollCount"+store.MTypeCounter)
+	require.Equal(t, int64(1), *found["PollCount"+store.MTypeCounter].Delta)
+	require.Contains(t, found, "Alloc"+store.MTypeGauge)
+	require.Equal(t, 1.5, *found["Alloc"+store.MTypeGauge].Value)
+}
+
+func testConcurrency(t *testing.T, s store.Storage) {
+	const (
+		workers    = 8
+		iterations = 50
+	)
+	ctx := context.Background()
+	require.NoError(t, s.Create(ctx, gauge("Shared", 0)))
+
+	wg := sync.WaitGroup{}
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			id := fmt.Sprintf("Worker%d", w)
+			for i := 1; i <= iterations; i++ {
+				var err error
+				if i == 1 {
+					err = s.Create(ctx, counter(id, int64(i)))
+				} else {
+					err = s.Update(ctx, counter(id, int64(i)))
+				}
+				if err == nil {
+					err = s.CreateAll(ctx, map[string]store.MetricR{
+						"Shared" + store.MTypeGauge: {Metric: gauge("Shared", float64(i)), IsExists: true},
+					})
+				}
+				if err == nil {
+					_, err = s.Read(ctx, "Shared", store.MTypeGauge)
+				}
+				if err != nil {
+					errs <- fmt.Errorf("worker %d: %w", w, err)
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		require.NoError(t, err)
+	}
+
+	for w := 0; w < workers; w++ {
+		requireDelta(t, s, fmt.Sprintf("Worker%d", w), iterations)
+	}
+	requireValue(t, s, "Shared", iterations)
+}
+
+func testBackupRestore(t *testing.T, backend Backend) {
+	ctx := context.Background()
+	s := backend.Storage
+
+	err := store.SaveAllMetric(ctx, s, []*store.Metric{
+		counter("PollCount", 5),
+		gauge("Alloc", 1.5),
+	})
+	require.NoError(t, err)
+	require.NoError(t, s.Backup())
+
+	saved, err := s.Read(ctx, "Alloc", store.MTypeGauge)
+	require.NoError(t, err)
+
+	restored := backend.Reopen(t)
+	requireDelta(t, restored, "PollCount", 5)
+	requireValue(t, restored, "Alloc", 1.5)
+
+	found, err := restored.Read(ctx, "Alloc", store.MTypeGauge)
+	require.NoError(t, err)
+	require.True(t, saved.UpdatedAt.Equal(found.UpdatedAt), "update time is not restored")
+}
+
+func requireDelta(t *testing.T, s store.Storage, id string, delta int64) {
+	t.Helper()
+	found, err := s.Read(context.Background(), id, store.MTypeCounter)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	require.NotNil(t, found.Delta)
+	require.Equal(t, delta, *found.Delta)
+}
+
+func requireValue(t *testing.T, s store.Storage, id string, value float64) {
+	t.Helper()
+	found, err := s.Read(context.Background(), id, store.MTypeGauge)
+	require.NoError(t, err)
+	require.NotNil(t, found)
+	require.NotNil(t, found.Value)
+	require.Equal(t, value, *found.Value)
+}
+
+func counter(id string, delta int64) *store.Metric {
+	return &store.Metric{ID: id, MType: store.MTypeCounter, Delta: &delta}
+}
+
+func gauge(id string, value float64) *store.Metric {
+	return &store.Metric{ID: id, MType: store.MTypeGauge, Value: &value}
+}
@@ -0,0 +1,131 @@
+// Package subnet restricts access to the clients of trusted subnets.
+//
+// The address of the client is the address of the connection peer. Only if the peer is one of
+// the trusted proxies, the address reported by the proxy in X-Real-IP (x-real-ip for gRPC) is used instead,
+// so that clients can't pretend to be inside a trusted subnet by setting the header themselves.
+// Both IPv4 and IPv6 networks are supported, IPv4-mapped IPv6 addresses are matched as IPv4.
+package subnet
+
+import (
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+)
+
+// Policy checks that clients belong to trusted subnets.
+type Policy struct {
+	subnets []netip.Prefix
+	proxies []netip.Prefix
+}
+
+// ParsePolicy parses comma separated lists of trusted subnets and trusted proxies, e.g.
+// "192.168.1.0/24,fd00::/8" and "10.0.0.5". An address without a prefix length is a network of one address.
+// Without subnets every client is allowed, the proxies are still used to resolve the address of the client.
+// Returns nil if both lists are empty.
+func ParsePolicy(subnets, proxies string) (*Policy, error) {
+	trusted, err := parsePrefixes(subnets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse trusted subnets: %w", err)
+	}
+	trustedProxies, err := parsePrefixes(proxies)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse trusted proxies: %w", err)
+	}
+	if len(trusted) == 0 && len(trustedProxies) == 0 {
+		return nil, nil
+	}
+	return &Policy{subnets: trusted, proxies: trustedProxies}, nil
+}
+
+func parsePrefixes(s string) ([]netip.Prefix, error) {
+	var prefixes []netip.Prefix
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		if !strings.Contains(item, "/") {
+			addr, err := netip.ParseAddr(item)
+			if err != nil {
+				return nil, fmt.Errorf("invalid address '%s': %w", item, err)
+			}
+			addr = normalize(addr)
+			prefixes = append(prefixes, netip.PrefixFrom(addr, addr.BitLen()))
+			continue
+		}
+		prefix, err := netip.ParsePrefix(item)
+		if err != nil {
+			return nil, fmt.Errorf("invalid subnet '%s': %w", item, err)
+		}
+		if prefix.Addr().Is4In6() && prefix.Bits() >= 96 {
+			prefix = netip.PrefixFrom(prefix.Addr().Unmap(), prefix.Bits()-96)
+		}
+		prefixes = append(prefixes, prefix.Masked())
+	}
+	return prefixes, nil
+}
+
+// Enabled reports whether access is restricted to trusted subnets.
+func (p *Policy) Enabled() bool {
+	return p != nil && len(p.subnets) > 0
+}
+
+// ClientIP returns the address of the client connected from peer, "host:port" or a bare address.
+// realIP, the address reported by the peer, is used only if the peer is a trusted proxy.
+// Returns false if the address can't be determined.
+func (p *Policy) ClientIP(peer, realIP string) (netip.Addr, bool) {
+	addr, ok := parseAddr(peer)
+	if !ok {
+		return netip.Addr{}, false
+	}
+	if p == nil || !contains(p.proxies, addr) {
+		return addr, true
+	}
+	// прокси обязан передать адрес клиента, иначе клиентом оказался бы сам прокси
+	return parseAddr(strings.TrimSpace(realIP))
+}
+
+// Contains reports whether addr belongs to a trusted subnet, every address does if access is not restricted.
+func (p *Policy) Contains(addr netip.Addr) bool {
+	if !p.Enabled() {
+		return true
+	}
+	return contains(p.subnets, normalize(addr))
+}
+
+// Allow reports whether the client connected from peer belongs to a trusted subnet, see ClientIP.
+func (p *Policy) Allow(peer, realIP string) (netip.Addr, bool) {
+	addr, ok := p.ClientIP(peer, realIP)
+	if !ok {
+		return netip.Addr{}, !p.Enabled()
+	}
+	return addr, p.Contains(addr)
+}
+
+func contains(prefixes []netip.Prefix, addr netip.Addr) bool {
+	for _, prefix := range prefixes {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+func parseAddr(s string) (netip.Addr, bool) {
+	if s == "" {
+		return netip.Addr{}, false
+	}
+	if host, _, err := net.SplitHostPort(s); err == nil {
+		s = host
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}, false
+	}
+	return normalize(addr), true
+}
+
+func normalize(addr netip.Addr) netip.Addr {
+	return addr.WithZone("").Unmap()
+}
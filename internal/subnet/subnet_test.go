@@ -0,0 +1,83 @@
+package subnet
+
+import (
+	"net/netip"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePolicy(t *testing.T) {
+	p, err := ParsePolicy("", "")
+	require.NoError(t, err)
+	require.Nil(t, p)
+	require.False(t, p.Enabled())
+
+	// прокси без подсетей не ограничивают доступ, но определяют адрес клиента
+	p, err = ParsePolicy("", "10.0.0.5")
+	require.NoError(t, err)
+	require.False(t, p.Enabled())
+	ip, allow := p.Allow("10.0.0.5:5000", "192.168.1.10")
+	require.True(t, allow)
+	require.Equal(t, netip.MustParseAddr("192.168.1.10"), ip)
+	ip, allow = p.Allow("10.0.0.1:5000", "192.168.1.10")
+	require.True(t, allow)
+	require.Equal(t, netip.MustParseAddr("10.0.0.1"), ip)
+	_, allow = p.Allow("bufconn", "")
+	require.True(t, allow)
+
+	for _, s := range []string{"invalid", "192.168.1.0/33", "192.168.1.0/24,fd00::/129"} {
+		_, err = ParsePolicy(s, "")
+		require.Error(t, err, s)
+	}
+	_, err = ParsePolicy("192.168.1.0/24", "proxy")
+	require.Error(t, err)
+}
+
+func TestPolicy_Allow(t *testing.T) {
+	p, err := ParsePolicy(" 192.168.1.0/24 , fd00::/8,10.0.0.7 ", "10.0.0.5,2001:db8::/32")
+	require.NoError(t, err)
+	require.True(t, p.Enabled())
+
+	tests := []struct {
+		name   string
+		peer   string
+		realIP string
+		ip     string
+		allow  bool
+	}{
+		{name: "ipv4", peer: "192.168.1.10:5000", ip: "192.168.1.10", allow: true},
+		{name: "ipv6", peer: "[fd00::1]:5000", ip: "fd00::1", allow: true},
+		{name: "ipv6 zone", peer: "[fd00::1%eth0]:5000", ip: "fd00::1", allow: true},
+		{name: "ipv4-mapped ipv6", peer: "[::ffff:192.168.1.10]:5000", ip: "192.168.1.10", allow: true},
+		{name: "single address", peer: "10.0.0.7:5000", ip: "10.0.0.7", allow: true},
+		{name: "bare address", peer: "192.168.1.10", ip: "192.168.1.10", allow: true},
+		{name: "outside", peer: "10.0.0.1:5000", ip: "10.0.0.1", allow: false},
+		{name: "header of client is ignored", peer: "10.0.0.1:5000", realIP: "192.168.1.10", ip: "10.0.0.1", allow: false},
+		{name: "header of proxy", peer: "10.0.0.5:5000", realIP: "192.168.1.10", ip: "192.168.1.10", allow: true},
+		{name: "ipv6 proxy", peer: "[2001:db8::1]:5000", realIP: "fd00::2", ip: "fd00::2", allow: true},
+		{name: "proxy forwards outside client", peer: "10.0.0.5:5000", realIP: "10.0.0.1", ip: "10.0.0.1", allow: false},
+		{name: "proxy without header", peer: "10.0.0.5:5000", allow: false},
+		{name: "proxy with invalid header", peer: "10.0.0.5:5000", realIP: "unknown", allow: false},
+		{name: "unknown peer", peer: "bufconn", realIP: "192.168.1.10", allow: false},
+		{name: "no peer", allow: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ip, allow := p.Allow(tt.peer, tt.realIP)
+			require.Equal(t, tt.allow, allow)
+			if tt.ip != "" {
+				require.Equal(t, netip.MustParseAddr(tt.ip), ip)
+			}
+		})
+	}
+}
+
+func TestPolicy_Nil(t *testing.T) {
+	var p *Policy
+	_, allow := p.Allow("", "")
+	require.True(t, allow)
+	ip, allow := p.Allow("10.0.0.1:5000", "192.168.1.10")
+	require.True(t, allow)
+	require.Equal(t, netip.MustParseAddr("10.0.0.1"), ip)
+}
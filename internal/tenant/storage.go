@@ -0,0 +1,98 @@
+package tenant
+
+import (
+	"context"
+
+	"github.com/andreevym/metric-collector/internal/storage/store"
+)
+
+// Storage is a store.Storage decorator scoping every operation to the tenant of the context.
+// Operations with a context without a tenant see the wrapped storage as is.
+type Storage struct {
+	next store.Storage
+}
+
+// NewStorage wraps next with tenant scoping.
+func NewStorage(next store.Storage) *Storage {
+	return &Storage{next: next}
+}
+
+func (s *Storage) Create(ctx context.Context, m *store.Metric) error {
+	return s.next.Create(ctx, qualify(ctx, m))
+}
+
+func (s *Storage) CreateAll(ctx context.Context, metrics map[string]store.MetricR) error {
+	if _, ok := FromContext(ctx); !ok {
+		return s.next.CreateAll(ctx, metrics)
+	}
+
+	qualified := make(map[string]store.MetricR, len(metrics))
+	for _, m := range metrics {
+		metric := qualify(ctx, m.Metric)
+		qualified[metric.ID+metric.MType] = store.MetricR{Metric: metric, IsExists: m.IsExists}
+	}
+	return s.next.CreateAll(ctx, qualified)
+}
+
+func (s *Storage) Read(ctx context.Context, id string, mType string) (*store.Metric, error) {
+	m, err := s.next.Read(ctx, QualifyID(ctx, id), mType)
+	if err != nil {
+		return nil, err
+	}
+	return unqualify(ctx, m), nil
+}
+
+func (s *Storage) Update(ctx context.Context, m *store.Metric) error {
+	return s.next.Update(ctx, qualify(ctx, m))
+}
+
+func (s *Storage) Delete(ctx context.Context, id string, mType string) error {
+	return s.next.Delete(ctx, QualifyID(ctx, id), mType)
+}
+
+// List returns only the metrics of the ctx tenant.
+func (s *Storage) List(ctx context.Context) ([]*store.Metric, error) {
+	metrics, err := s.next.List(ctx)
+	if err != nil {
+		return nil, err
+	}
+	if _, ok := FromContext(ctx); !ok {
+		return metrics, nil
+	}
+
+	owned := make([]*store.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		if _, ok := UnqualifyID(ctx, m.ID); ok {
+			owned = append(owned, unqualify(ctx, m))
+		}
+	}
+	return owned, nil
+}
+
+func (s *Storage) Backup() error {
+	return s.next.Backup()
+}
+
+func (s *Storage) BackupPeriodically() error {
+	return s.next.BackupPeriodically()
+}
+
+// qualify returns a copy of m with the storage ID, the metric of the caller is never modified.
+func qualify(ctx context.Context, m *store.Metric) *store.Metric {
+	if _, ok := FromContext(ctx); !ok {
+		return m
+	}
+	c := store.CopyMetric(m)
+	c.ID = QualifyID(ctx, m.ID)
+	return c
+}
+
+// unqualify returns a copy of m with the metric ID as the tenant knows it.
+func unqualify(ctx context.Context, m *store.Metric) *store.Metric {
+	if _, ok := FromContext(ctx); !ok {
+		return m
+	}
+	c := store.CopyMetric(m)
+	c.ID, _ = UnqualifyID(ctx, m.ID)
+	return c
+}
@@ -0,0 +1,61 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andreevym/metric-collector/internal/storage/mem"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/storage/storetest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStorageConformance(t *testing.T) {
+	storetest.Run(t, func(t *testing.T) storetest.Backend {
+		return storetest.Backend{Storage: NewStorage(mem.NewStorage(nil))}
+	})
+}
+
+func TestStorage_Isolation(t *testing.T) {
+	backend := mem.NewStorage(nil)
+	s := NewStorage(backend)
+	ctxA := WithTenant(context.Background(), "team-a")
+	ctxB := WithTenant(context.Background(), "team-b")
+
+	valueA, valueB := 1.0, 2.0
+	require.NoError(t, store.SaveAllMetric(ctxA, s, []*store.Metric{{ID: "HeapAlloc", MType: store.MTypeGauge, Value: &valueA}}))
+	require.NoError(t, s.Create(ctxB, &store.Metric{ID: "HeapAlloc", MType: store.MTypeGauge, Value: &valueB}))
+
+	found, err := s.Read(ctxA, "HeapAlloc", store.MTypeGauge)
+	require.NoError(t, err)
+	require.Equal(t, "HeapAlloc", found.ID)
+	require.Equal(t, valueA, *found.Value)
+
+	found, err = s.Read(ctxB, "HeapAlloc", store.MTypeGauge)
+	require.NoError(t, err)
+	require.Equal(t, valueB, *found.Value)
+
+	listed, err := s.List(ctxA)
+	require.NoError(t, err)
+	require.Len(t, listed, 1)
+	require.Equal(t, "HeapAlloc", listed[0].ID)
+	require.Equal(t, valueA, *listed[0].Value)
+
+	// без арендатора видно всё хранилище с ключами арендаторов
+	all, err := s.List(context.Background())
+	require.NoError(t, err)
+	ids := make([]string, 0, len(all))
+	for _, m := range all {
+		ids = append(ids, m.ID)
+	}
+	require.ElementsMatch(t, []string{"team-a/HeapAlloc", "team-b/HeapAlloc"}, ids)
+
+	require.NoError(t, s.Delete(ctxA, "HeapAlloc", store.MTypeGauge))
+	_, err = s.Read(ctxA, "HeapAlloc", store.MTypeGauge)
+	require.ErrorIs(t, err, store.ErrValueNotFound)
+	_, err = s.Read(ctxB, "HeapAlloc", store.MTypeGauge)
+	require.NoError(t, err)
+
+	err = s.Update(ctxA, &store.Metric{ID: "HeapAlloc", MType: store.MTypeGauge, Value: &valueA})
+	require.ErrorIs(t, err, store.ErrValueNotFound)
+}
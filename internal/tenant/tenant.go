@@ -0,0 +1,149 @@
+// Package tenant isolates metrics of several teams sharing one collector.
+//
+// Every request carries the API key of its tenant, the key is resolved to the tenant name
+// and put into the request context. Storage keys of tenant metrics are prefixed with the tenant name,
+// e.g. "team-a/HeapAlloc", so tenants never see or overwrite metrics of each other.
+package tenant
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/andreevym/metric-collector/internal/storage/store"
+)
+
+const (
+	// Header HTTP header with the tenant API key.
+	Header = "X-API-Key"
+	// MetadataKey gRPC metadata key with the tenant API key.
+	MetadataKey = "x-api-key"
+
+	separator = "/"
+)
+
+var nameRegexp = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+type entry struct {
+	name   string
+	apiKey []byte
+}
+
+// Keys resolves API keys to tenant names.
+type Keys struct {
+	entries []entry
+}
+
+// ParseKeys parses a comma separated list of "tenant=key" pairs, e.g. "team-a=secret1,team-b=secret2".
+// Tenant names may contain only latin letters, digits, '-' and '_', a tenant may have several keys.
+func ParseKeys(s string) (*Keys, error) {
+	keys := &Keys{}
+	seen := map[string]struct{}{}
+	for _, item := range strings.Split(s, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+
+		name, apiKey, ok := strings.Cut(item, "=")
+		name = strings.TrimSpace(name)
+		apiKey = strings.TrimSpace(apiKey)
+		if !ok || apiKey == "" {
+			return nil, fmt.Errorf("tenant key of '%s' must look like tenant=key", name)
+		}
+		if !nameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("invalid tenant name '%s'", name)
+		}
+		if _, ok := seen[apiKey]; ok {
+			return nil, fmt.Errorf("tenant key of '%s' is already used by another tenant", name)
+		}
+		seen[apiKey] = struct{}{}
+
+		keys.entries = append(keys.entries, entry{name: name, apiKey: []byte(apiKey)})
+	}
+	return keys, nil
+}
+
+// Enabled reports whether any tenant is configured.
+func (k *Keys) Enabled() bool {
+	return k != nil && len(k.entries) > 0
+}
+
+// Lookup returns the tenant owning apiKey.
+// All keys are compared in constant time, so the response time doesn't reveal a matching prefix.
+func (k *Keys) Lookup(apiKey string) (string, bool) {
+	if k == nil || apiKey == "" {
+		return "", false
+	}
+
+	var name string
+	found := false
+	for _, e := range k.entries {
+		if subtle.ConstantTimeCompare(e.apiKey, []byte(apiKey)) == 1 {
+			name = e.name
+			found = true
+		}
+	}
+	return name, found
+}
+
+// Has reports whether the tenant is configured.
+func (k *Keys) Has(name string) bool {
+	if k == nil {
+		return false
+	}
+	for _, e := range k.entries {
+		if e.name == name {
+			return true
+		}
+	}
+	return false
+}
+
+type tenantKey struct{}
+
+// WithTenant returns a copy of ctx scoped to the tenant.
+func WithTenant(ctx context.Context, name string) context.Context {
+	return context.WithValue(ctx, tenantKey{}, name)
+}
+
+// FromContext returns the tenant of ctx, ok is false for requests without tenants.
+func FromContext(ctx context.Context) (name string, ok bool) {
+	name, ok = ctx.Value(tenantKey{}).(string)
+	return name, ok && name != ""
+}
+
+// QualifyID returns the storage ID of the metric id of the ctx tenant.
+// Without a tenant the ID is not changed.
+func QualifyID(ctx context.Context, id string) string {
+	name, ok := FromContext(ctx)
+	if !ok {
+		return id
+	}
+	return name + separator + id
+}
+
+// UnqualifyID returns the metric ID without the namespace of the ctx tenant,
+// ok is false if the storage ID belongs to another tenant.
+func UnqualifyID(ctx context.Context, id string) (string, bool) {
+	name, ok := FromContext(ctx)
+	if !ok {
+		return id, true
+	}
+	return strings.CutPrefix(id, name+separator)
+}
+
+// Qualify returns copies of metrics with storage IDs of the ctx tenant.
+func Qualify(ctx context.Context, metrics []*store.Metric) []*store.Metric {
+	if _, ok := FromContext(ctx); !ok {
+		return metrics
+	}
+
+	qualified := make([]*store.Metric, 0, len(metrics))
+	for _, m := range metrics {
+		qualified = append(qualified, qualify(ctx, m))
+	}
+	return qualified
+}
@@ -0,0 +1,54 @@
+package tenant
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseKeys(t *testing.T) {
+	keys, err := ParseKeys(" team-a=secret1, team_b=secret2,team-a=secret3")
+	require.NoError(t, err)
+	require.True(t, keys.Enabled())
+
+	for apiKey, want := range map[string]string{"secret1": "team-a", "secret2": "team_b", "secret3": "team-a"} {
+		name, ok := keys.Lookup(apiKey)
+		require.True(t, ok, apiKey)
+		require.Equal(t, want, name)
+	}
+	for _, apiKey := range []string{"", "secret", "secret10"} {
+		_, ok := keys.Lookup(apiKey)
+		require.False(t, ok, apiKey)
+	}
+
+	empty, err := ParseKeys("")
+	require.NoError(t, err)
+	require.False(t, empty.Enabled())
+	_, ok := empty.Lookup("secret1")
+	require.False(t, ok)
+
+	for _, invalid := range []string{"team-a", "team-a=", "team/a=secret", "=secret", "a=secret,b=secret"} {
+		_, err = ParseKeys(invalid)
+		require.Error(t, err, invalid)
+	}
+}
+
+func TestQualify(t *testing.T) {
+	delta := int64(1)
+	metrics := []*store.Metric{{ID: "PollCount", MType: store.MTypeCounter, Delta: &delta}}
+
+	require.Equal(t, metrics, Qualify(context.Background(), metrics))
+
+	ctx := WithTenant(context.Background(), "team-a")
+	qualified := Qualify(ctx, metrics)
+	require.Equal(t, "team-a/PollCount", qualified[0].ID)
+	require.Equal(t, "PollCount", metrics[0].ID, "metrics of the caller must not be modified")
+
+	id, ok := UnqualifyID(ctx, "team-a/PollCount")
+	require.True(t, ok)
+	require.Equal(t, "PollCount", id)
+	_, ok = UnqualifyID(ctx, "team-b/PollCount")
+	require.False(t, ok)
+}
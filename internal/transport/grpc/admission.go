@@ -0,0 +1,39 @@
+package grpc
+
+import (
+	"errors"
+
+	"github.com/andreevym/metric-collector/internal/cardinality"
+	"github.com/andreevym/metric-collector/internal/ingest"
+	"github.com/andreevym/metric-collector/internal/ratelimit"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+// admissionStatus converts a rejection of metrics by the controller to a status:
+// ResourceExhausted with the RetryInfo detail for client limits, ResourceExhausted for cardinality limits
+// InvalidArgument for invalid names and Unavailable if the ingest buffer is full. ok is false for other errors.
+func admissionStatus(err error) (error, bool) {
+	var limitErr *ratelimit.Error
+	switch {
+	case errors.As(err, &limitErr):
+		st := status.New(codes.ResourceExhausted, limitErr.Error())
+		if limitErr.RetryAfter > 0 {
+			detailed, detailsErr := st.WithDetails(&errdetails.RetryInfo{RetryDelay: durationpb.New(limitErr.RetryAfter)})
+			if detailsErr == nil {
+				st = detailed
+			}
+		}
+		return st.Err(), true
+	case errors.Is(err, cardinality.ErrLimitExceeded):
+		return status.Error(codes.ResourceExhausted, err.Error()), true
+	case errors.Is(err, cardinality.ErrInvalidName):
+		return status.Error(codes.InvalidArgument, err.Error()), true
+	case errors.Is(err, ingest.ErrBufferFull):
+		return status.Error(codes.Unavailable, err.Error()), true
+	default:
+		return nil, false
+	}
+}
@@ -0,0 +1,50 @@
+package grpc
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/cardinality"
+	"github.com/andreevym/metric-collector/internal/ingest"
+	"github.com/andreevym/metric-collector/internal/ratelimit"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+func TestAdmissionStatus(t *testing.T) {
+	err := fmt.Errorf("failed to admit metrics: %w", &ratelimit.Error{
+		Err:        ratelimit.ErrRateLimited,
+		Client:     "ip:10.0.0.1",
+		RetryAfter: 1500 * time.Millisecond,
+	})
+
+	st, ok := admissionStatus(err)
+	require.True(t, ok)
+	require.Equal(t, codes.ResourceExhausted, status.Code(st))
+	details := status.Convert(st).Details()
+	require.Len(t, details, 1)
+	retryInfo, ok := details[0].(*errdetails.RetryInfo)
+	require.True(t, ok)
+	require.Equal(t, 1500*time.Millisecond, retryInfo.RetryDelay.AsDuration())
+
+	st, ok = admissionStatus(fmt.Errorf("failed to admit metrics: %w", cardinality.ErrLimitExceeded))
+	require.True(t, ok)
+	require.Equal(t, codes.ResourceExhausted, status.Code(st))
+
+	st, ok = admissionStatus(fmt.Errorf("failed to admit metrics: %w", cardinality.ErrInvalidName))
+	require.True(t, ok)
+	require.Equal(t, codes.InvalidArgument, status.Code(st))
+
+	st, ok = admissionStatus(fmt.Errorf("error buffering metrics: %w", ingest.ErrBufferFull))
+	require.True(t, ok)
+	require.Equal(t, codes.Unavailable, status.Code(st))
+
+	_, ok = admissionStatus(errors.New("storage is unavailable"))
+	require.False(t, ok)
+	_, ok = admissionStatus(nil)
+	require.False(t, ok)
+}
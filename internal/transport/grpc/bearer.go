@@ -0,0 +1,61 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/oidc"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// bearerInterceptor verifies the bearer token of the oidc.MetadataKey metadata and puts its claims
+// into the call context. Calls without a token pass unchanged, calls with an invalid token
+// are rejected with Unauthenticated.
+func (s *Server) bearerInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	ctx, err := s.verifyBearer(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) bearerStreamInterceptor(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	ctx, err := s.verifyBearer(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+}
+
+func (s *Server) verifyBearer(ctx context.Context, method string) (context.Context, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get(oidc.MetadataKey)
+	if len(values) == 0 {
+		return ctx, nil
+	}
+	token, ok := oidc.BearerToken(values[0])
+	if !ok {
+		return ctx, nil
+	}
+
+	claims, err := s.bearer.Verify(ctx, token)
+	if err != nil {
+		logger.Logger().Warn("call with invalid bearer token", zap.String("method", method), zap.Error(err))
+		return nil, status.Error(codes.Unauthenticated, "invalid bearer token")
+	}
+	return oidc.WithClaims(ctx, claims), nil
+}
@@ -0,0 +1,56 @@
+package grpc
+
+import (
+	"fmt"
+
+	"github.com/andreevym/metric-collector/internal/crypto"
+	"google.golang.org/grpc/encoding"
+	"google.golang.org/protobuf/proto"
+)
+
+// cryptoCodec marshals messages with protobuf and encrypts them into crypto envelopes.
+// The messages are encrypted on the codec level, since interceptors see already unmarshaled messages.
+// Requests of the agent are encrypted with the public key of the server, responses are not encrypted.
+type cryptoCodec struct {
+	encrypter *crypto.Encrypter
+	decrypter *crypto.Decrypter
+}
+
+// NewClientCodec returns the codec that encrypts requests for the server with encrypter,
+// use it with grpc.ForceCodec.
+func NewClientCodec(encrypter *crypto.Encrypter) encoding.Codec {
+	return cryptoCodec{encrypter: encrypter}
+}
+
+func (c cryptoCodec) Marshal(v any) ([]byte, error) {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return nil, fmt.Errorf("failed to marshal, message is %T, want proto.Message", v)
+	}
+	b, err := proto.Marshal(msg)
+	if err != nil || c.encrypter == nil {
+		return b, err
+	}
+	return c.encrypter.Encrypt(b)
+}
+
+func (c cryptoCodec) Unmarshal(data []byte, v any) error {
+	msg, ok := v.(proto.Message)
+	if !ok {
+		return fmt.Errorf("failed to unmarshal, message is %T, want proto.Message", v)
+	}
+	if c.decrypter != nil {
+		var err error
+		data, err = c.decrypter.Decrypt(data)
+		if err != nil {
+			return fmt.Errorf("failed to decrypt message: %w", err)
+		}
+	}
+	return proto.Unmarshal(data, msg)
+}
+
+// Name is the content subtype of the default protobuf codec, so that the server accepts encrypted requests
+// as regular protobuf ones.
+func (cryptoCodec) Name() string {
+	return "proto"
+}
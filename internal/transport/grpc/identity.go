@@ -0,0 +1,29 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/andreevym/metric-collector/internal/identity"
+	"google.golang.org/grpc"
+)
+
+// identityInterceptor attaches the client identity to the call context,
+// it must run after tenantInterceptor to account the client by its tenant.
+func (s *Server) identityInterceptor(
+	ctx context.Context,
+	req any,
+	_ *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	return handler(identity.WithIdentity(ctx, identity.FromGRPCContext(ctx, s.trustedSubnet)), req)
+}
+
+func (s *Server) identityStreamInterceptor(
+	srv any,
+	ss grpc.ServerStream,
+	_ *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	ctx := identity.WithIdentity(ss.Context(), identity.FromGRPCContext(ss.Context(), s.trustedSubnet))
+	return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+}
@@ -0,0 +1,248 @@
+package grpc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/hash"
+	"github.com/andreevym/metric-collector/internal/identity"
+	"github.com/andreevym/metric-collector/internal/logger"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/peer"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// Metadata keys of the request signature, they are the gRPC counterparts of the hash package HTTP headers.
+const (
+	HashMetadataKey      = "hashsha256"
+	TimestampMetadataKey = "x-signature-timestamp"
+	NonceMetadataKey     = "x-signature-nonce"
+)
+
+// marshal returns deterministically marshaled msg, so that the client and the server sign the same bytes.
+func marshal(msg proto.Message) ([]byte, error) {
+	return proto.MarshalOptions{Deterministic: true}.Marshal(msg)
+}
+
+// MessageHash returns HMAC-SHA256 of msg signed with key, it is used to sign responses.
+func MessageHash(msg proto.Message, key string) (string, error) {
+	b, err := marshal(msg)
+	if err != nil {
+		return "", err
+	}
+	return hash.Sum(b, key), nil
+}
+
+// VerifyResponse checks the signature of the response msg sent by the server in the header metadata.
+func VerifyResponse(msg proto.Message, header metadata.MD, key string) error {
+	b, err := marshal(msg)
+	if err != nil {
+		return fmt.Errorf("failed to marshal response: %w", err)
+	}
+	values := header.Get(HashMetadataKey)
+	if len(values) == 0 || !hash.Equal(b, key, values[0]) {
+		return errors.New("response signature mismatch")
+	}
+	return nil
+}
+
+// SignRequest returns ctx with the signature of the request msg to the full method in the outgoing metadata.
+func SignRequest(ctx context.Context, fullMethod string, msg proto.Message, secret string) (context.Context, error) {
+	b, err := marshal(msg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request: %w", err)
+	}
+	signed, err := hash.NewRequest(grpcMethod, fullMethod, b)
+	if err != nil {
+		return nil, err
+	}
+	return metadata.AppendToOutgoingContext(ctx,
+		TimestampMetadataKey, strconv.FormatInt(signed.Timestamp, 10),
+		NonceMetadataKey, signed.Nonce,
+		HashMetadataKey, signed.Sign(secret),
+	), nil
+}
+
+// grpcMethod HTTP method of every gRPC call, it is a part of the signed request.
+const grpcMethod = "POST"
+
+// loggingInterceptor logs every call with its duration and status code, like RequestLoggerMiddleware.
+func (s *Server) loggingInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+	logCall(info.FullMethod, start, err)
+	return resp, err
+}
+
+func (s *Server) loggingStreamInterceptor(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	start := time.Now()
+	err := handler(srv, ss)
+	logCall(info.FullMethod, start, err)
+	return err
+}
+
+func logCall(method string, start time.Time, err error) {
+	logger.Logger().Info(
+		"request",
+		zap.String("method", method),
+		zap.Duration("duration", time.Since(start)),
+		zap.String("code", status.Code(err).String()),
+	)
+}
+
+// trustedSubnetInterceptor rejects calls from addresses outside the trusted subnets like TrustedSubnetMiddleware,
+// the address is taken from the peer or from the x-real-ip metadata set by a trusted proxy.
+func (s *Server) trustedSubnetInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	if err := s.checkTrustedSubnet(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) trustedSubnetStreamInterceptor(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if err := s.checkTrustedSubnet(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+func (s *Server) checkTrustedSubnet(ctx context.Context, method string) error {
+	var peerAddr, realIP string
+	if p, ok := peer.FromContext(ctx); ok && p.Addr != nil {
+		peerAddr = p.Addr.String()
+	}
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(identity.RealIPMetadataKey); len(values) > 0 {
+			realIP = values[0]
+		}
+	}
+	if ip, ok := s.trustedSubnet.Allow(peerAddr, realIP); !ok {
+		logger.Logger().Warn("call from untrusted address",
+			zap.String("method", method),
+			zap.String("peer", peerAddr),
+			zap.String("real_ip", realIP),
+			zap.Stringer("ip", ip),
+		)
+		return status.Error(codes.PermissionDenied, "trusted subnet not trusted")
+	}
+	return nil
+}
+
+// hashInterceptor verifies the signature of the request message like RequestHashMiddleware,
+// and sends HMAC-SHA256 of the response message in the header metadata like ResponseHashMiddleware,
+// the response is signed with the secret that verified the request.
+func (s *Server) hashInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	secret, err := s.verifyRequest(ctx, req, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	if secret == "" {
+		secret = s.secretKey
+	}
+
+	resp, err := handler(ctx, req)
+	if err != nil || secret == "" {
+		return resp, err
+	}
+	if msg, ok := resp.(proto.Message); ok {
+		respHash, hashErr := MessageHash(msg, secret)
+		if hashErr == nil {
+			hashErr = grpc.SetHeader(ctx, metadata.Pairs(HashMetadataKey, respHash))
+		}
+		if hashErr != nil {
+			logger.Logger().Error("failed to send response hash", zap.Error(hashErr))
+		}
+	}
+	return resp, nil
+}
+
+// verifyRequest returns the secret that verified the request signature, or empty string for unsigned requests.
+func (s *Server) verifyRequest(ctx context.Context, req any, fullMethod string) (string, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	first := func(key string) string {
+		if values := md.Get(key); len(values) > 0 {
+			return values[0]
+		}
+		return ""
+	}
+
+	signature := first(HashMetadataKey)
+	if signature == "" {
+		if s.requireSignature {
+			return "", status.Error(codes.Unauthenticated, hash.ErrMissingSignature.Error())
+		}
+		return "", nil
+	}
+
+	msg, ok := req.(proto.Message)
+	if !ok {
+		return "", status.Error(codes.InvalidArgument, "unexpected request message")
+	}
+	b, err := marshal(msg)
+	if err != nil {
+		return "", status.Errorf(codes.InvalidArgument, "failed to marshal request: %v", err)
+	}
+	timestamp, _ := strconv.ParseInt(first(TimestampMetadataKey), 10, 64)
+	signed := hash.Request{
+		Method:    grpcMethod,
+		Path:      fullMethod,
+		Timestamp: timestamp,
+		Nonce:     first(NonceMetadataKey),
+		Body:      b,
+	}
+	secret, err := s.verifier.Verify(signed, signature)
+	if err != nil {
+		logger.Logger().Error("request signature is rejected",
+			zap.String("method", fullMethod),
+			zap.Int64("timestamp", timestamp),
+			zap.Error(err),
+		)
+		if errors.Is(err, hash.ErrTooManyNonces) {
+			return "", status.Error(codes.Unavailable, err.Error())
+		}
+		return "", status.Error(codes.Unauthenticated, err.Error())
+	}
+	return secret, nil
+}
+
+// serverStream replaces the context of a stream, so that stream interceptors can scope it like unary ones.
+type serverStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *serverStream) Context() context.Context {
+	return s.ctx
+}
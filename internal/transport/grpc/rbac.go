@@ -0,0 +1,62 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/rbac"
+	"github.com/andreevym/metric-collector/internal/transport/grpc/proto"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// methodRoles roles required by the RPCs, ping is allowed to everyone like the HTTP route.
+// RPCs missing here require the admin role, so a new RPC is closed until it is listed.
+var methodRoles = map[string]rbac.Role{
+	proto.MetricCollector_Updates_FullMethodName: rbac.RoleIngest,
+	proto.MetricCollector_Update_FullMethodName:  rbac.RoleIngest,
+	proto.MetricCollector_Value_FullMethodName:   rbac.RoleRead,
+}
+
+// rbacInterceptor rejects calls of clients without the role of the RPC,
+// it must run after identityInterceptor.
+func (s *Server) rbacInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	if err := s.authorize(ctx, info.FullMethod); err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) rbacStreamInterceptor(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	if err := s.authorize(ss.Context(), info.FullMethod); err != nil {
+		return err
+	}
+	return handler(srv, ss)
+}
+
+func (s *Server) authorize(ctx context.Context, method string) error {
+	if method == proto.MetricCollector_Ping_FullMethodName {
+		return nil
+	}
+	role, ok := methodRoles[method]
+	if !ok {
+		role = rbac.RoleAdmin
+	}
+	if err := s.rbac.Authorize(ctx, role); err != nil {
+		logger.Logger().Warn("call is forbidden", zap.String("method", method), zap.Error(err))
+		return status.Error(codes.PermissionDenied, err.Error())
+	}
+	return nil
+}
@@ -3,71 +3,159 @@ package grpc
 import (
 	"context"
 	"fmt"
+	"github.com/andreevym/metric-collector/internal/config"
 	"github.com/andreevym/metric-collector/internal/controller"
+	"github.com/andreevym/metric-collector/internal/crypto"
+	"github.com/andreevym/metric-collector/internal/hash"
 	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/oidc"
+	"github.com/andreevym/metric-collector/internal/rbac"
 	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/subnet"
+	"github.com/andreevym/metric-collector/internal/tenant"
 	"github.com/andreevym/metric-collector/internal/transport/grpc/proto"
 	"go.uber.org/zap"
 	"google.golang.org/grpc"
 	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
+	_ "google.golang.org/grpc/encoding/gzip" // регистрирует gzip, сервер принимает и отдаёт сжатые сообщения
 	"google.golang.org/grpc/status"
 	"net"
+	"time"
 )
 
 type Server struct {
 	proto.UnimplementedMetricCollectorServer
 
-	grpcServer    *grpc.Server
-	metricStorage store.Storage
-	dbClient      store.Client
-	controller    controller.Controller
-	secretKey     string
-	cryptoKey     string
-	trustedSubnet string
-	address       string
+	grpcServer       *grpc.Server
+	metricStorage    store.Storage
+	controller       controller.Controller
+	secretKey        string
+	verifier         *hash.Verifier
+	requireSignature bool
+	trustedSubnet    *subnet.Policy
+	address          string
+	tenants          *tenant.Keys
+	rbac             *rbac.Policy
+	bearer           *oidc.Verifier
 }
 
 func NewGrpcServer(
-	dbClient store.Client,
+	ctrl controller.Controller,
 	metricStorage store.Storage,
-	secretKey string,
-	cryptoKey string,
-	trustedSubnet string,
-	address string,
-) *Server {
-	controller := controller.NewController(metricStorage, dbClient)
-	return &Server{
+	cfg *config.ServerConfig,
+) (*Server, error) {
+	tenants, err := tenant.ParseKeys(cfg.TenantKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tenant keys: %w", err)
+	}
+
+	trustedSubnet, err := subnet.ParsePolicy(cfg.TrustedSubnet, cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+
+	tlsConfig, err := crypto.ServerTLSConfig(cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tls config: %w", err)
+	}
+
+	decrypter, err := crypto.LoadDecrypter(cfg.CryptoKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load crypto key: %w", err)
+	}
+
+	policy, err := rbac.ParseBindings(cfg.RBACBindings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rbac bindings: %w", err)
+	}
+
+	s := &Server{
 		metricStorage: metricStorage,
-		dbClient:      dbClient,
-		secretKey:     secretKey,
-		cryptoKey:     cryptoKey,
-		trustedSubnet: trustedSubnet,
-		address:       address,
-		controller:    controller,
+		secretKey:     cfg.SecretKey,
+		verifier: hash.NewVerifier(
+			hash.ParseSecrets(cfg.SecretKey, cfg.SecretKeys),
+			time.Duration(cfg.SignatureMaxSkew)*time.Second,
+		),
+		requireSignature: cfg.RequireSignature,
+		trustedSubnet:    trustedSubnet,
+		address:          cfg.GrpcAddress,
+		controller:       ctrl,
+		tenants:          tenants,
+		rbac:             policy,
+		bearer: oidc.NewVerifier(oidc.Options{
+			JWKS:        cfg.OIDCJWKS,
+			Issuer:      cfg.OIDCIssuer,
+			Audience:    cfg.OIDCAudience,
+			TenantClaim: cfg.OIDCTenantClaim,
+			RolesClaim:  cfg.OIDCRolesClaim,
+			CacheTTL:    time.Duration(cfg.OIDCJWKSCacheTTL) * time.Second,
+		}),
+	}
+
+	interceptors := []grpc.UnaryServerInterceptor{s.loggingInterceptor}
+	streamInterceptors := []grpc.StreamServerInterceptor{s.loggingStreamInterceptor}
+	if trustedSubnet.Enabled() {
+		interceptors = append(interceptors, s.trustedSubnetInterceptor)
+		streamInterceptors = append(streamInterceptors, s.trustedSubnetStreamInterceptor)
+	}
+	if s.verifier != nil {
+		interceptors = append(interceptors, s.hashInterceptor)
+	}
+	if s.bearer.Enabled() {
+		interceptors = append(interceptors, s.bearerInterceptor)
+		streamInterceptors = append(streamInterceptors, s.bearerStreamInterceptor)
+	}
+	if tenants.Enabled() {
+		interceptors = append(interceptors, s.tenantInterceptor)
+		streamInterceptors = append(streamInterceptors, s.tenantStreamInterceptor)
+	}
+	interceptors = append(interceptors, s.identityInterceptor)
+	streamInterceptors = append(streamInterceptors, s.identityStreamInterceptor)
+	// роли bearer токенов проверяются и без привязок ролей
+	if policy.Enabled() || s.bearer.Enabled() {
+		interceptors = append(interceptors, s.rbacInterceptor)
+		streamInterceptors = append(streamInterceptors, s.rbacStreamInterceptor)
 	}
+	opts := []grpc.ServerOption{
+		grpc.ChainUnaryInterceptor(interceptors...),
+		grpc.ChainStreamInterceptor(streamInterceptors...),
+	}
+	if tlsConfig != nil {
+		opts = append(opts, grpc.Creds(credentials.NewTLS(tlsConfig)))
+	}
+	if decrypter != nil {
+		opts = append(opts, grpc.ForceServerCodec(cryptoCodec{decrypter: decrypter}))
+	}
+	s.grpcServer = grpc.NewServer(opts...)
+	proto.RegisterMetricCollectorServer(s.grpcServer, s)
+	return s, nil
 }
 
-func (s Server) Run() error {
+func (s *Server) Run() error {
 	listen, err := net.Listen("tcp", s.address)
 	if err != nil {
 		return fmt.Errorf("run grpc server: %w", err)
 	}
-	s.grpcServer = grpc.NewServer()
-	proto.RegisterMetricCollectorServer(s.grpcServer, &Server{})
 	logger.Logger().Info("listening grpc server", zap.String("address", s.address))
+	return s.Serve(listen)
+}
+
+// Serve accepts connections on the listener until Shutdown is called.
+func (s *Server) Serve(listen net.Listener) error {
 	if err := s.grpcServer.Serve(listen); err != nil {
 		return fmt.Errorf("start grpc server: %w", err)
 	}
 	return nil
 }
 
-func (s Server) Shutdown() error {
+func (s *Server) Shutdown() error {
 	logger.Logger().Info("shutting down grpc server")
 	s.grpcServer.GracefulStop()
 	return nil
 }
 
-func (s Server) Ping(context.Context, *proto.PingRequest) (*proto.PingResponse, error) {
+func (s *Server) Ping(context.Context, *proto.PingRequest) (*proto.PingResponse, error) {
 	err := s.controller.Ping()
 	if err != nil {
 		return nil, fmt.Errorf("ping error: %w", err)
@@ -75,7 +163,7 @@ func (s Server) Ping(context.Context, *proto.PingRequest) (*proto.PingResponse,
 
 	return &proto.PingResponse{}, nil
 }
-func (s Server) Updates(ctx context.Context, updatesRequest *proto.UpdatesRequest) (*proto.UpdatesResponse, error) {
+func (s *Server) Updates(ctx context.Context, updatesRequest *proto.UpdatesRequest) (*proto.UpdatesResponse, error) {
 	metrics := make([]*store.Metric, 0, len(updatesRequest.Metrics))
 	for _, metric := range updatesRequest.Metrics {
 		metrics = append(metrics, &store.Metric{
@@ -86,13 +174,16 @@ func (s Server) Updates(ctx context.Context, updatesRequest *proto.UpdatesReques
 		})
 	}
 	err := s.controller.Updates(ctx, metrics)
+	if st, ok := admissionStatus(err); ok {
+		return nil, st
+	}
 	if err != nil {
 		return nil, fmt.Errorf("update metrics error: %w", err)
 	}
 	return &proto.UpdatesResponse{}, nil
 }
 
-func (s Server) Update(ctx context.Context, r *proto.UpdateRequest) (*proto.UpdateResponse, error) {
+func (s *Server) Update(ctx context.Context, r *proto.UpdateRequest) (*proto.UpdateResponse, error) {
 	m := &store.Metric{
 		ID:    r.Id,
 		MType: r.Type,
@@ -101,6 +192,9 @@ func (s Server) Update(ctx context.Context, r *proto.UpdateRequest) (*proto.Upda
 	}
 
 	respMetric, err := s.controller.Update(ctx, m)
+	if st, ok := admissionStatus(err); ok {
+		return nil, st
+	}
 	if err != nil {
 		return nil, fmt.Errorf("failed to update metrics: %w", err)
 	}
@@ -118,7 +212,7 @@ func (s Server) Update(ctx context.Context, r *proto.UpdateRequest) (*proto.Upda
 	return updateResponse, nil
 }
 
-func (s Server) Value(ctx context.Context, r *proto.ValueRequest) (*proto.ValueResponse, error) {
+func (s *Server) Value(ctx context.Context, r *proto.ValueRequest) (*proto.ValueResponse, error) {
 	metric := s.controller.Value(ctx, r.Id, r.MetricType)
 	if metric == nil {
 		return nil, status.Error(codes.NotFound, "metric not found")
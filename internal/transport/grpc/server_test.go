@@ -0,0 +1,248 @@
+package grpc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/config"
+	"github.com/andreevym/metric-collector/internal/controller"
+	"github.com/andreevym/metric-collector/internal/crypto"
+	"github.com/andreevym/metric-collector/internal/identity"
+	"github.com/andreevym/metric-collector/internal/oidc"
+	"github.com/andreevym/metric-collector/internal/storage/mem"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/tenant"
+	"github.com/andreevym/metric-collector/internal/transport/grpc/proto"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/encoding/gzip"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+func newTestClient(t *testing.T, cfg *config.ServerConfig, opts ...grpc.DialOption) proto.MetricCollectorClient {
+	t.Helper()
+	storage := mem.NewStorage(nil)
+	s, err := NewGrpcServer(controller.NewController(storage, nil), storage, cfg)
+	require.NoError(t, err)
+
+	lis := bufconn.Listen(1024 * 1024)
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(func() { _ = s.Shutdown() })
+
+	opts = append([]grpc.DialOption{
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return lis.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+		grpc.WithDefaultCallOptions(grpc.UseCompressor(gzip.Name)),
+	}, opts...)
+	conn, err := grpc.NewClient("passthrough:///bufconn", opts...)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return proto.NewMetricCollectorClient(conn)
+}
+
+func TestServer_UpdatesAndValue(t *testing.T) {
+	client := newTestClient(t, &config.ServerConfig{})
+	ctx := context.Background()
+
+	_, err := client.Updates(ctx, &proto.UpdatesRequest{Metrics: []*proto.Metric{
+		{Id: "PollCount", Type: store.MTypeCounter, Delta: 3},
+		{Id: "Alloc", Type: store.MTypeGauge, Value: 1.5},
+	}})
+	require.NoError(t, err)
+
+	resp, err := client.Value(ctx, &proto.ValueRequest{Id: "PollCount", MetricType: store.MTypeCounter})
+	require.NoError(t, err)
+	require.Equal(t, int64(3), resp.Metric.Delta)
+
+	_, err = client.Value(ctx, &proto.ValueRequest{Id: "missing", MetricType: store.MTypeGauge})
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_Hash(t *testing.T) {
+	const key = "secret"
+	client := newTestClient(t, &config.ServerConfig{SecretKey: key, SecretKeys: "previous"})
+	req := &proto.UpdateRequest{Id: "Alloc", Type: store.MTypeGauge, Value: 1.5}
+
+	ctx, err := SignRequest(context.Background(), proto.MetricCollector_Update_FullMethodName, req, key)
+	require.NoError(t, err)
+	var header metadata.MD
+	resp, err := client.Update(ctx, req, grpc.Header(&header))
+	require.NoError(t, err)
+	responseHash, err := MessageHash(resp, key)
+	require.NoError(t, err)
+	require.Equal(t, []string{responseHash}, header.Get(HashMetadataKey))
+
+	// повторная отправка той же подписи отклоняется
+	_, err = client.Update(ctx, req)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// ответ подписывается ключом, которым подписан запрос
+	ctx, err = SignRequest(context.Background(), proto.MetricCollector_Update_FullMethodName, req, "previous")
+	require.NoError(t, err)
+	resp, err = client.Update(ctx, req, grpc.Header(&header))
+	require.NoError(t, err)
+	require.NoError(t, VerifyResponse(resp, header, "previous"))
+	require.Error(t, VerifyResponse(resp, header, key))
+
+	// подпись другого метода не подходит
+	ctx, err = SignRequest(context.Background(), proto.MetricCollector_Updates_FullMethodName, req, key)
+	require.NoError(t, err)
+	_, err = client.Update(ctx, req)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+
+	// запрос без подписи принимается, как и в HTTP
+	_, err = client.Update(context.Background(), req)
+	require.NoError(t, err)
+
+	client = newTestClient(t, &config.ServerConfig{SecretKey: key, RequireSignature: true})
+	_, err = client.Update(context.Background(), req)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+// newTCPTestClient connects to the server over loopback TCP, so that the peer has an IP address.
+func newTCPTestClient(t *testing.T, cfg *config.ServerConfig) proto.MetricCollectorClient {
+	t.Helper()
+	storage := mem.NewStorage(nil)
+	s, err := NewGrpcServer(controller.NewController(storage, nil), storage, cfg)
+	require.NoError(t, err)
+
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() { _ = s.Serve(lis) }()
+	t.Cleanup(func() { _ = s.Shutdown() })
+
+	conn, err := grpc.NewClient(lis.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = conn.Close() })
+	return proto.NewMetricCollectorClient(conn)
+}
+
+func TestServer_TrustedSubnet(t *testing.T) {
+	req := &proto.ValueRequest{Id: "Alloc", MetricType: store.MTypeGauge}
+	realIP := func(ip string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), identity.RealIPMetadataKey, ip)
+	}
+
+	client := newTCPTestClient(t, &config.ServerConfig{TrustedSubnet: "192.168.1.0/24,127.0.0.0/8"})
+	_, err := client.Value(context.Background(), req)
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	// адрес из метаданных принимается только от доверенного прокси
+	client = newTCPTestClient(t, &config.ServerConfig{TrustedSubnet: "192.168.1.0/24"})
+	_, err = client.Value(realIP("192.168.1.10"), req)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	client = newTCPTestClient(t, &config.ServerConfig{TrustedSubnet: "192.168.1.0/24", TrustedProxies: "127.0.0.1"})
+	_, err = client.Value(realIP("192.168.1.10"), req)
+	require.Equal(t, codes.NotFound, status.Code(err))
+	_, err = client.Value(realIP("10.0.0.1"), req)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.Value(context.Background(), req)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	// адрес bufconn не является IP-адресом
+	_, err = newTestClient(t, &config.ServerConfig{TrustedSubnet: "192.168.1.0/24"}).Value(realIP("192.168.1.10"), req)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+}
+
+func TestServer_Encryption(t *testing.T) {
+	private, public, err := crypto.GenerateCertificate(crypto.CertificateOptions{Bits: 2048})
+	require.NoError(t, err)
+	encrypter, err := crypto.NewEncrypter(public)
+	require.NoError(t, err)
+	cfg := &config.ServerConfig{CryptoKey: private}
+	req := &proto.UpdateRequest{Id: "Alloc", Type: store.MTypeGauge, Value: 1.5}
+
+	client := newTestClient(t, cfg, grpc.WithDefaultCallOptions(grpc.ForceCodec(NewClientCodec(encrypter))))
+	resp, err := client.Update(context.Background(), req)
+	require.NoError(t, err)
+	require.Equal(t, 1.5, resp.Value)
+
+	// сервер с ключом не принимает незашифрованные запросы
+	_, err = newTestClient(t, cfg).Update(context.Background(), req)
+	require.Error(t, err)
+}
+
+func TestServer_RBAC(t *testing.T) {
+	client := newTestClient(t, &config.ServerConfig{
+		TenantKeys:   "agents=key-agents,dashboards=key-dashboards",
+		RBACBindings: "tenant:agents=ingest,tenant:dashboards=read",
+	})
+	as := func(apiKey string) context.Context {
+		return metadata.AppendToOutgoingContext(context.Background(), tenant.MetadataKey, apiKey)
+	}
+	update := &proto.UpdateRequest{Id: "Alloc", Type: store.MTypeGauge, Value: 1.5}
+	value := &proto.ValueRequest{Id: "missing", MetricType: store.MTypeGauge}
+
+	_, err := client.Update(as("key-agents"), update)
+	require.NoError(t, err)
+	_, err = client.Update(as("key-dashboards"), update)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+
+	_, err = client.Value(as("key-agents"), value)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	// чтение разрешено, поэтому отсутствующая метрика возвращает NotFound
+	_, err = client.Value(as("key-dashboards"), value)
+	require.Equal(t, codes.NotFound, status.Code(err))
+}
+
+func TestServer_Bearer(t *testing.T) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	encode := func(data []byte) string { return base64.RawURLEncoding.EncodeToString(data) }
+	jwks, err := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "EC", "crv": "P-256",
+		"x": encode(key.X.FillBytes(make([]byte, 32))), "y": encode(key.Y.FillBytes(make([]byte, 32))),
+	}}})
+	require.NoError(t, err)
+	jwksPath := filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(jwksPath, jwks, 0o600))
+	withToken := func(claims string) context.Context {
+		signingInput := encode([]byte(`{"alg":"ES256"}`)) + "." + encode([]byte(claims))
+		hashed := sha256.Sum256([]byte(signingInput))
+		r, s, err := ecdsa.Sign(rand.Reader, key, hashed[:])
+		require.NoError(t, err)
+		token := signingInput + "." + encode(append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...))
+		return metadata.AppendToOutgoingContext(context.Background(), oidc.MetadataKey, "Bearer "+token)
+	}
+	exp := time.Now().Add(time.Hour).Unix()
+
+	client := newTestClient(t, &config.ServerConfig{TenantKeys: "team-a=key-a", OIDCJWKS: jwksPath})
+	value := &proto.ValueRequest{Id: "missing", MetricType: store.MTypeGauge}
+	_, err = client.Value(withToken(fmt.Sprintf(`{"sub":"alice","tenant":"team-a","exp":%d}`, exp)), value)
+	require.Equal(t, codes.NotFound, status.Code(err))
+
+	update := &proto.UpdateRequest{Id: "Alloc", Type: store.MTypeGauge, Value: 1.5}
+	_, err = client.Update(withToken(fmt.Sprintf(`{"sub":"alice","tenant":"team-a","exp":%d}`, exp)), update)
+	require.Equal(t, codes.PermissionDenied, status.Code(err))
+	_, err = client.Update(metadata.AppendToOutgoingContext(context.Background(), tenant.MetadataKey, "key-a"), update)
+	require.NoError(t, err)
+
+	_, err = client.Value(withToken(fmt.Sprintf(`{"sub":"alice","tenant":"team-b","exp":%d}`, exp)), value)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+	_, err = client.Value(withToken(`{"sub":"alice","tenant":"team-a","exp":1}`), value)
+	require.Equal(t, codes.Unauthenticated, status.Code(err))
+}
+
+func TestNewGrpcServer_InvalidTrustedSubnet(t *testing.T) {
+	storage := mem.NewStorage(nil)
+	_, err := NewGrpcServer(controller.NewController(storage, nil), storage, &config.ServerConfig{TrustedSubnet: "invalid"})
+	require.Error(t, err)
+}
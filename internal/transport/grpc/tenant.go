@@ -0,0 +1,62 @@
+package grpc
+
+import (
+	"context"
+
+	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/oidc"
+	"github.com/andreevym/metric-collector/internal/tenant"
+	"go.uber.org/zap"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// tenantInterceptor resolves the tenant by the API key from the tenant.MetadataKey metadata or by the tenant claim
+// of the bearer token and scopes the call context to it, it must run after bearerInterceptor.
+// Calls without a known key or tenant are rejected with Unauthenticated.
+func (s *Server) tenantInterceptor(
+	ctx context.Context,
+	req any,
+	info *grpc.UnaryServerInfo,
+	handler grpc.UnaryHandler,
+) (any, error) {
+	ctx, err := s.scopeTenant(ctx, info.FullMethod)
+	if err != nil {
+		return nil, err
+	}
+	return handler(ctx, req)
+}
+
+func (s *Server) tenantStreamInterceptor(
+	srv any,
+	ss grpc.ServerStream,
+	info *grpc.StreamServerInfo,
+	handler grpc.StreamHandler,
+) error {
+	ctx, err := s.scopeTenant(ss.Context(), info.FullMethod)
+	if err != nil {
+		return err
+	}
+	return handler(srv, &serverStream{ServerStream: ss, ctx: ctx})
+}
+
+func (s *Server) scopeTenant(ctx context.Context, method string) (context.Context, error) {
+	var apiKey string
+	if md, ok := metadata.FromIncomingContext(ctx); ok {
+		if values := md.Get(tenant.MetadataKey); len(values) > 0 {
+			apiKey = values[0]
+		}
+	}
+
+	name, ok := s.tenants.Lookup(apiKey)
+	if claims, hasToken := oidc.FromContext(ctx); !ok && hasToken {
+		name, ok = claims.Tenant, s.tenants.Has(claims.Tenant)
+	}
+	if !ok {
+		logger.Logger().Warn("call with unknown tenant api key", zap.String("method", method))
+		return nil, status.Error(codes.Unauthenticated, "unknown tenant api key")
+	}
+	return tenant.WithTenant(ctx, name), nil
+}
@@ -0,0 +1,37 @@
+package grpc
+
+import (
+	"context"
+	"testing"
+
+	"github.com/andreevym/metric-collector/internal/tenant"
+	"github.com/stretchr/testify/require"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+func TestTenantInterceptor(t *testing.T) {
+	tenants, err := tenant.ParseKeys("team-a=key-a")
+	require.NoError(t, err)
+	s := &Server{tenants: tenants}
+	info := &grpc.UnaryServerInfo{FullMethod: "/MetricCollector/Updates"}
+	handler := func(ctx context.Context, _ any) (any, error) {
+		name, _ := tenant.FromContext(ctx)
+		return name, nil
+	}
+
+	ctx := metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenant.MetadataKey, "key-a"))
+	resp, err := s.tenantInterceptor(ctx, nil, info, handler)
+	require.NoError(t, err)
+	require.Equal(t, "team-a", resp)
+
+	for _, ctx := range []context.Context{
+		context.Background(),
+		metadata.NewIncomingContext(context.Background(), metadata.Pairs(tenant.MetadataKey, "key-b")),
+	} {
+		_, err = s.tenantInterceptor(ctx, nil, info, handler)
+		require.Equal(t, codes.Unauthenticated, status.Code(err))
+	}
+}
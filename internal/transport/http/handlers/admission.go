@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/andreevym/metric-collector/internal/cardinality"
+	"github.com/andreevym/metric-collector/internal/ingest"
+	"github.com/andreevym/metric-collector/internal/ratelimit"
+)
+
+// writeAdmissionError responds with a descriptive error if err is a rejection of metrics by the controller:
+// 429 with the Retry-After header for client limits, 422 for cardinality limits, 400 for invalid names
+// and 503 if the ingest buffer is full.
+func writeAdmissionError(w http.ResponseWriter, err error) bool {
+	var limitErr *ratelimit.Error
+	switch {
+	case errors.As(err, &limitErr):
+		if seconds := limitErr.RetryAfterSeconds(); seconds > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+		}
+		http.Error(w, limitErr.Error(), http.StatusTooManyRequests)
+	case errors.Is(err, cardinality.ErrLimitExceeded):
+		http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+	case errors.Is(err, cardinality.ErrInvalidName):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	case errors.Is(err, ingest.ErrBufferFull):
+		http.Error(w, err.Error(), http.StatusServiceUnavailable)
+	default:
+		return false
+	}
+	return true
+}
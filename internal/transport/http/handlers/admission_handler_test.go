@@ -0,0 +1,127 @@
+package handlers_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/cardinality"
+	"github.com/andreevym/metric-collector/internal/controller"
+	"github.com/andreevym/metric-collector/internal/ingest"
+	"github.com/andreevym/metric-collector/internal/ratelimit"
+	"github.com/andreevym/metric-collector/internal/storage/mem"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/subnet"
+	"github.com/andreevym/metric-collector/internal/transport/http/handlers"
+	"github.com/andreevym/metric-collector/internal/transport/http/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClientLimits(t *testing.T) {
+	storage := mem.NewStorage(nil)
+	ctrl := controller.NewController(storage, nil).WithLimits(
+		ratelimit.NewLimiter(0.1, 2),
+		ratelimit.NewSeriesQuota(2, time.Hour),
+	)
+	// тестовый клиент подключается через доверенный прокси на loopback адресе
+	proxies, err := subnet.ParsePolicy("", "127.0.0.1,::1")
+	require.NoError(t, err)
+	m := middleware.NewMiddleware("", nil, proxies)
+	router := handlers.NewRouter(handlers.NewServiceHandlersWithController(storage, ctrl), m.IdentityMiddleware)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	post := func(ip string, path string, body string) *http.Response {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+path, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		req.Header.Set("X-Real-IP", ip)
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp
+	}
+
+	resp := post("10.0.0.1", "/updates/", `[{"id":"a","type":"gauge","value":1},{"id":"b","type":"gauge","value":1},{"id":"c","type":"gauge","value":1}]`)
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode, "series quota")
+	require.NotEmpty(t, resp.Header.Get("Retry-After"))
+
+	resp = post("10.0.0.1", "/update/gauge/a/1", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+
+	resp = post("10.0.0.1", "/update/gauge/a/1", "")
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode, "rate limit")
+	require.Equal(t, "10", resp.Header.Get("Retry-After"))
+
+	resp = post("10.0.0.2", "/update/gauge/a/1", "")
+	require.Equal(t, http.StatusOK, resp.StatusCode, "other client isn't limited")
+
+	// без доверенного прокси заголовок X-Real-IP не меняет клиента
+	m.TrustedSubnet = nil
+	for _, ip := range []string{"10.0.0.3", "10.0.0.4"} {
+		resp = post(ip, "/update/gauge/a/1", "")
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+	resp = post("10.0.0.5", "/update/gauge/a/1", "")
+	require.Equal(t, http.StatusTooManyRequests, resp.StatusCode, "spoofed header")
+}
+
+func TestCardinalityLimits(t *testing.T) {
+	storage := mem.NewStorage(nil)
+	ctrl := controller.NewController(storage, nil).WithCardinality(cardinality.NewGuard(cardinality.Limits{
+		MaxNameLength: 16,
+		MaxSeries:     1,
+	}))
+	router := handlers.NewRouter(handlers.NewServiceHandlersWithController(storage, ctrl))
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	post := func(path string, body string) (int, string) {
+		resp, err := ts.Client().Post(ts.URL+path, handlers.UpdatesMetricContentType, bytes.NewBufferString(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(respBody)
+	}
+
+	status, body := post("/updates/", `[{"id":"AVeryLongMetricName","type":"gauge","value":1}]`)
+	require.Equal(t, http.StatusBadRequest, status)
+	require.Contains(t, body, "invalid metric name")
+
+	status, _ = post("/update/gauge/Alloc/1", "")
+	require.Equal(t, http.StatusOK, status)
+
+	status, body = post("/updates/", `[{"id":"Alloc","type":"gauge","value":2},{"id":"HeapAlloc","type":"gauge","value":1}]`)
+	require.Equal(t, http.StatusUnprocessableEntity, status)
+	require.Contains(t, body, "cardinality limit exceeded")
+
+	_, err := storage.Read(context.Background(), "HeapAlloc", store.MTypeGauge)
+	require.ErrorIs(t, err, store.ErrValueNotFound)
+}
+
+func TestIngestBufferFull(t *testing.T) {
+	storage := mem.NewStorage(nil)
+	buffer := ingest.NewBuffer(storage, time.Hour, 0).WithMaxPending(2)
+	ctrl := controller.NewController(storage, nil).WithBuffer(buffer)
+	ts := httptest.NewServer(handlers.NewRouter(handlers.NewServiceHandlersWithController(storage, ctrl)))
+	defer ts.Close()
+
+	post := func(body string) int {
+		resp, err := ts.Client().Post(ts.URL+handlers.PathPostUpdates, "application/json", bytes.NewBufferString(body))
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+
+	require.Equal(t, http.StatusOK, post(`[{"id":"a","type":"gauge","value":1},{"id":"b","type":"gauge","value":1}]`))
+	require.Equal(t, http.StatusServiceUnavailable, post(`[{"id":"c","type":"gauge","value":1}]`))
+	// уже буферизованные метрики не увеличивают количество несохранённых
+	require.Equal(t, http.StatusOK, post(`[{"id":"a","type":"gauge","value":2}]`))
+
+	require.NoError(t, buffer.Flush(context.Background()))
+	require.Equal(t, http.StatusOK, post(`[{"id":"c","type":"gauge","value":1}]`))
+}
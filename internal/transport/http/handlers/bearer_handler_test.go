@@ -0,0 +1,123 @@
+package handlers_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/controller"
+	"github.com/andreevym/metric-collector/internal/oidc"
+	"github.com/andreevym/metric-collector/internal/storage/mem"
+	"github.com/andreevym/metric-collector/internal/tenant"
+	"github.com/andreevym/metric-collector/internal/transport/http/handlers"
+	"github.com/andreevym/metric-collector/internal/transport/http/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+// newTestIssuer writes the JWKS with a new key and returns the function signing tokens with it.
+func newTestIssuer(t *testing.T) (jwksPath string, sign func(claims map[string]any) string) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	encode := func(data []byte) string { return base64.RawURLEncoding.EncodeToString(data) }
+
+	jwks, err := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "EC", "crv": "P-256", "kid": "test",
+		"x": encode(key.X.FillBytes(make([]byte, 32))), "y": encode(key.Y.FillBytes(make([]byte, 32))),
+	}}})
+	require.NoError(t, err)
+	jwksPath = filepath.Join(t.TempDir(), "jwks.json")
+	require.NoError(t, os.WriteFile(jwksPath, jwks, 0o600))
+
+	return jwksPath, func(claims map[string]any) string {
+		header, err := json.Marshal(map[string]string{"alg": "ES256", "kid": "test"})
+		require.NoError(t, err)
+		payload, err := json.Marshal(claims)
+		require.NoError(t, err)
+		signingInput := encode(header) + "." + encode(payload)
+		hashed := sha256.Sum256([]byte(signingInput))
+		r, s, err := ecdsa.Sign(rand.Reader, key, hashed[:])
+		require.NoError(t, err)
+		return signingInput + "." + encode(append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...))
+	}
+}
+
+func TestBearerMiddleware(t *testing.T) {
+	jwksPath, sign := newTestIssuer(t)
+	tenants, err := tenant.ParseKeys("team-a=key-a")
+	require.NoError(t, err)
+	m := middleware.NewMiddleware("", nil, nil)
+	m.Tenants = tenants
+	m.Bearer = oidc.NewVerifier(oidc.Options{JWKS: jwksPath, Audience: "metric-collector"})
+
+	storage := tenant.NewStorage(mem.NewStorage(nil))
+	router := handlers.NewRouter(
+		handlers.NewServiceHandlersWithController(storage, controller.NewController(storage, nil)),
+		m.BearerMiddleware,
+		m.TenantMiddleware,
+		m.IdentityMiddleware,
+	)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	do := func(method, path string, headers map[string]string, body string) (int, string) {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		for k, v := range headers {
+			req.Header.Set(k, v)
+		}
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(respBody)
+	}
+	bearer := func(claims map[string]any) map[string]string {
+		c := map[string]any{
+			"sub": "alice", "aud": "metric-collector", "tenant": "team-a",
+			"exp": time.Now().Add(time.Hour).Unix(),
+		}
+		for k, v := range claims {
+			c[k] = v
+		}
+		return map[string]string{oidc.Header: "Bearer " + sign(c)}
+	}
+
+	status, _ := do(http.MethodPost, "/update/gauge/Alloc/1.5", map[string]string{tenant.Header: "key-a"}, "")
+	require.Equal(t, http.StatusOK, status)
+
+	// токен принимается на чтение наравне с API ключом арендатора
+	status, body := do(http.MethodGet, "/value/gauge/Alloc", bearer(nil), "")
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "1.5", body)
+	status, body = do(http.MethodPost, "/value/", bearer(nil), `{"id":"Alloc","type":"gauge"}`)
+	require.Equal(t, http.StatusOK, status)
+	require.JSONEq(t, `{"id":"Alloc","type":"gauge","value":1.5}`, body)
+
+	// без утверждения с ролями токен даёт только чтение
+	status, _ = do(http.MethodPost, "/update/gauge/Alloc/2", bearer(nil), "")
+	require.Equal(t, http.StatusForbidden, status)
+	status, _ = do(http.MethodPost, "/update/gauge/Alloc/2", bearer(map[string]any{"roles": []string{"ingest"}}), "")
+	require.Equal(t, http.StatusOK, status)
+
+	status, _ = do(http.MethodGet, "/value/gauge/Alloc", bearer(map[string]any{"tenant": "team-b"}), "")
+	require.Equal(t, http.StatusUnauthorized, status)
+	status, _ = do(http.MethodGet, "/value/gauge/Alloc", bearer(map[string]any{"aud": "other"}), "")
+	require.Equal(t, http.StatusUnauthorized, status)
+	status, _ = do(http.MethodGet, "/value/gauge/Alloc", bearer(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()}), "")
+	require.Equal(t, http.StatusUnauthorized, status)
+	status, _ = do(http.MethodGet, "/value/gauge/Alloc", map[string]string{oidc.Header: "Bearer invalid"}, "")
+	require.Equal(t, http.StatusUnauthorized, status)
+}
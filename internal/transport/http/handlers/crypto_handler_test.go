@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andreevym/metric-collector/internal/compressor"
+	"github.com/andreevym/metric-collector/internal/crypto"
+	"github.com/andreevym/metric-collector/internal/storage/mem"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/transport/http/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncryptedUpdates(t *testing.T) {
+	private, public, err := crypto.GenerateCertificate(crypto.CertificateOptions{Bits: 2048})
+	require.NoError(t, err)
+	decrypter, err := crypto.NewDecrypter(private)
+	require.NoError(t, err)
+	encrypter, err := crypto.NewEncrypter(public)
+	require.NoError(t, err)
+
+	memStorage := mem.NewStorage(nil)
+	m := middleware.NewMiddleware("", decrypter, nil)
+	// порядок middleware такой же, как на сервере: расшифровка до распаковки
+	router := NewRouter(
+		NewServiceHandlers(memStorage, nil),
+		m.RequestCryptoMiddleware,
+		m.ResponseGzipMiddleware,
+	)
+	srv := httptest.NewServer(router)
+	defer srv.Close()
+
+	// пачка больше размера блока RSA
+	metrics := make([]*store.Metric, 0, 200)
+	for i := 0; i < 200; i++ {
+		value := float64(i)
+		metrics = append(metrics, &store.Metric{ID: fmt.Sprintf("Metric%d", i), MType: store.MTypeGauge, Value: &value})
+	}
+	body, err := json.Marshal(metrics)
+	require.NoError(t, err)
+	compressed, err := compressor.Compress(body)
+	require.NoError(t, err)
+	envelope, err := encrypter.Encrypt(compressed)
+	require.NoError(t, err)
+	require.Greater(t, len(envelope), 512)
+
+	send := func(b []byte) int {
+		req, err := http.NewRequest(http.MethodPost, srv.URL+"/updates/", bytes.NewReader(b))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", UpdateMetricContentType)
+		req.Header.Set("Content-Encoding", compressor.ContentEncoding)
+		resp, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+
+	require.Equal(t, http.StatusOK, send(envelope))
+	found, err := memStorage.Read(context.Background(), metrics[199].ID, store.MTypeGauge)
+	require.NoError(t, err)
+	require.Equal(t, 199.0, *found.Value)
+
+	require.Equal(t, http.StatusBadRequest, send(compressed))
+}
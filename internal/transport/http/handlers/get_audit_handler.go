@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/audit"
+	"github.com/andreevym/metric-collector/internal/logger"
+	"go.uber.org/zap"
+)
+
+// GetAuditHandler method returns the latest audit events, newest first.
+// @Summary Query audit events
+// @Description Returns the latest writes of metrics and calls of admin endpoints with the client identity
+// and the old and new values of metrics. A tenant sees only events of its own clients.
+// @Produce json
+// @Param since query string false "RFC 3339 time of the oldest event"
+// @Param until query string false "RFC 3339 time the events are older than"
+// @Param action query string false "update, updates or admin"
+// @Param client query string false "client key, e.g. tenant:team-a"
+// @Param metric query string false "ID of the changed metric"
+// @Param limit query int false "maximum number of events, 100 by default"
+// @Success 200 {array} audit.Event "Audit events"
+// @Failure 400 {string} string "Invalid filter"
+// @Failure 500 {string} string "Internal server error"
+// @Router /admin/audit [get]
+func (s ServiceHandlers) GetAuditHandler(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	f := audit.Filter{
+		Action:   query.Get("action"),
+		Client:   query.Get("client"),
+		MetricID: query.Get("metric"),
+	}
+	var err error
+	for name, t := range map[string]*time.Time{"since": &f.Since, "until": &f.Until} {
+		if value := query.Get(name); value != "" {
+			if *t, err = time.Parse(time.RFC3339, value); err != nil {
+				http.Error(w, "invalid "+name+", want RFC 3339 time", http.StatusBadRequest)
+				return
+			}
+		}
+	}
+	if value := query.Get("limit"); value != "" {
+		if f.Limit, err = strconv.Atoi(value); err != nil || f.Limit < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+	}
+
+	events, err := s.controller.AuditEvents(r.Context(), f)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	bytes, err := json.Marshal(events)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ValueMetricContentType)
+	_, err = w.Write(bytes)
+	if err != nil {
+		logger.Logger().Error("audit events can't be written", zap.Error(err))
+	}
+}
+
+// recordAdmin records every call of the admin endpoints to the audit log.
+func (s ServiceHandlers) recordAdmin(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.controller.RecordAdmin(r.Context(), r.Method+" "+r.URL.Path)
+		next.ServeHTTP(w, r)
+	})
+}
@@ -0,0 +1,141 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/audit"
+	"github.com/andreevym/metric-collector/internal/controller"
+	"github.com/andreevym/metric-collector/internal/ingest"
+	"github.com/andreevym/metric-collector/internal/storage/mem"
+	"github.com/andreevym/metric-collector/internal/subnet"
+	"github.com/andreevym/metric-collector/internal/tenant"
+	"github.com/andreevym/metric-collector/internal/transport/http/handlers"
+	"github.com/andreevym/metric-collector/internal/transport/http/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetAuditHandler(t *testing.T) {
+	sink, err := audit.NewFileSink(filepath.Join(t.TempDir(), "audit.log"), 0, 0)
+	require.NoError(t, err)
+	defer sink.Close()
+	tenants, err := tenant.ParseKeys("team-a=key-a,team-b=key-b")
+	require.NoError(t, err)
+	proxies, err := subnet.ParsePolicy("", "127.0.0.1,::1")
+	require.NoError(t, err)
+	m := middleware.NewMiddleware("", nil, proxies)
+	m.Tenants = tenants
+
+	storage := tenant.NewStorage(mem.NewStorage(nil))
+	ctrl := controller.NewController(storage, nil).WithAudit(audit.NewLog(sink))
+	router := handlers.NewRouter(
+		handlers.NewServiceHandlersWithController(storage, ctrl),
+		m.TenantMiddleware,
+		m.IdentityMiddleware,
+	)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	do := func(method, path, apiKey, body string) (int, string) {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set(tenant.Header, apiKey)
+		req.Header.Set("X-Real-IP", "10.0.0.1")
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(respBody)
+	}
+	events := func(apiKey, query string) []audit.Event {
+		status, body := do(http.MethodGet, handlers.PathGetAudit+query, apiKey, "")
+		require.Equal(t, http.StatusOK, status, body)
+		var events []audit.Event
+		require.NoError(t, json.Unmarshal([]byte(body), &events))
+		return events
+	}
+
+	status, _ := do(http.MethodPost, "/update/counter/PollCount/2", "key-a", "")
+	require.Equal(t, http.StatusOK, status)
+	status, _ = do(http.MethodPost, handlers.PathPostUpdates, "key-a",
+		`[{"id":"PollCount","type":"counter","delta":3},{"id":"Alloc","type":"gauge","value":1.5}]`)
+	require.Equal(t, http.StatusOK, status)
+	status, _ = do(http.MethodPost, "/update/gauge/Alloc/1", "key-b", "")
+	require.Equal(t, http.StatusOK, status)
+
+	got := events("key-a", "?action=updates")
+	require.Len(t, got, 1)
+	e := got[0]
+	require.Equal(t, "tenant:team-a", e.Client)
+	require.Equal(t, "10.0.0.1", e.IP)
+	require.Empty(t, e.Error)
+	require.Len(t, e.Changes, 2)
+	require.Equal(t, "PollCount", e.Changes[0].ID)
+	require.Equal(t, int64(2), *e.Changes[0].Old.Delta)
+	require.Equal(t, int64(5), *e.Changes[0].New.Delta)
+	require.Equal(t, "Alloc", e.Changes[1].ID)
+	require.Nil(t, e.Changes[1].Old)
+	require.Equal(t, 1.5, *e.Changes[1].New.Value)
+
+	got = events("key-a", "?metric=PollCount&limit=1")
+	require.Len(t, got, 1)
+	require.Equal(t, audit.ActionUpdates, got[0].Action)
+
+	// арендатор видит только свои события, вызовы административных маршрутов тоже записываются
+	got = events("key-b", "")
+	require.Len(t, got, 2)
+	require.Equal(t, audit.ActionAdmin, got[0].Action)
+	require.Equal(t, "GET "+handlers.PathGetAudit, got[0].Target)
+	require.Equal(t, audit.ActionUpdate, got[1].Action)
+	require.Equal(t, "Alloc", got[1].Changes[0].ID)
+
+	status, _ = do(http.MethodGet, handlers.PathGetAudit+"?since=yesterday", "key-a", "")
+	require.Equal(t, http.StatusBadRequest, status)
+}
+
+func TestGetAuditHandler_Buffered(t *testing.T) {
+	sink, err := audit.NewFileSink(filepath.Join(t.TempDir(), "audit.log"), 0, 0)
+	require.NoError(t, err)
+	defer sink.Close()
+
+	storage := mem.NewStorage(nil)
+	buffer := ingest.NewBuffer(storage, time.Hour, 0)
+	ctrl := controller.NewController(storage, nil).WithBuffer(buffer).WithAudit(audit.NewLog(sink))
+	ts := httptest.NewServer(handlers.NewRouter(handlers.NewServiceHandlersWithController(storage, ctrl)))
+	defer ts.Close()
+
+	post := func(body string) {
+		resp, err := ts.Client().Post(ts.URL+handlers.PathPostUpdates, "application/json", strings.NewReader(body))
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		require.Equal(t, http.StatusOK, resp.StatusCode)
+	}
+
+	post(`[{"id":"PollCount","type":"counter","delta":2}]`)
+	require.NoError(t, buffer.Flush(context.Background()))
+	post(`[{"id":"PollCount","type":"counter","delta":3},{"id":"Alloc","type":"gauge","value":1.5}]`)
+	// вторая запись ещё в буфере, поэтому старое значение учитывает и её
+	post(`[{"id":"PollCount","type":"counter","delta":4},{"id":"Alloc","type":"gauge","value":2.5}]`)
+
+	events, err := sink.Query(context.Background(), audit.Filter{Action: audit.ActionUpdates})
+	require.NoError(t, err)
+	require.Len(t, events, 3)
+	e := events[0]
+	require.Equal(t, int64(5), *e.Changes[0].Old.Delta)
+	require.Equal(t, int64(9), *e.Changes[0].New.Delta)
+	require.Equal(t, 1.5, *e.Changes[1].Old.Value)
+	require.Equal(t, 2.5, *e.Changes[1].New.Value)
+
+	e = events[1]
+	require.Equal(t, int64(2), *e.Changes[0].Old.Delta)
+	require.Equal(t, int64(5), *e.Changes[0].New.Delta)
+	require.Nil(t, e.Changes[1].Old)
+}
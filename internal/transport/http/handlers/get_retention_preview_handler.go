@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/andreevym/metric-collector/internal/logger"
+	"go.uber.org/zap"
+)
+
+// GetRetentionPreviewHandler method returns metrics that would be deleted by the next retention sweep.
+// @Summary Preview expired metrics
+// @Description Returns metrics that haven't been updated within their retention and will be deleted by the janitor,
+// ordered by the expiration time. Nothing is deleted by this request.
+// @Produce json
+// @Success 200 {array} retention.Expired "Expired metrics"
+// @Failure 500 {string} string "Internal server error"
+// @Router /admin/retention/preview [get]
+func (s ServiceHandlers) GetRetentionPreviewHandler(w http.ResponseWriter, r *http.Request) {
+	expired, err := s.controller.RetentionPreview(r.Context())
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	bytes, err := json.Marshal(expired)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", ValueMetricContentType)
+	_, err = w.Write(bytes)
+	if err != nil {
+		logger.Logger().Error("expired metrics can't be written", zap.Error(err))
+	}
+}
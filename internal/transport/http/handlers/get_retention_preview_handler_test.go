@@ -0,0 +1,61 @@
+package handlers_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/andreevym/metric-collector/internal/controller"
+	"github.com/andreevym/metric-collector/internal/retention"
+	"github.com/andreevym/metric-collector/internal/storage/mem"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/transport/http/handlers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGetRetentionPreviewHandler(t *testing.T) {
+	memStorage := mem.NewStorage(nil)
+	value := 1.0
+	for _, id := range []string{"cpu_1", "Alloc"} {
+		err := memStorage.Create(context.Background(), &store.Metric{ID: id, MType: store.MTypeGauge, Value: &value})
+		require.NoError(t, err)
+	}
+	time.Sleep(time.Millisecond)
+
+	janitor := retention.NewJanitor(memStorage, retention.Policy{
+		Rules: []retention.Rule{{Pattern: "cpu_*", TTL: time.Nanosecond}},
+	}, 0)
+	ctrl := controller.NewController(memStorage, nil).WithJanitor(janitor)
+	router := handlers.NewRouter(handlers.NewServiceHandlersWithController(memStorage, ctrl))
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	statusCode, contentType, get := testRequest(t, ts, http.MethodGet, handlers.PathGetRetentionPreview, nil)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.Equal(t, handlers.ValueMetricContentType, contentType)
+
+	var expired []retention.Expired
+	require.NoError(t, json.Unmarshal([]byte(get), &expired))
+	require.Len(t, expired, 1)
+	assert.Equal(t, "cpu_1", expired[0].ID)
+	assert.Equal(t, store.MTypeGauge, expired[0].MType)
+
+	// предпросмотр не удаляет метрики
+	_, err := memStorage.Read(context.Background(), "cpu_1", store.MTypeGauge)
+	require.NoError(t, err)
+}
+
+func TestGetRetentionPreviewHandler_Disabled(t *testing.T) {
+	memStorage := mem.NewStorage(nil)
+	router := handlers.NewRouter(handlers.NewServiceHandlers(memStorage, nil))
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	statusCode, _, get := testRequest(t, ts, http.MethodGet, handlers.PathGetRetentionPreview, nil)
+	assert.Equal(t, http.StatusOK, statusCode)
+	assert.JSONEq(t, "[]", get)
+}
@@ -2,6 +2,7 @@ package handlers
 
 import (
 	"github.com/andreevym/metric-collector/internal/controller"
+	"github.com/andreevym/metric-collector/internal/rbac"
 	"github.com/andreevym/metric-collector/internal/storage/store"
 )
 
@@ -9,6 +10,8 @@ type ServiceHandlers struct {
 	storage    store.Storage
 	dbClient   store.Client
 	controller controller.Controller
+	// rbac роли клиентов, nil — доступ к маршрутам не ограничивается
+	rbac *rbac.Policy
 }
 
 // NewServiceHandlers creates a new instance of ServiceHandlers with the provided dependencies.
@@ -20,3 +23,11 @@ func NewServiceHandlers(storage store.Storage, dbClient store.Client) *ServiceHa
 		controller: controller,
 	}
 }
+
+// NewServiceHandlersWithController creates a new instance of ServiceHandlers using the prepared controller.
+func NewServiceHandlersWithController(storage store.Storage, controller controller.Controller) *ServiceHandlers {
+	return &ServiceHandlers{
+		storage:    storage,
+		controller: controller,
+	}
+}
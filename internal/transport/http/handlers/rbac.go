@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/rbac"
+	"go.uber.org/zap"
+)
+
+// WithRBAC restricts every route of the router to clients with the route role,
+// the client identity must be attached to the request context by IdentityMiddleware.
+func (s *ServiceHandlers) WithRBAC(policy *rbac.Policy) *ServiceHandlers {
+	s.rbac = policy
+	return s
+}
+
+// authorize returns the middleware that passes only requests of clients with the role,
+// requests with a bearer token are checked even without a policy.
+func (s *ServiceHandlers) authorize(role rbac.Role) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := s.rbac.Authorize(r.Context(), role); err != nil {
+				logger.Logger().Warn("request is forbidden", zap.String("path", r.URL.Path), zap.Error(err))
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,89 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/andreevym/metric-collector/internal/rbac"
+	"github.com/andreevym/metric-collector/internal/storage/mem"
+	"github.com/andreevym/metric-collector/internal/tenant"
+	"github.com/andreevym/metric-collector/internal/transport/http/handlers"
+	"github.com/andreevym/metric-collector/internal/transport/http/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRBAC(t *testing.T) {
+	tenants, err := tenant.ParseKeys("agents=key-agents,dashboards=key-dashboards,ops=key-ops")
+	require.NoError(t, err)
+	policy, err := rbac.ParseBindings("tenant:agents=ingest,tenant:dashboards=read,tenant:ops=admin")
+	require.NoError(t, err)
+	m := middleware.NewMiddleware("", nil, nil)
+	m.Tenants = tenants
+
+	storage := mem.NewStorage(nil)
+	router := handlers.NewRouter(
+		handlers.NewServiceHandlers(storage, nil).WithRBAC(policy),
+		m.TenantMiddleware,
+		m.IdentityMiddleware,
+	)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	do := func(method, path, apiKey string, body string) int {
+		req, err := http.NewRequest(method, ts.URL+path, strings.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set(tenant.Header, apiKey)
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+
+	tests := []struct {
+		name    string
+		method  string
+		path    string
+		body    string
+		allowed map[string]bool
+	}{
+		{
+			name: "ping", method: http.MethodGet, path: handlers.PathGetPing,
+			allowed: map[string]bool{"key-agents": true, "key-dashboards": true},
+		},
+		{
+			name: "update", method: http.MethodPost, path: "/update/gauge/Alloc/1",
+			allowed: map[string]bool{"key-agents": true, "key-dashboards": false, "key-ops": true},
+		},
+		{
+			name: "updates", method: http.MethodPost, path: handlers.PathPostUpdates,
+			body:    `[{"id":"Alloc","type":"gauge","value":2}]`,
+			allowed: map[string]bool{"key-agents": true, "key-dashboards": false},
+		},
+		{
+			name: "value", method: http.MethodGet, path: "/value/gauge/Alloc",
+			allowed: map[string]bool{"key-agents": false, "key-dashboards": true, "key-ops": true},
+		},
+		{
+			name: "retention preview", method: http.MethodGet, path: handlers.PathGetRetentionPreview,
+			allowed: map[string]bool{"key-dashboards": false, "key-ops": true},
+		},
+		{
+			name: "pprof", method: http.MethodGet, path: "/debug/pprof/",
+			allowed: map[string]bool{"key-agents": false, "key-dashboards": false, "key-ops": true},
+		},
+		{
+			name: "swagger", method: http.MethodGet, path: "/swagger/doc.json",
+			allowed: map[string]bool{"key-dashboards": false, "key-ops": true},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			// ping без БД и swagger без документации отвечают ошибкой, проверяется только отказ в доступе
+			for key, allowed := range tt.allowed {
+				require.Equal(t, allowed, do(tt.method, tt.path, key, tt.body) != http.StatusForbidden, key)
+			}
+		})
+	}
+}
@@ -3,6 +3,7 @@ package handlers
 import (
 	"net/http"
 
+	"github.com/andreevym/metric-collector/internal/rbac"
 	"github.com/go-chi/chi/v5"
 	chimiddleware "github.com/go-chi/chi/v5/middleware"
 	httpSwagger "github.com/swaggo/http-swagger"
@@ -14,6 +15,9 @@ const (
 	PathPostUpdates = "/updates/"
 	PathValue       = "/value"
 	PathGetRoot     = "/"
+
+	PathGetRetentionPreview = "/admin/retention/preview"
+	PathGetAudit            = "/admin/audit"
 )
 
 func NewRouter(s *ServiceHandlers, middlewares ...func(http.Handler) http.Handler) *chi.Mux {
@@ -21,28 +25,41 @@ func NewRouter(s *ServiceHandlers, middlewares ...func(http.Handler) http.Handle
 
 	r.Use(middlewares...)
 
+	// ping используется для проверки доступности сервера и не требует роли
 	r.Get(PathGetPing, s.GetPingHandler)
 
-	r.Post(PathPostUpdates, s.PostUpdatesHandler)
+	r.Group(func(r chi.Router) {
+		r.Use(s.authorize(rbac.RoleIngest))
+		r.Post(PathPostUpdates, s.PostUpdatesHandler)
 
-	r.Post(PathPostUpdate, s.PostUpdateHandler)
-	r.Post(PathPostUpdate+"/", s.PostUpdateHandler)
-	r.Post(PathPostUpdate+"/{metricType}/{metricName}/{metricValue}", s.PostUpdateHandler)
+		r.Post(PathPostUpdate, s.PostUpdateHandler)
+		r.Post(PathPostUpdate+"/", s.PostUpdateHandler)
+		r.Post(PathPostUpdate+"/{metricType}/{metricName}/{metricValue}", s.PostUpdateHandler)
+	})
 
-	r.Post(PathValue, s.PostValueHandler)
-	r.Post(PathValue+"/", s.PostValueHandler)
-	r.Get(PathValue+"/{metricType}/{metricName}", s.GetValueHandler)
+	r.Group(func(r chi.Router) {
+		r.Use(s.authorize(rbac.RoleRead))
+		r.Post(PathValue, s.PostValueHandler)
+		r.Post(PathValue+"/", s.PostValueHandler)
+		r.Get(PathValue+"/{metricType}/{metricName}", s.GetValueHandler)
 
-	r.Get(PathGetRoot, func(writer http.ResponseWriter, request *http.Request) {
-		writer.Header().Set("Content-Type", "text/html")
+		r.Get(PathGetRoot, func(writer http.ResponseWriter, request *http.Request) {
+			writer.Header().Set("Content-Type", "text/html")
+		})
 	})
 
-	// Serve Swagger UI
-	r.Get("/swagger/*", httpSwagger.Handler(
-		httpSwagger.URL("/swagger/doc.json"), //The url pointing to API definition
-	))
+	r.Group(func(r chi.Router) {
+		r.Use(s.authorize(rbac.RoleAdmin), s.recordAdmin)
+		r.Get(PathGetRetentionPreview, s.GetRetentionPreviewHandler)
+		r.Get(PathGetAudit, s.GetAuditHandler)
 
-	r.Mount("/debug", chimiddleware.Profiler())
+		// Serve Swagger UI
+		r.Get("/swagger/*", httpSwagger.Handler(
+			httpSwagger.URL("/swagger/doc.json"), //The url pointing to API definition
+		))
+
+		r.Mount("/debug", chimiddleware.Profiler())
+	})
 
 	return r
 }
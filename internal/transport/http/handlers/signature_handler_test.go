@@ -0,0 +1,112 @@
+package handlers_test
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andreevym/metric-collector/internal/hash"
+	"github.com/andreevym/metric-collector/internal/storage/mem"
+	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/transport/http/handlers"
+	"github.com/andreevym/metric-collector/internal/transport/http/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSignedRequests(t *testing.T) {
+	m := middleware.NewMiddleware("new-key", nil, nil)
+	m.Verifier = hash.NewVerifier(hash.ParseSecrets("new-key", "old-key"), hash.DefaultMaxSkew)
+	router := handlers.NewRouter(handlers.NewServiceHandlers(mem.NewStorage(nil), nil), m.RequestHashMiddleware)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	value := 1.5
+	body, err := json.Marshal([]store.Metric{{ID: "Alloc", MType: store.MTypeGauge, Value: &value}})
+	require.NoError(t, err)
+	newRequest := func(secret string) *http.Request {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+"/updates/", bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", handlers.UpdateMetricContentType)
+		if secret != "" {
+			require.NoError(t, hash.SignHTTPRequest(req, body, secret))
+		}
+		return req
+	}
+	send := func(req *http.Request) int {
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp.StatusCode
+	}
+
+	signed := newRequest("new-key")
+	replayed := signed.Clone(signed.Context())
+	replayed.Body = io.NopCloser(bytes.NewReader(body))
+	require.Equal(t, http.StatusOK, send(signed))
+
+	// повторная отправка перехваченного запроса отклоняется
+	require.Equal(t, http.StatusUnauthorized, send(replayed))
+
+	// запрос, подписанный предыдущим ключом, принимается
+	require.Equal(t, http.StatusOK, send(newRequest("old-key")))
+	require.Equal(t, http.StatusUnauthorized, send(newRequest("unknown-key")))
+
+	// подпись не подходит к изменённому телу
+	tampered := newRequest("new-key")
+	tampered.Body = http.NoBody
+	tampered.ContentLength = 0
+	require.Equal(t, http.StatusUnauthorized, send(tampered))
+
+	require.Equal(t, http.StatusOK, send(newRequest("")))
+	m.RequireSignature = true
+	require.Equal(t, http.StatusUnauthorized, send(newRequest("")))
+}
+
+func TestSignedResponses(t *testing.T) {
+	m := middleware.NewMiddleware("new-key", nil, nil)
+	m.Verifier = hash.NewVerifier(hash.ParseSecrets("new-key", "old-key"), hash.DefaultMaxSkew)
+	router := handlers.NewRouter(
+		handlers.NewServiceHandlers(mem.NewStorage(nil), nil),
+		m.RequestHashMiddleware,
+		m.ResponseHashMiddleware,
+	)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	send := func(path string, body []byte, secret string) (*http.Response, []byte) {
+		req, err := http.NewRequest(http.MethodPost, ts.URL+path, bytes.NewReader(body))
+		require.NoError(t, err)
+		req.Header.Set("Content-Type", handlers.UpdateMetricContentType)
+		if secret != "" {
+			require.NoError(t, hash.SignHTTPRequest(req, body, secret))
+		}
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		respBody, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		require.NoError(t, resp.Body.Close())
+		return resp, respBody
+	}
+
+	value := 1.5
+	body, err := json.Marshal(store.Metric{ID: "Alloc", MType: store.MTypeGauge, Value: &value})
+	require.NoError(t, err)
+
+	resp, respBody := send("/update/", body, "")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.JSONEq(t, string(body), string(respBody))
+	require.True(t, hash.Equal(respBody, "new-key", resp.Header.Get(middleware.HashHeaderKey)))
+
+	// ответ подписывается ключом, которым подписан запрос
+	resp, respBody = send("/update/", body, "old-key")
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	require.True(t, hash.Equal(respBody, "old-key", resp.Header.Get(middleware.HashHeaderKey)))
+
+	// ошибки тоже подписываются, статус сохраняется
+	resp, respBody = send("/value/", []byte(`{"id":"missing","type":"gauge"}`), "new-key")
+	require.Equal(t, http.StatusNotFound, resp.StatusCode)
+	require.True(t, hash.Equal(respBody, "new-key", resp.Header.Get(middleware.HashHeaderKey)))
+}
@@ -0,0 +1,60 @@
+package handlers_test
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andreevym/metric-collector/internal/controller"
+	"github.com/andreevym/metric-collector/internal/storage/mem"
+	"github.com/andreevym/metric-collector/internal/tenant"
+	"github.com/andreevym/metric-collector/internal/transport/http/handlers"
+	"github.com/andreevym/metric-collector/internal/transport/http/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTenantMiddleware(t *testing.T) {
+	tenants, err := tenant.ParseKeys("team-a=key-a,team-b=key-b")
+	require.NoError(t, err)
+	m := middleware.NewMiddleware("", nil, nil)
+	m.Tenants = tenants
+
+	storage := tenant.NewStorage(mem.NewStorage(nil))
+	ctrl := controller.NewController(storage, nil)
+	router := handlers.NewRouter(handlers.NewServiceHandlersWithController(storage, ctrl), m.TenantMiddleware)
+	ts := httptest.NewServer(router)
+	defer ts.Close()
+
+	do := func(method, path, apiKey string, body []byte) (int, string) {
+		req, err := http.NewRequest(method, ts.URL+path, bytes.NewReader(body))
+		require.NoError(t, err)
+		if apiKey != "" {
+			req.Header.Set(tenant.Header, apiKey)
+		}
+		resp, err := ts.Client().Do(req)
+		require.NoError(t, err)
+		defer resp.Body.Close()
+		respBody, err := io.ReadAll(resp.Body)
+		require.NoError(t, err)
+		return resp.StatusCode, string(respBody)
+	}
+
+	status, _ := do(http.MethodPost, "/update/gauge/HeapAlloc/1", "", nil)
+	require.Equal(t, http.StatusUnauthorized, status)
+	status, _ = do(http.MethodPost, "/update/gauge/HeapAlloc/1", "unknown", nil)
+	require.Equal(t, http.StatusUnauthorized, status)
+
+	status, _ = do(http.MethodPost, "/update/gauge/HeapAlloc/1", "key-a", nil)
+	require.Equal(t, http.StatusOK, status)
+	status, _ = do(http.MethodPost, "/updates/", "key-b", []byte(`[{"id":"HeapAlloc","type":"gauge","value":2}]`))
+	require.Equal(t, http.StatusOK, status)
+
+	status, body := do(http.MethodGet, "/value/gauge/HeapAlloc", "key-a", nil)
+	require.Equal(t, http.StatusOK, status)
+	require.Equal(t, "1", body)
+	status, body = do(http.MethodPost, "/value/", "key-b", []byte(`{"id":"HeapAlloc","type":"gauge"}`))
+	require.Equal(t, http.StatusOK, status)
+	require.JSONEq(t, `{"id":"HeapAlloc","type":"gauge","value":2}`, body)
+}
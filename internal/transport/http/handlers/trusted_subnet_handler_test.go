@@ -0,0 +1,54 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/andreevym/metric-collector/internal/controller"
+	"github.com/andreevym/metric-collector/internal/identity"
+	"github.com/andreevym/metric-collector/internal/storage/mem"
+	"github.com/andreevym/metric-collector/internal/subnet"
+	"github.com/andreevym/metric-collector/internal/transport/http/handlers"
+	"github.com/andreevym/metric-collector/internal/transport/http/middleware"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrustedSubnetMiddleware(t *testing.T) {
+	policy, err := subnet.ParsePolicy("192.168.1.0/24,fd00::/8", "10.0.0.5")
+	require.NoError(t, err)
+	m := middleware.NewMiddleware("", nil, policy)
+
+	storage := mem.NewStorage(nil)
+	router := handlers.NewRouter(
+		handlers.NewServiceHandlersWithController(storage, controller.NewController(storage, nil)),
+		m.TrustedSubnetMiddleware,
+	)
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		realIP     string
+		want       int
+	}{
+		{name: "trusted ipv4", remoteAddr: "192.168.1.10:5000", want: http.StatusOK},
+		{name: "trusted ipv6", remoteAddr: "[fd00::1]:5000", want: http.StatusOK},
+		{name: "untrusted", remoteAddr: "10.0.0.1:5000", want: http.StatusForbidden},
+		{name: "untrusted without header", remoteAddr: "", want: http.StatusForbidden},
+		{name: "spoofed header", remoteAddr: "10.0.0.1:5000", realIP: "192.168.1.10", want: http.StatusForbidden},
+		{name: "trusted proxy", remoteAddr: "10.0.0.5:5000", realIP: "192.168.1.10", want: http.StatusOK},
+		{name: "proxy without header", remoteAddr: "10.0.0.5:5000", want: http.StatusForbidden},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/update/gauge/Alloc/1.5", nil)
+			req.RemoteAddr = tt.remoteAddr
+			if tt.realIP != "" {
+				req.Header.Set(identity.RealIPHeader, tt.realIP)
+			}
+			w := httptest.NewRecorder()
+			router.ServeHTTP(w, req)
+			require.Equal(t, tt.want, w.Code, w.Body.String())
+		})
+	}
+}
@@ -32,6 +32,8 @@ const (
 // @Produce json
 // @Success 200 {object} store.Metric "Metric value inserted or updated successfully"
 // @Failure 400 {string} string "Bad request. Invalid metric parameters or JSON payload"
+// @Failure 422 {string} string "New series exceed the cardinality limits"
+// @Failure 429 {string} string "Client exceeded the request rate or the series quota, see Retry-After"
 // @Router /update/{metricType}/{metricName}/{metricValue} [post]
 func (s ServiceHandlers) PostUpdateHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", UpdateMetricContentType)
@@ -43,6 +45,9 @@ func (s ServiceHandlers) PostUpdateHandler(w http.ResponseWriter, r *http.Reques
 	}
 
 	respMetric, err := s.controller.Update(r.Context(), metric)
+	if writeAdmissionError(w, err) {
+		return
+	}
 	if err != nil {
 		w.WriteHeader(http.StatusBadRequest)
 		return
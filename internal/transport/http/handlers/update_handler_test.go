@@ -15,7 +15,6 @@ import (
 	"github.com/andreevym/metric-collector/internal/storage/mem"
 	"github.com/andreevym/metric-collector/internal/storage/store"
 	"github.com/andreevym/metric-collector/internal/transport/http/handlers"
-	"github.com/andreevym/metric-collector/internal/transport/http/middleware"
 	"github.com/go-chi/chi/v5"
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -145,17 +144,11 @@ func signedTestRequest(
 	reqBody []byte,
 	secretKey string,
 ) (int, string, string) {
-	headerMap := make(map[string]string)
-	if secretKey != "" && len(reqBody) > 0 {
-		encodeHash := hash.EncodeHash(reqBody, secretKey)
-		headerMap[middleware.HashHeaderKey] = encodeHash
-	}
-
 	req, err := http.NewRequest(method, ts.URL+path, bytes.NewBuffer(reqBody))
 	require.NoError(t, err)
 
-	for k, v := range headerMap {
-		req.Header.Add(k, v)
+	if secretKey != "" && len(reqBody) > 0 {
+		require.NoError(t, hash.SignHTTPRequest(req, reqBody, secretKey))
 	}
 
 	resp, err := ts.Client().Do(req)
@@ -26,6 +26,8 @@ const (
 // @Param metrics body []store.Metric true "Array of metrics to insert or update"
 // @Success 200 {string} string "Metrics inserted or updated successfully"
 // @Failure 400 {string} string "Bad request. Invalid JSON payload or metric parameters"
+// @Failure 422 {string} string "New series exceed the cardinality limits"
+// @Failure 429 {string} string "Client exceeded the request rate or the series quota, see Retry-After"
 // @Router /updates [post]
 func (s ServiceHandlers) PostUpdatesHandler(w http.ResponseWriter, r *http.Request) {
 	w.Header().Set("Content-Type", UpdatesMetricContentType)
@@ -46,6 +48,9 @@ func (s ServiceHandlers) PostUpdatesHandler(w http.ResponseWriter, r *http.Reque
 	}
 
 	err = s.controller.Updates(r.Context(), metrics)
+	if writeAdmissionError(w, err) {
+		return
+	}
 	if err != nil {
 		logger.Logger().Error("failed to save all metric", zap.Error(err))
 		w.WriteHeader(http.StatusBadRequest)
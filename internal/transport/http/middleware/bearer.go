@@ -0,0 +1,34 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/oidc"
+	"go.uber.org/zap"
+)
+
+// BearerMiddleware verifies the bearer token of the Authorization header and puts its claims
+// into the request context. Requests without a token pass unchanged and are authenticated by other schemes,
+// requests with an invalid token are rejected with 401.
+func (m *Middleware) BearerMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token, ok := oidc.BearerToken(r.Header.Get(oidc.Header))
+		if !ok {
+			h.ServeHTTP(w, r)
+			return
+		}
+		claims, err := m.Bearer.Verify(r.Context(), token)
+		if err != nil {
+			logger.Logger().Warn("request with invalid bearer token",
+				zap.String("method", r.Method),
+				zap.String("uri", r.RequestURI),
+				zap.Error(err),
+			)
+			w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+			http.Error(w, "invalid bearer token", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(oidc.WithClaims(r.Context(), claims)))
+	})
+}
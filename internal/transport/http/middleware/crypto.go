@@ -5,12 +5,15 @@ import (
 	"io"
 	"net/http"
 
-	"github.com/andreevym/metric-collector/internal/crypto"
+	"github.com/andreevym/metric-collector/internal/logger"
+	"go.uber.org/zap"
 )
 
+// RequestCryptoMiddleware decrypts the request body encrypted by the agent with crypto.Encrypter,
+// the body is decrypted before it is decompressed, since the agent compresses the payload before encryption.
 func (m *Middleware) RequestCryptoMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if m.CryptoKey == "" {
+		if m.Decrypter == nil {
 			next.ServeHTTP(w, r)
 			return
 		}
@@ -19,12 +22,13 @@ func (m *Middleware) RequestCryptoMiddleware(next http.Handler) http.Handler {
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		decode, err := crypto.Decode(m.CryptoKey, string(readAll))
+		decrypted, err := m.Decrypter.Decrypt(readAll)
 		if err != nil {
+			logger.Logger().Error("failed to decrypt request body", zap.Error(err))
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
-		r.Body = io.NopCloser(bytes.NewReader([]byte(decode)))
+		r.Body = io.NopCloser(bytes.NewReader(decrypted))
 		next.ServeHTTP(w, r)
 	})
 }
@@ -1,109 +1,154 @@
 package middleware
 
 import (
+	"bytes"
+	"context"
+	"errors"
 	"io"
 	"net/http"
+	"strconv"
 
 	"github.com/andreevym/metric-collector/internal/hash"
 	"github.com/andreevym/metric-collector/internal/logger"
 	"go.uber.org/zap"
 )
 
-const HashHeaderKey = "HashSHA256"
+// HashHeaderKey header with the HMAC-SHA256 signature of the request or response.
+const HashHeaderKey = hash.Header
 
-// RequestHashMiddleware returns an HTTP middleware that verifies the hash of the request body
-// sent by the client against the calculated hash on the server side, if the client provides a hash.
-// If the provided hash does not match the calculated hash, the middleware returns a Bad Request status code.
-// The calculated hash is based on the secret key provided in the middleware.
-// If no hash is provided by the client or if the hash verification fails, the middleware proceeds to the next handler.
+// RequestHashMiddleware returns an HTTP middleware that verifies the HMAC-SHA256 signature of the request
+// sent by the client. The signature covers the method, the path, the timestamp, the nonce and the raw body,
+// see hash.Request, and is checked against every active secret of the Verifier.
+// Requests signed outside of the allowed clock skew and requests with an already used nonce are rejected,
+// so a captured request cannot be sent again.
+// Unsigned requests are passed to the next handler unless RequireSignature is set.
 //
 // Parameters:
 //   - h: The HTTP handler to be wrapped by the middleware.
 //
 // Returns:
-//   - http.Handler: An HTTP handler that verifies the hash of the request body against the calculated hash.
+//   - http.Handler: An HTTP handler that verifies the signature of the request.
 //
 // Example:
 //
 //	// Create a new middleware instance
-//	middleware := NewMiddleware("my-secret-key")
+//	middleware := NewMiddleware("my-secret-key", nil, nil)
 //
 //	// Wrap an existing HTTP handler with the RequestHashMiddleware
 //	wrappedHandler := middleware.RequestHashMiddleware(myHandler)
 func (m *Middleware) RequestHashMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		// Extract the hash of the request body sent by the client from the request headers
-		agentRequestBodyHash := r.Header.Get(HashHeaderKey)
-		if agentRequestBodyHash != "" {
-			// Read the entire request body
-			bytes, err := io.ReadAll(r.Body)
-			if err != nil {
-				// If an error occurs while reading the request body, set a Bad Request status code
-				// and log the error
-				w.WriteHeader(http.StatusBadRequest)
-				logger.Logger().Error(
-					"could not read request body when agent hash sha 256 is defined",
-					zap.String("agentRequestBodyHash", agentRequestBodyHash),
-					zap.Error(err),
-				)
+		// Extract the signature of the request sent by the client from the request headers
+		signature := r.Header.Get(HashHeaderKey)
+		if signature == "" || m.Verifier == nil {
+			if m.RequireSignature && m.Verifier != nil {
+				http.Error(w, hash.ErrMissingSignature.Error(), http.StatusUnauthorized)
 				return
 			}
+			h.ServeHTTP(w, r)
+			return
+		}
 
-			// Calculate the hash of the request body using the specified secret key
-			serverRequestBodyHash := hash.EncodeHash(bytes, m.SecretKey)
+		// Read the entire request body, it is restored for the next handlers
+		body, err := io.ReadAll(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			logger.Logger().Error("could not read request body when signature is defined", zap.Error(err))
+			return
+		}
+		r.Body = io.NopCloser(bytes.NewReader(body))
 
-			// Compare the hash provided by the client with the calculated hash on the transport side
-			if serverRequestBodyHash != agentRequestBodyHash {
-				// If the hashes do not match, set a Bad Request status code
-				// and log the error
-				w.WriteHeader(http.StatusBadRequest)
-				logger.Logger().Error(
-					"serverRequestBodyHash is not equal to agentRequestBodyHash",
-					zap.String("agentRequestBodyHash", agentRequestBodyHash),
-					zap.String("serverRequestBodyHash", serverRequestBodyHash),
-				)
-				return
+		timestamp, _ := strconv.ParseInt(r.Header.Get(hash.TimestampHeader), 10, 64)
+		signed := hash.Request{
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			Timestamp: timestamp,
+			Nonce:     r.Header.Get(hash.NonceHeader),
+			Body:      body,
+		}
+		secret, err := m.Verifier.Verify(signed, signature)
+		if err != nil {
+			logger.Logger().Error("request signature is rejected",
+				zap.String("path", r.URL.Path),
+				zap.Int64("timestamp", timestamp),
+				zap.Error(err),
+			)
+			code := http.StatusUnauthorized
+			if errors.Is(err, hash.ErrTooManyNonces) {
+				// подпись верна, агент повторит запрос, когда в кеше nonce освободится место
+				code = http.StatusServiceUnavailable
 			}
+			http.Error(w, err.Error(), code)
+			return
 		}
 
-		// Proceed to the next HTTP handler in the chain
-		h.ServeHTTP(w, r)
+		// Proceed to the next HTTP handler in the chain, the response is signed with the same secret
+		h.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), secretContextKey{}, secret)))
 	})
 }
 
-// ResponseHashMiddleware returns an HTTP middleware that calculates a hash of the response body
-// and includes it in the response headers if a secret key is provided.
-// The calculated hash is encoded using the specified secret key.
+// secretContextKey context key of the secret that verified the request signature.
+type secretContextKey struct{}
+
+// ResponseHashMiddleware returns an HTTP middleware that signs the response body with HMAC-SHA256
+// and sends the signature in the HashSHA256 response header.
+// The response is buffered until the handler returns, since the header must be written before the body.
+// The response is signed with the secret that verified the request signature, or with SecretKey
+// for unsigned requests, so agents that still use the previous secret during rotation can verify it.
 // If the secret key is empty, the middleware does not modify the response.
 //
 // Parameters:
 //   - h: The HTTP handler to be wrapped by the middleware.
 //
 // Returns:
-//   - http.Handler: An HTTP handler that includes the calculated hash in the response headers.
+//   - http.Handler: An HTTP handler that includes the signature of the response body in the response headers.
 //
 // Example:
 //
 //	// Create a new middleware instance
-//	middleware := NewMiddleware("my-secret-key")
+//	middleware := NewMiddleware("my-secret-key", nil, nil)
 //
 //	// Wrap an existing HTTP handler with the ResponseHashMiddleware
 //	wrappedHandler := middleware.ResponseHashMiddleware(myHandler)
 func (m *Middleware) ResponseHashMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		h.ServeHTTP(w, r)
-		if m.SecretKey != "" {
-			b, err := io.ReadAll(r.Body)
-			if err != nil {
-				w.WriteHeader(http.StatusBadRequest)
-				logger.Logger().Error(
-					"failed to read response",
-					zap.Error(err),
-				)
-				return
-			}
-			encodedResponseBodyHash := hash.EncodeHash(b, m.SecretKey)
-			w.Header().Set(HashHeaderKey, encodedResponseBodyHash)
+		if m.SecretKey == "" {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		sw := &signingResponseWriter{ResponseWriter: w, status: http.StatusOK}
+		h.ServeHTTP(sw, r)
+
+		secret := m.SecretKey
+		if requestSecret, ok := r.Context().Value(secretContextKey{}).(string); ok && requestSecret != "" {
+			secret = requestSecret
+		}
+		w.Header().Set(HashHeaderKey, hash.Sum(sw.body.Bytes(), secret))
+		w.WriteHeader(sw.status)
+		if _, err := w.Write(sw.body.Bytes()); err != nil {
+			logger.Logger().Error("failed to write response", zap.Error(err))
 		}
 	})
 }
+
+// signingResponseWriter buffers the status and the body of the response until it is signed.
+type signingResponseWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+	body        bytes.Buffer
+}
+
+func (w *signingResponseWriter) WriteHeader(statusCode int) {
+	if w.wroteHeader {
+		return
+	}
+	w.status = statusCode
+	w.wroteHeader = true
+}
+
+func (w *signingResponseWriter) Write(b []byte) (int, error) {
+	w.wroteHeader = true
+	return w.body.Write(b)
+}
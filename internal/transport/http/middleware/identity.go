@@ -0,0 +1,15 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/andreevym/metric-collector/internal/identity"
+)
+
+// IdentityMiddleware attaches the client identity to the request context,
+// it must run after TenantMiddleware to account the client by its tenant.
+func (m *Middleware) IdentityMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h.ServeHTTP(w, r.WithContext(identity.WithIdentity(r.Context(), identity.FromHTTPRequest(r, m.TrustedSubnet))))
+	})
+}
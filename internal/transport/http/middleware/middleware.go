@@ -1,17 +1,34 @@
 package middleware
 
-import "net"
+import (
+	"github.com/andreevym/metric-collector/internal/crypto"
+	"github.com/andreevym/metric-collector/internal/hash"
+	"github.com/andreevym/metric-collector/internal/oidc"
+	"github.com/andreevym/metric-collector/internal/subnet"
+	"github.com/andreevym/metric-collector/internal/tenant"
+)
 
 type Middleware struct {
-	SecretKey     string
-	CryptoKey     string
-	TrustedSubnet *net.IPNet
+	SecretKey string
+	// Verifier проверяет подписи запросов активными секретными ключами, nil — подписи не проверяются
+	Verifier *hash.Verifier
+	// RequireSignature отклонять запросы без подписи
+	RequireSignature bool
+	// Decrypter приватные ключи для расшифровки тела запроса, nil — тело запроса не шифруется
+	Decrypter *crypto.Decrypter
+	// TrustedSubnet доверенные подсети и прокси, без подсетей запросы принимаются с любых адресов
+	TrustedSubnet *subnet.Policy
+	// Tenants API ключи арендаторов, nil — запросы не разделяются по арендаторам
+	Tenants *tenant.Keys
+	// Bearer проверяет bearer токены пользователей, nil — токены не принимаются
+	Bearer *oidc.Verifier
 }
 
-func NewMiddleware(secretKey string, cryptoKey string, trustedSubnet *net.IPNet) *Middleware {
+func NewMiddleware(secretKey string, decrypter *crypto.Decrypter, trustedSubnet *subnet.Policy) *Middleware {
 	return &Middleware{
 		SecretKey:     secretKey,
-		CryptoKey:     cryptoKey,
+		Verifier:      hash.NewVerifier([]string{secretKey}, hash.DefaultMaxSkew),
+		Decrypter:     decrypter,
 		TrustedSubnet: trustedSubnet,
 	}
 }
@@ -0,0 +1,31 @@
+package middleware
+
+import (
+	"net/http"
+
+	"github.com/andreevym/metric-collector/internal/logger"
+	"github.com/andreevym/metric-collector/internal/oidc"
+	"github.com/andreevym/metric-collector/internal/tenant"
+	"go.uber.org/zap"
+)
+
+// TenantMiddleware resolves the tenant by the API key from the tenant.Header or by the tenant claim
+// of the bearer token and scopes the request context to it, it must run after BearerMiddleware.
+// Requests without a known key or tenant are rejected with 401.
+func (m *Middleware) TenantMiddleware(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		name, ok := m.Tenants.Lookup(r.Header.Get(tenant.Header))
+		if claims, hasToken := oidc.FromContext(r.Context()); !ok && hasToken {
+			name, ok = claims.Tenant, m.Tenants.Has(claims.Tenant)
+		}
+		if !ok {
+			logger.Logger().Warn("request with unknown tenant api key",
+				zap.String("method", r.Method),
+				zap.String("uri", r.RequestURI),
+			)
+			http.Error(w, "unknown tenant api key", http.StatusUnauthorized)
+			return
+		}
+		h.ServeHTTP(w, r.WithContext(tenant.WithTenant(r.Context(), name)))
+	})
+}
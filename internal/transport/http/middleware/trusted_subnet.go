@@ -1,29 +1,26 @@
 package middleware
 
 import (
-	"io"
-	"net"
 	"net/http"
 
+	"github.com/andreevym/metric-collector/internal/identity"
 	"github.com/andreevym/metric-collector/internal/logger"
 	"go.uber.org/zap"
 )
 
+// TrustedSubnetMiddleware rejects requests from clients outside the trusted subnets with 403,
+// the address of the client is the peer address or X-Real-IP set by a trusted proxy.
 func (m *Middleware) TrustedSubnetMiddleware(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ipStr := r.Header.Get("X-Real-IP")
-		if ipStr == "" {
-			h.ServeHTTP(w, r)
-			return
-		}
-		ip := net.ParseIP(ipStr)
-
-		if !m.TrustedSubnet.Contains(ip) {
-			_, err := io.WriteString(w, "Trusted Subnet Not Trusted")
-			if err != nil {
-				logger.Logger().Error("value can't be written", zap.Error(err))
-			}
-			w.WriteHeader(http.StatusForbidden)
+		realIP := r.Header.Get(identity.RealIPHeader)
+		if ip, ok := m.TrustedSubnet.Allow(r.RemoteAddr, realIP); !ok {
+			logger.Logger().Warn("request from untrusted address",
+				zap.String("path", r.URL.Path),
+				zap.String("remote_addr", r.RemoteAddr),
+				zap.String("real_ip", realIP),
+				zap.Stringer("ip", ip),
+			)
+			http.Error(w, "trusted subnet not trusted", http.StatusForbidden)
 			return
 		}
 		h.ServeHTTP(w, r)
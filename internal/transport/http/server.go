@@ -3,57 +3,112 @@ package http
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
 	"github.com/andreevym/metric-collector/internal/logger"
 	"go.uber.org/zap"
-	"net"
 	"net/http"
+	"time"
 
 	_ "github.com/andreevym/metric-collector/docs"
-	"github.com/andreevym/metric-collector/internal/storage/postgres"
+	"github.com/andreevym/metric-collector/internal/config"
+	"github.com/andreevym/metric-collector/internal/controller"
+	"github.com/andreevym/metric-collector/internal/crypto"
+	"github.com/andreevym/metric-collector/internal/hash"
+	"github.com/andreevym/metric-collector/internal/oidc"
+	"github.com/andreevym/metric-collector/internal/rbac"
 	"github.com/andreevym/metric-collector/internal/storage/store"
+	"github.com/andreevym/metric-collector/internal/subnet"
+	"github.com/andreevym/metric-collector/internal/tenant"
 	"github.com/andreevym/metric-collector/internal/transport/http/handlers"
 	"github.com/andreevym/metric-collector/internal/transport/http/middleware"
 )
 
 type Server struct {
-	handler http.Handler
-	server  *http.Server
-	address string
+	handler   http.Handler
+	server    *http.Server
+	address   string
+	tlsConfig *tls.Config
 }
 
-func NewHTTPServer(pgClient *postgres.PgClient, metricStorage store.Storage, secretKey string, cryptoKey string, trustedSubnet string, address string) (*Server, error) {
-	var err error
-	var ipTrustedSubnet *net.IPNet
-	if trustedSubnet != "" {
-		_, ipTrustedSubnet, err = net.ParseCIDR(trustedSubnet)
-		if err != nil {
-			return nil, fmt.Errorf("failed to parse trusted subnet: %w", err)
-		}
+func NewHTTPServer(ctrl controller.Controller, metricStorage store.Storage, cfg *config.ServerConfig) (*Server, error) {
+	trustedSubnet, err := subnet.ParsePolicy(cfg.TrustedSubnet, cfg.TrustedProxies)
+	if err != nil {
+		return nil, err
+	}
+	tenants, err := tenant.ParseKeys(cfg.TenantKeys)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse tenant keys: %w", err)
+	}
+	tlsConfig, err := crypto.ServerTLSConfig(cfg.TLSCert, cfg.TLSKey, cfg.TLSClientCA)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load tls config: %w", err)
+	}
+	decrypter, err := crypto.LoadDecrypter(cfg.CryptoKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load crypto key: %w", err)
+	}
+	m := middleware.NewMiddleware(cfg.SecretKey, decrypter, trustedSubnet)
+	m.Tenants = tenants
+	m.Verifier = hash.NewVerifier(
+		hash.ParseSecrets(cfg.SecretKey, cfg.SecretKeys),
+		time.Duration(cfg.SignatureMaxSkew)*time.Second,
+	)
+	m.RequireSignature = cfg.RequireSignature
+	m.Bearer = oidc.NewVerifier(oidc.Options{
+		JWKS:        cfg.OIDCJWKS,
+		Issuer:      cfg.OIDCIssuer,
+		Audience:    cfg.OIDCAudience,
+		TenantClaim: cfg.OIDCTenantClaim,
+		RolesClaim:  cfg.OIDCRolesClaim,
+		CacheTTL:    time.Duration(cfg.OIDCJWKSCacheTTL) * time.Second,
+	})
+	policy, err := rbac.ParseBindings(cfg.RBACBindings)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse rbac bindings: %w", err)
 	}
-	m := middleware.NewMiddleware(secretKey, cryptoKey, ipTrustedSubnet)
-	serviceHandlers := handlers.NewServiceHandlers(metricStorage, pgClient)
+	serviceHandlers := handlers.NewServiceHandlersWithController(metricStorage, ctrl).WithRBAC(policy)
+	// агент сжимает тело запроса, затем шифрует и подписывает его,
+	// поэтому сервер проверяет подпись, расшифровывает и только потом распаковывает тело
 	middlewares := []func(http.Handler) http.Handler{
 		m.RequestGzipMiddleware,
-		m.ResponseGzipMiddleware,
 		m.RequestLoggerMiddleware,
 		m.RequestHashMiddleware,
 		m.ResponseHashMiddleware,
 	}
-	if m.CryptoKey != "" {
+	if m.Decrypter != nil {
 		middlewares = append(middlewares, m.RequestCryptoMiddleware)
 	}
-	if m.TrustedSubnet != nil {
+	middlewares = append(middlewares, m.ResponseGzipMiddleware)
+	if m.TrustedSubnet.Enabled() {
 		middlewares = append(middlewares, m.TrustedSubnetMiddleware)
 	}
+	if m.Bearer.Enabled() {
+		middlewares = append(middlewares, m.BearerMiddleware)
+	}
+	if m.Tenants.Enabled() {
+		middlewares = append(middlewares, m.TenantMiddleware)
+	}
+	middlewares = append(middlewares, m.IdentityMiddleware)
 	router := handlers.NewRouter(serviceHandlers, middlewares...)
-	return &Server{handler: router, address: address}, nil
+	return &Server{handler: router, address: cfg.Address, tlsConfig: tlsConfig}, nil
 }
 
 func (s *Server) Run() error {
-	s.server = &http.Server{Addr: s.address, Handler: s.handler}
-	logger.Logger().Info("listening http server", zap.String("address", s.address))
-	if err := s.server.ListenAndServe(); err != nil {
+	s.server = &http.Server{Addr: s.address, Handler: s.handler, TLSConfig: s.tlsConfig}
+	logger.Logger().Info("listening http server",
+		zap.String("address", s.address),
+		zap.Bool("tls", s.tlsConfig != nil),
+	)
+	var err error
+	if s.tlsConfig != nil {
+		// сертификат уже загружен в TLSConfig
+		err = s.server.ListenAndServeTLS("", "")
+	} else {
+		err = s.server.ListenAndServe()
+	}
+	if err != nil && !errors.Is(err, http.ErrServerClosed) {
 		return fmt.Errorf("start http server: %w", err)
 	}
 	return nil
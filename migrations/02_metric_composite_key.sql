@@ -0,0 +1,35 @@
+-- Миграция переводит таблицу metric на составной первичный ключ (id, type):
+-- gauge и counter с одинаковым именем больше не конфликтуют, длина имени не ограничена 50 символами,
+-- тип метрики ограничен перечислением metric_type, а каждая запись хранит время создания и обновления.
+-- Миграция идемпотентна, так как сервер применяет все миграции при каждом запуске.
+DO
+$$
+    BEGIN
+        IF NOT EXISTS (SELECT 1 FROM pg_type WHERE typname = 'metric_type') THEN
+            CREATE TYPE metric_type AS ENUM ('gauge', 'counter');
+        END IF;
+
+        IF EXISTS (SELECT 1
+                   FROM information_schema.columns
+                   WHERE table_name = 'metric'
+                     AND column_name = 'type'
+                     AND udt_name <> 'metric_type') THEN
+            -- записи с неизвестным типом или без значения не могут быть перенесены в новую схему
+            DELETE
+            FROM metric
+            WHERE type IS NULL
+               OR type NOT IN ('gauge', 'counter')
+               OR (delta IS NULL AND value IS NULL);
+
+            ALTER TABLE metric DROP CONSTRAINT IF EXISTS metric_pkey;
+            ALTER TABLE metric
+                ALTER COLUMN id TYPE TEXT,
+                ALTER COLUMN type TYPE metric_type USING type::metric_type,
+                ALTER COLUMN type SET NOT NULL,
+                ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                ADD COLUMN IF NOT EXISTS updated_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+                ADD CONSTRAINT metric_pkey PRIMARY KEY (id, type),
+                ADD CONSTRAINT metric_value_check CHECK (delta IS NOT NULL OR value IS NOT NULL);
+        END IF;
+    END
+$$;
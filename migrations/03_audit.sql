@@ -0,0 +1,20 @@
+-- Журнал аудита изменений метрик и вызовов административных маршрутов.
+-- changes хранит список изменённых метрик со старыми и новыми значениями,
+-- индекс по changes позволяет искать события по ID метрики.
+CREATE TABLE IF NOT EXISTS audit
+(
+    id      BIGSERIAL PRIMARY KEY,
+    time    TIMESTAMPTZ NOT NULL,
+    action  TEXT        NOT NULL,
+    client  TEXT        NOT NULL,
+    tenant  TEXT        NOT NULL DEFAULT '',
+    subject TEXT        NOT NULL DEFAULT '',
+    "user"  TEXT        NOT NULL DEFAULT '',
+    ip      TEXT        NOT NULL DEFAULT '',
+    target  TEXT        NOT NULL DEFAULT '',
+    changes JSONB       NOT NULL DEFAULT '[]',
+    error   TEXT        NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS audit_time_idx ON audit (time DESC);
+CREATE INDEX IF NOT EXISTS audit_changes_idx ON audit USING GIN (changes jsonb_path_ops);